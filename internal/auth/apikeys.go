@@ -0,0 +1,378 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultAPIKeyTTL = 90 * 24 * time.Hour
+	// APIKeyPrefix starts every API key so leaked keys are easy to recognise.
+	APIKeyPrefix = "oms_"
+	// APIKeySubjectPrefix starts the subject of callers using an API key.
+	APIKeySubjectPrefix = "apikey:"
+	// DefaultAPIKeyFlushInterval is how often a FileAPIKeyStore should be
+	// flushed to write the last use of its keys.
+	DefaultAPIKeyFlushInterval = time.Minute
+	// apiKeyLastUsedResolution limits how often the last use of a key is
+	// recorded in its store.
+	apiKeyLastUsedResolution = time.Minute
+)
+
+var (
+	ErrAPIKeyNotFound     = errors.New("API key not found")
+	ErrInvalidAPIKey      = errors.New("API key is invalid, expired or revoked")
+	ErrAPIKeyLookupFailed = errors.New("failed to look up API key")
+	ErrUnknownScopes      = errors.New("unknown scopes")
+)
+
+// APIKey is the stored record of an API key. Only the hash of the key is
+// kept; the key itself is shown once when it is created.
+type APIKey struct {
+	ID         string     `json:"id"`
+	Name       string     `json:"name"`
+	Hash       string     `json:"hash"`
+	Scopes     []string   `json:"scopes"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+}
+
+// APIKeyStore persists API keys by ID.
+type APIKeyStore interface {
+	Save(ctx context.Context, key APIKey) error
+	FindAPIKey(ctx context.Context, id string) (*APIKey, error)
+	ListAPIKeys(ctx context.Context) ([]APIKey, error)
+	Revoke(ctx context.Context, id string, at time.Time) error
+	Touch(ctx context.Context, id string, at time.Time) error
+}
+
+// APIKeys creates API keys and authenticates callers presenting them.
+type APIKeys struct {
+	store       APIKeyStore
+	knownScopes []string
+	logger      *slog.Logger
+}
+
+// NewAPIKeys returns APIKeys granting only knownScopes, typically every scope
+// the policy mentions. Store failures that do not fail a request are logged to
+// logger, or to slog.Default() if logger is nil.
+func NewAPIKeys(store APIKeyStore, knownScopes []string, logger *slog.Logger) *APIKeys {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return &APIKeys{store: store, knownScopes: knownScopes, logger: logger}
+}
+
+// Create returns a new key of the form oms_<id>_<secret> together with its
+// record. Scopes missing from the known scopes give ErrUnknownScopes, as a
+// mistyped scope would never grant anything.
+func (k *APIKeys) Create(ctx context.Context, name string, scopes []string, ttl time.Duration) (string, *APIKey, error) {
+	var unknown []string
+	for _, scope := range scopes {
+		if !slices.Contains(k.knownScopes, scope) {
+			unknown = append(unknown, scope)
+		}
+	}
+	if len(unknown) > 0 {
+		return "", nil, fmt.Errorf("%w: %s", ErrUnknownScopes, strings.Join(unknown, ", "))
+	}
+	if ttl <= 0 {
+		ttl = DefaultAPIKeyTTL
+	}
+	id, err := newTokenID()
+	if err != nil {
+		return "", nil, err
+	}
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", nil, err
+	}
+	key := APIKeyPrefix + id + "_" + base64.RawURLEncoding.EncodeToString(secret)
+
+	now := time.Now()
+	record := APIKey{
+		ID:        id,
+		Name:      name,
+		Hash:      hashAPIKey(key),
+		Scopes:    scopes,
+		CreatedAt: now,
+		ExpiresAt: now.Add(ttl),
+	}
+	if err := k.store.Save(ctx, record); err != nil {
+		return "", nil, err
+	}
+	return key, &record, nil
+}
+
+func (k *APIKeys) List(ctx context.Context) ([]APIKey, error) {
+	return k.store.ListAPIKeys(ctx)
+}
+
+func (k *APIKeys) Revoke(ctx context.Context, id string) error {
+	return k.store.Revoke(ctx, id, time.Now())
+}
+
+// Authenticate returns the caller owning key. Every failure is reported as
+// ErrInvalidAPIKey, except errors of the store which wrap
+// ErrAPIKeyLookupFailed.
+func (k *APIKeys) Authenticate(ctx context.Context, key string) (*Principal, error) {
+	id, _, found := strings.Cut(strings.TrimPrefix(key, APIKeyPrefix), "_")
+	if !strings.HasPrefix(key, APIKeyPrefix) || !found {
+		return nil, ErrInvalidAPIKey
+	}
+
+	record, err := k.store.FindAPIKey(ctx, id)
+	if errors.Is(err, ErrAPIKeyNotFound) {
+		return nil, ErrInvalidAPIKey
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrAPIKeyLookupFailed, err)
+	}
+
+	now := time.Now()
+	if subtle.ConstantTimeCompare([]byte(record.Hash), []byte(hashAPIKey(key))) != 1 ||
+		record.RevokedAt != nil || now.After(record.ExpiresAt) {
+		return nil, ErrInvalidAPIKey
+	}
+
+	// Failing to record the last use must not lock out the caller.
+	if record.LastUsedAt == nil || now.Sub(*record.LastUsedAt) >= apiKeyLastUsedResolution {
+		if err := k.store.Touch(ctx, id, now); err != nil {
+			k.logger.ErrorContext(ctx, "failed to record last use of API key", "id", id, "err", err)
+		}
+	}
+
+	return &Principal{
+		Subject:    APIKeySubjectPrefix + record.ID,
+		Scopes:     record.Scopes,
+		AuthScheme: SchemeAPIKey,
+		ExpiresAt:  record.ExpiresAt,
+	}, nil
+}
+
+func hashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// MemoryAPIKeyStore keeps API keys in process, mainly for tests and local
+// setups. Keys do not survive a restart.
+type MemoryAPIKeyStore struct {
+	mu   sync.RWMutex
+	keys map[string]APIKey
+}
+
+func NewMemoryAPIKeyStore(keys ...APIKey) *MemoryAPIKeyStore {
+	s := &MemoryAPIKeyStore{keys: make(map[string]APIKey, len(keys))}
+	for _, key := range keys {
+		s.keys[key.ID] = key
+	}
+	return s
+}
+
+func (s *MemoryAPIKeyStore) Save(ctx context.Context, key APIKey) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.keys[key.ID] = key
+	return nil
+}
+
+func (s *MemoryAPIKeyStore) FindAPIKey(ctx context.Context, id string) (*APIKey, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	key, ok := s.keys[id]
+	if !ok {
+		return nil, ErrAPIKeyNotFound
+	}
+	return &key, nil
+}
+
+// ListAPIKeys returns the keys ordered by creation time.
+func (s *MemoryAPIKeyStore) ListAPIKeys(ctx context.Context) ([]APIKey, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	keys := make([]APIKey, 0, len(s.keys))
+	for _, key := range s.keys {
+		keys = append(keys, key)
+	}
+	slices.SortFunc(keys, func(a, b APIKey) int { return a.CreatedAt.Compare(b.CreatedAt) })
+	return keys, nil
+}
+
+func (s *MemoryAPIKeyStore) Revoke(ctx context.Context, id string, at time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key, ok := s.keys[id]
+	if !ok {
+		return ErrAPIKeyNotFound
+	}
+	if key.RevokedAt == nil {
+		key.RevokedAt = &at
+		s.keys[id] = key
+	}
+	return nil
+}
+
+func (s *MemoryAPIKeyStore) Touch(ctx context.Context, id string, at time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key, ok := s.keys[id]
+	if !ok {
+		return ErrAPIKeyNotFound
+	}
+	key.LastUsedAt = &at
+	s.keys[id] = key
+	return nil
+}
+
+// FileAPIKeyStore keeps API keys in memory and writes them back to a JSON file
+// of the form {"api_keys": [...]} on every change. Last uses recorded by Touch
+// are only written by the next change or Flush, so authenticating does not
+// rewrite the file. Reload picks up changes made to the file by other processes
+// and drops the last uses not flushed yet.
+type FileAPIKeyStore struct {
+	path string
+
+	mu      sync.Mutex
+	keys    *MemoryAPIKeyStore
+	touched bool
+}
+
+func NewFileAPIKeyStore(path string) (*FileAPIKeyStore, error) {
+	s := &FileAPIKeyStore{path: path}
+	if err := s.Reload(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Reload treats a missing file as an empty store; it is created with the
+// first key.
+func (s *FileAPIKeyStore) Reload() error {
+	var file struct {
+		APIKeys []APIKey `json:"api_keys"`
+	}
+	data, err := os.ReadFile(s.path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to read API keys file: %w", err)
+	}
+	if err == nil {
+		if err := json.Unmarshal(data, &file); err != nil {
+			return fmt.Errorf("failed to parse API keys file: %w", err)
+		}
+	}
+
+	keys := NewMemoryAPIKeyStore(file.APIKeys...)
+	s.mu.Lock()
+	s.keys = keys
+	s.touched = false
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *FileAPIKeyStore) Save(ctx context.Context, key APIKey) error {
+	return s.update(ctx, func(keys *MemoryAPIKeyStore) error { return keys.Save(ctx, key) })
+}
+
+func (s *FileAPIKeyStore) FindAPIKey(ctx context.Context, id string) (*APIKey, error) {
+	s.mu.Lock()
+	keys := s.keys
+	s.mu.Unlock()
+	return keys.FindAPIKey(ctx, id)
+}
+
+func (s *FileAPIKeyStore) ListAPIKeys(ctx context.Context) ([]APIKey, error) {
+	s.mu.Lock()
+	keys := s.keys
+	s.mu.Unlock()
+	return keys.ListAPIKeys(ctx)
+}
+
+func (s *FileAPIKeyStore) Revoke(ctx context.Context, id string, at time.Time) error {
+	return s.update(ctx, func(keys *MemoryAPIKeyStore) error { return keys.Revoke(ctx, id, at) })
+}
+
+func (s *FileAPIKeyStore) Touch(ctx context.Context, id string, at time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.keys.Touch(ctx, id, at); err != nil {
+		return err
+	}
+	s.touched = true
+	return nil
+}
+
+// Flush writes the last uses recorded since the file was last written.
+func (s *FileAPIKeyStore) Flush(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.touched {
+		return nil
+	}
+	if err := s.write(ctx, s.keys); err != nil {
+		return err
+	}
+	s.touched = false
+	return nil
+}
+
+// update applies change to a copy of the keys and only uses the copy once it
+// has been written, so a failed write leaves the store as it was.
+func (s *FileAPIKeyStore) update(ctx context.Context, change func(keys *MemoryAPIKeyStore) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	current, _ := s.keys.ListAPIKeys(ctx)
+	keys := NewMemoryAPIKeyStore(current...)
+	if err := change(keys); err != nil {
+		return err
+	}
+	if err := s.write(ctx, keys); err != nil {
+		return err
+	}
+	s.keys = keys
+	s.touched = false
+	return nil
+}
+
+// write saves keys to a temporary file that is renamed over the store file,
+// so a crash never leaves a partial file.
+func (s *FileAPIKeyStore) write(ctx context.Context, keys *MemoryAPIKeyStore) error {
+	list, _ := keys.ListAPIKeys(ctx)
+	data, err := json.MarshalIndent(struct {
+		APIKeys []APIKey `json:"api_keys"`
+	}{list}, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return fmt.Errorf("failed to write API keys file: %w", err)
+	}
+	if err := os.Rename(tmp, s.path); err != nil {
+		return fmt.Errorf("failed to write API keys file: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,146 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+var testKnownScopes = []string{"orders:read", "products:read"}
+
+func TestAPIKeysAuthenticate(t *testing.T) {
+	store := NewMemoryAPIKeyStore()
+	apiKeys := NewAPIKeys(store, testKnownScopes, nil)
+	ctx := context.Background()
+
+	key, record, err := apiKeys.Create(ctx, "batch", []string{"products:read"}, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	principal, err := apiKeys.Authenticate(ctx, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if principal.Subject != APIKeySubjectPrefix+record.ID || principal.AuthScheme != SchemeAPIKey || !principal.HasScope("products:read") {
+		t.Errorf("principal = %+v", principal)
+	}
+	stored, _ := store.FindAPIKey(ctx, record.ID)
+	if stored.LastUsedAt == nil {
+		t.Error("last use was not recorded")
+	}
+
+	wrongSecret := key[:len(key)-1] + "A"
+	if wrongSecret == key {
+		wrongSecret = key[:len(key)-1] + "B"
+	}
+	for name, key := range map[string]string{
+		"wrong secret": wrongSecret,
+		"unknown id":   APIKeyPrefix + "0000_secret",
+		"no prefix":    key[len(APIKeyPrefix):],
+	} {
+		if _, err := apiKeys.Authenticate(ctx, key); !errors.Is(err, ErrInvalidAPIKey) {
+			t.Errorf("%s: err = %v, want %v", name, err, ErrInvalidAPIKey)
+		}
+	}
+
+	if err := apiKeys.Revoke(ctx, record.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := apiKeys.Authenticate(ctx, key); !errors.Is(err, ErrInvalidAPIKey) {
+		t.Errorf("revoked key: err = %v, want %v", err, ErrInvalidAPIKey)
+	}
+}
+
+func TestAPIKeysRejectsExpiredKey(t *testing.T) {
+	store := NewMemoryAPIKeyStore()
+	apiKeys := NewAPIKeys(store, testKnownScopes, nil)
+	ctx := context.Background()
+
+	key, record, err := apiKeys.Create(ctx, "batch", nil, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	record.ExpiresAt = time.Now().Add(-time.Second)
+	store.Save(ctx, *record)
+
+	if _, err := apiKeys.Authenticate(ctx, key); !errors.Is(err, ErrInvalidAPIKey) {
+		t.Errorf("err = %v, want %v", err, ErrInvalidAPIKey)
+	}
+}
+
+func TestAPIKeysCreateRejectsUnknownScopes(t *testing.T) {
+	store := NewMemoryAPIKeyStore()
+	apiKeys := NewAPIKeys(store, testKnownScopes, nil)
+
+	_, _, err := apiKeys.Create(context.Background(), "batch", []string{"products:read", "product:write"}, 0)
+	if !errors.Is(err, ErrUnknownScopes) {
+		t.Fatalf("err = %v, want %v", err, ErrUnknownScopes)
+	}
+	if keys, _ := store.ListAPIKeys(context.Background()); len(keys) != 0 {
+		t.Errorf("stored %d keys, want none", len(keys))
+	}
+}
+
+func readAPIKeysFile(t *testing.T, path string) []APIKey {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var file struct {
+		APIKeys []APIKey `json:"api_keys"`
+	}
+	if err := json.Unmarshal(data, &file); err != nil {
+		t.Fatal(err)
+	}
+	return file.APIKeys
+}
+
+func TestFileAPIKeyStoreFlushesLastUse(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "api-keys.json")
+	store, err := NewFileAPIKeyStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	if err := store.Save(ctx, APIKey{ID: "1", Name: "batch", ExpiresAt: time.Now().Add(time.Hour)}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := store.Touch(ctx, "1", time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	if key, _ := store.FindAPIKey(ctx, "1"); key.LastUsedAt == nil {
+		t.Error("last use is not visible before the flush")
+	}
+	if keys := readAPIKeysFile(t, path); keys[0].LastUsedAt != nil {
+		t.Error("Touch wrote the file")
+	}
+
+	if err := store.Flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if keys := readAPIKeysFile(t, path); keys[0].LastUsedAt == nil {
+		t.Error("Flush did not write the last use")
+	}
+}
+
+func TestFileAPIKeyStoreKeepsStateWhenWriteFails(t *testing.T) {
+	dir := t.TempDir()
+	store, err := NewFileAPIKeyStore(filepath.Join(dir, "missing", "api-keys.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	if err := store.Save(ctx, APIKey{ID: "1", Name: "batch"}); err == nil {
+		t.Fatal("Save succeeded without a directory to write to")
+	}
+	if _, err := store.FindAPIKey(ctx, "1"); !errors.Is(err, ErrAPIKeyNotFound) {
+		t.Errorf("FindAPIKey err = %v, want the key not to be kept after a failed write", err)
+	}
+}
@@ -0,0 +1,130 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultMaxLoginFailures = 5
+	DefaultLockoutDuration  = 15 * time.Minute
+)
+
+// ErrInvalidCredentials is returned for every failed login, whether the user
+// is unknown, the password is wrong or the account is locked, so callers
+// cannot tell which usernames exist.
+var ErrInvalidCredentials = errors.New("invalid email or password")
+
+type LockoutConfig struct {
+	// MaxFailures is the number of consecutive failed logins after which an
+	// account is locked.
+	MaxFailures int
+	// Duration is how long an account stays locked. Failures older than this
+	// are forgotten.
+	Duration time.Duration
+}
+
+// Authenticator verifies passwords against a UserStore and locks accounts
+// after repeated failures. Only failures against existing users are counted,
+// so the attempts kept are bounded by the number of users however many
+// usernames are guessed.
+type Authenticator struct {
+	users     UserStore
+	lockout   LockoutConfig
+	mu        sync.Mutex
+	attempts  map[string]*loginAttempts
+	lastSweep time.Time
+}
+
+type loginAttempts struct {
+	failures    int
+	lastFailure time.Time
+	lockedUntil time.Time
+}
+
+func NewAuthenticator(users UserStore, lockout LockoutConfig) *Authenticator {
+	if lockout.MaxFailures <= 0 {
+		lockout.MaxFailures = DefaultMaxLoginFailures
+	}
+	if lockout.Duration <= 0 {
+		lockout.Duration = DefaultLockoutDuration
+	}
+	return &Authenticator{
+		users:    users,
+		lockout:  lockout,
+		attempts: make(map[string]*loginAttempts),
+	}
+}
+
+func (a *Authenticator) Authenticate(ctx context.Context, username, password string) (*User, error) {
+	if a.locked(username) {
+		comparePassword(dummyPasswordHash, password)
+		return nil, ErrInvalidCredentials
+	}
+
+	user, err := a.users.FindUser(ctx, username)
+	if errors.Is(err, ErrUserNotFound) {
+		comparePassword(dummyPasswordHash, password)
+		return nil, ErrInvalidCredentials
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := comparePassword(user.PasswordHash, password); err != nil {
+		a.recordFailure(username)
+		return nil, ErrInvalidCredentials
+	}
+	a.recordSuccess(username)
+	return user, nil
+}
+
+func (a *Authenticator) locked(username string) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	attempts, ok := a.attempts[username]
+	return ok && time.Now().Before(attempts.lockedUntil)
+}
+
+func (a *Authenticator) recordFailure(username string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	now := time.Now()
+	a.sweep(now)
+
+	attempts, ok := a.attempts[username]
+	if !ok || now.Sub(attempts.lastFailure) > a.lockout.Duration {
+		attempts = &loginAttempts{}
+		a.attempts[username] = attempts
+	}
+	attempts.failures++
+	attempts.lastFailure = now
+	if attempts.failures >= a.lockout.MaxFailures {
+		attempts.lockedUntil = now.Add(a.lockout.Duration)
+		attempts.failures = 0
+	}
+}
+
+func (a *Authenticator) recordSuccess(username string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	delete(a.attempts, username)
+}
+
+// sweep forgets usernames whose failures and lockout have both expired, such
+// as users removed from the store since. It runs at most once a minute.
+func (a *Authenticator) sweep(now time.Time) {
+	if now.Sub(a.lastSweep) < time.Minute {
+		return
+	}
+	a.lastSweep = now
+	for username, attempts := range a.attempts {
+		if now.Sub(attempts.lastFailure) > a.lockout.Duration && now.After(attempts.lockedUntil) {
+			delete(a.attempts, username)
+		}
+	}
+}
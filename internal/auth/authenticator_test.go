@@ -0,0 +1,69 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// testPasswordHash is the bcrypt hash of "password".
+const testPasswordHash = "$2a$10$IzGBaCABqoVyP8cAGoc4aub0pDFjqkuV8ipSi5HIX.RKzW/viNhWG"
+
+func newTestAuthenticator() *Authenticator {
+	users := NewMemoryUserStore(User{Username: "dev@example.com", PasswordHash: testPasswordHash})
+	return NewAuthenticator(users, LockoutConfig{MaxFailures: 2, Duration: time.Minute})
+}
+
+func TestAuthenticate(t *testing.T) {
+	a := newTestAuthenticator()
+	ctx := context.Background()
+
+	user, err := a.Authenticate(ctx, "dev@example.com", "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.Username != "dev@example.com" {
+		t.Errorf("username = %q, want dev@example.com", user.Username)
+	}
+	if _, err := a.Authenticate(ctx, "dev@example.com", "wrong"); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("wrong password: err = %v, want %v", err, ErrInvalidCredentials)
+	}
+	if _, err := a.Authenticate(ctx, "nobody@example.com", "password"); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("unknown user: err = %v, want %v", err, ErrInvalidCredentials)
+	}
+}
+
+func TestAuthenticateLocksAccount(t *testing.T) {
+	a := newTestAuthenticator()
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		if _, err := a.Authenticate(ctx, "dev@example.com", "wrong"); !errors.Is(err, ErrInvalidCredentials) {
+			t.Fatalf("failure %d: err = %v, want %v", i+1, err, ErrInvalidCredentials)
+		}
+	}
+	if _, err := a.Authenticate(ctx, "dev@example.com", "password"); !errors.Is(err, ErrInvalidCredentials) {
+		t.Fatalf("locked account: err = %v, want %v", err, ErrInvalidCredentials)
+	}
+
+	a.attempts["dev@example.com"].lockedUntil = time.Now().Add(-time.Second)
+	if _, err := a.Authenticate(ctx, "dev@example.com", "password"); err != nil {
+		t.Fatalf("after the lockout: %v", err)
+	}
+	if len(a.attempts) != 0 {
+		t.Errorf("attempts = %d after a successful login, want 0", len(a.attempts))
+	}
+}
+
+func TestAuthenticateIgnoresUnknownUsernames(t *testing.T) {
+	a := newTestAuthenticator()
+	ctx := context.Background()
+
+	for _, username := range []string{"a@example.com", "b@example.com", "c@example.com"} {
+		a.Authenticate(ctx, username, "password")
+	}
+	if len(a.attempts) != 0 {
+		t.Errorf("attempts = %d, want unknown usernames not to be tracked", len(a.attempts))
+	}
+}
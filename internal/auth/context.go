@@ -0,0 +1,44 @@
+package auth
+
+import (
+	"context"
+	"time"
+)
+
+// Principal is the authenticated caller of a request, as established by the
+// authorization middleware.
+type Principal struct {
+	Subject string
+	Roles   []string
+	Scopes  []string
+	// AuthScheme is the scheme the caller authenticated with.
+	AuthScheme string
+	// ClientIdentity is the identity of the verified TLS client certificate
+	// the caller connected with, if any.
+	ClientIdentity string
+	// TokenID, IssuedAt and ExpiresAt describe the token the caller presented.
+	TokenID   string
+	IssuedAt  time.Time
+	ExpiresAt time.Time
+}
+
+const (
+	SchemeBearer     = "bearer"
+	SchemeAPIKey     = "api_key"
+	SchemeClientCert = "client_cert"
+
+	// ClientCertSubjectPrefix starts the subject of callers authenticated by
+	// their client certificate alone.
+	ClientCertSubjectPrefix = "cert:"
+)
+
+type principalKey struct{}
+
+func NewContext(ctx context.Context, principal *Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, principal)
+}
+
+func PrincipalFromContext(ctx context.Context) (*Principal, bool) {
+	principal, ok := ctx.Value(principalKey{}).(*Principal)
+	return principal, ok && principal != nil
+}
@@ -0,0 +1,142 @@
+package auth
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+	"time"
+)
+
+// JSONWebKey is the public part of a signing key as described in RFC 7517.
+type JSONWebKey struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+
+	// RSA
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+
+	// EC
+	Curve string `json:"crv,omitempty"`
+	X     string `json:"x,omitempty"`
+	Y     string `json:"y,omitempty"`
+}
+
+type JSONWebKeySet struct {
+	Keys []JSONWebKey `json:"keys"`
+}
+
+// JWKS returns the public keys of every asymmetric key that has not retired.
+// HS256 secrets are never published.
+func (ks *KeySet) JWKS() JSONWebKeySet {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+
+	now := time.Now()
+	jwks := JSONWebKeySet{Keys: []JSONWebKey{}}
+	for _, key := range ks.keys {
+		if key.retired(now) {
+			continue
+		}
+		switch publicKey := key.PublicKey.(type) {
+		case *rsa.PublicKey:
+			jwks.Keys = append(jwks.Keys, JSONWebKey{
+				KeyType:   "RSA",
+				KeyID:     key.ID,
+				Use:       "sig",
+				Algorithm: key.Algorithm,
+				N:         encodeBase64URL(publicKey.N.Bytes()),
+				E:         encodeBase64URL(big.NewInt(int64(publicKey.E)).Bytes()),
+			})
+		case *ecdsa.PublicKey:
+			size := (publicKey.Curve.Params().BitSize + 7) / 8
+			jwks.Keys = append(jwks.Keys, JSONWebKey{
+				KeyType:   "EC",
+				KeyID:     key.ID,
+				Use:       "sig",
+				Algorithm: key.Algorithm,
+				Curve:     publicKey.Curve.Params().Name,
+				X:         encodeBase64URL(publicKey.X.FillBytes(make([]byte, size))),
+				Y:         encodeBase64URL(publicKey.Y.FillBytes(make([]byte, size))),
+			})
+		}
+	}
+	sort.Slice(jwks.Keys, func(i, j int) bool { return jwks.Keys[i].KeyID < jwks.Keys[j].KeyID })
+	return jwks
+}
+
+func encodeBase64URL(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// Key converts a published RS256 or ES256 key into a verification Key. Keys
+// with another algorithm or meant for encryption are rejected.
+func (jwk JSONWebKey) Key() (*Key, error) {
+	if jwk.Use != "" && jwk.Use != "sig" {
+		return nil, fmt.Errorf("JWK %q is not a signing key", jwk.KeyID)
+	}
+
+	key := &Key{ID: jwk.KeyID, Algorithm: jwk.Algorithm}
+	switch jwk.KeyType {
+	case "RSA":
+		n, err := decodeBase64URLInt(jwk.N)
+		if err != nil {
+			return nil, fmt.Errorf("JWK %q: invalid modulus: %w", jwk.KeyID, err)
+		}
+		e, err := decodeBase64URLInt(jwk.E)
+		if err != nil || !e.IsInt64() {
+			return nil, fmt.Errorf("JWK %q: invalid exponent", jwk.KeyID)
+		}
+		key.PublicKey = &rsa.PublicKey{N: n, E: int(e.Int64())}
+		if key.Algorithm == "" {
+			key.Algorithm = AlgorithmRS256
+		}
+	case "EC":
+		if jwk.Curve != elliptic.P256().Params().Name {
+			return nil, fmt.Errorf("JWK %q: unsupported curve %q", jwk.KeyID, jwk.Curve)
+		}
+		x, err := decodeBase64URLInt(jwk.X)
+		if err != nil {
+			return nil, fmt.Errorf("JWK %q: invalid x coordinate: %w", jwk.KeyID, err)
+		}
+		y, err := decodeBase64URLInt(jwk.Y)
+		if err != nil {
+			return nil, fmt.Errorf("JWK %q: invalid y coordinate: %w", jwk.KeyID, err)
+		}
+		if !elliptic.P256().IsOnCurve(x, y) {
+			return nil, fmt.Errorf("JWK %q: point is not on the curve", jwk.KeyID)
+		}
+		key.PublicKey = &ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}
+		if key.Algorithm == "" {
+			key.Algorithm = AlgorithmES256
+		}
+	default:
+		return nil, fmt.Errorf("JWK %q: unsupported key type %q", jwk.KeyID, jwk.KeyType)
+	}
+
+	if key.Algorithm == AlgorithmHS256 {
+		return nil, fmt.Errorf("JWK %q: unsupported algorithm %q", jwk.KeyID, key.Algorithm)
+	}
+	if err := key.validate(); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+func decodeBase64URLInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	if len(b) == 0 {
+		return nil, errors.New("empty value")
+	}
+	return new(big.Int).SetBytes(b), nil
+}
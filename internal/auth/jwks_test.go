@@ -0,0 +1,191 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestECKeyWithShortX returns a P-256 key whose x coordinate has a leading
+// zero byte, so its encoding must be padded to the curve size.
+func newTestECKeyWithShortX(t *testing.T) *ecdsa.PrivateKey {
+	t.Helper()
+	for {
+		key := newTestECKey(t)
+		if key.X.BitLen() <= 248 {
+			return key
+		}
+	}
+}
+
+func TestLoadKeySetRejectsMismatchedPublicKey(t *testing.T) {
+	tests := map[string]struct {
+		alg        string
+		privateKey interface{}
+		publicKey  interface{}
+	}{
+		"RS256": {alg: AlgorithmRS256, privateKey: newTestRSAKey(t), publicKey: &newTestRSAKey(t).PublicKey},
+		"ES256": {alg: AlgorithmES256, privateKey: newTestECKey(t), publicKey: &newTestECKey(t).PublicKey},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := LoadKeySet(KeyConfig{File: writeKeyFile(t, "", "k", map[string]interface{}{
+				"kid":              "k",
+				"alg":              tt.alg,
+				"private_key_file": writePrivateKeyPEM(t, tt.privateKey),
+				"public_key_file":  writePublicKeyPEM(t, tt.publicKey),
+			})})
+			if err == nil || !strings.Contains(err.Error(), "does not match") {
+				t.Fatalf("err = %v, want a mismatch error", err)
+			}
+		})
+	}
+}
+
+func TestLoadKeySetAcceptsMatchingPublicKey(t *testing.T) {
+	rsaKey := newTestRSAKey(t)
+	_, err := LoadKeySet(KeyConfig{File: writeKeyFile(t, "", "k", map[string]interface{}{
+		"kid":              "k",
+		"alg":              AlgorithmRS256,
+		"private_key_file": writePrivateKeyPEM(t, rsaKey),
+		"public_key_file":  writePublicKeyPEM(t, &rsaKey.PublicKey),
+	})})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestKeySetJWKS(t *testing.T) {
+	rsaKey := newTestRSAKey(t)
+	ecKey := newTestECKeyWithShortX(t)
+	ks, err := LoadKeySet(KeyConfig{
+		Keys: "hs:" + testSecretA,
+		File: writeKeyFile(t, "", "rsa",
+			map[string]interface{}{"kid": "rsa", "alg": AlgorithmRS256, "private_key_file": writePrivateKeyPEM(t, rsaKey)},
+			map[string]interface{}{"kid": "ec", "alg": AlgorithmES256, "public_key_file": writePublicKeyPEM(t, &ecKey.PublicKey)},
+			map[string]interface{}{
+				"kid": "retired", "alg": AlgorithmRS256, "public_key_file": writePublicKeyPEM(t, &rsaKey.PublicKey),
+				"retire_at": time.Now().Add(-time.Hour),
+			},
+		),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := json.Marshal(ks.JWKS())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var jwks struct {
+		Keys []map[string]string `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &jwks); err != nil {
+		t.Fatal(err)
+	}
+	if len(jwks.Keys) != 2 {
+		t.Fatalf("published %d keys, want the EC and RSA keys only: %s", len(jwks.Keys), data)
+	}
+
+	ec, rsaJWK := jwks.Keys[0], jwks.Keys[1]
+	for field, want := range map[string]string{"kty": "EC", "kid": "ec", "alg": AlgorithmES256, "use": "sig", "crv": "P-256"} {
+		if ec[field] != want {
+			t.Errorf("EC %s = %q, want %q", field, ec[field], want)
+		}
+	}
+	for _, field := range []string{"x", "y"} {
+		b, err := base64.RawURLEncoding.DecodeString(ec[field])
+		if err != nil || len(b) != 32 {
+			t.Errorf("EC %s = %q, want 32 bytes of unpadded base64url", field, ec[field])
+		}
+	}
+	if x, _ := base64.RawURLEncoding.DecodeString(ec["x"]); new(big.Int).SetBytes(x).Cmp(ecKey.X) != 0 {
+		t.Error("EC x does not encode the key's x coordinate")
+	}
+
+	for field, want := range map[string]string{"kty": "RSA", "kid": "rsa", "alg": AlgorithmRS256, "use": "sig", "e": "AQAB"} {
+		if rsaJWK[field] != want {
+			t.Errorf("RSA %s = %q, want %q", field, rsaJWK[field], want)
+		}
+	}
+	if n, err := base64.RawURLEncoding.DecodeString(rsaJWK["n"]); err != nil || new(big.Int).SetBytes(n).Cmp(rsaKey.N) != 0 {
+		t.Errorf("RSA n = %q, want the key's modulus", rsaJWK["n"])
+	}
+	if _, found := rsaJWK["d"]; found {
+		t.Error("the private exponent was published")
+	}
+}
+
+func TestJSONWebKeyRoundTrip(t *testing.T) {
+	rsaKey := newTestRSAKey(t)
+	ecKey := newTestECKeyWithShortX(t)
+	ks, err := LoadKeySet(KeyConfig{File: writeKeyFile(t, "", "rsa",
+		map[string]interface{}{"kid": "rsa", "alg": AlgorithmRS256, "private_key_file": writePrivateKeyPEM(t, rsaKey)},
+		map[string]interface{}{"kid": "ec", "alg": AlgorithmES256, "private_key_file": writePrivateKeyPEM(t, ecKey)},
+	)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]interface{ Equal(crypto.PublicKey) bool }{"rsa": &rsaKey.PublicKey, "ec": &ecKey.PublicKey}
+	for _, jwk := range ks.JWKS().Keys {
+		key, err := jwk.Key()
+		if err != nil {
+			t.Fatalf("%s: %v", jwk.KeyID, err)
+		}
+		if !want[jwk.KeyID].Equal(key.PublicKey) {
+			t.Errorf("%s: decoded key differs from the published one", jwk.KeyID)
+		}
+	}
+}
+
+func TestTokensRoundTripWithAsymmetricKeys(t *testing.T) {
+	rsaKey := newTestRSAKey(t)
+	ecKey := newTestECKey(t)
+	tests := []struct {
+		alg        string
+		privateKey crypto.Signer
+	}{
+		{alg: AlgorithmRS256, privateKey: rsaKey},
+		{alg: AlgorithmES256, privateKey: ecKey},
+	}
+	for _, tt := range tests {
+		t.Run(tt.alg, func(t *testing.T) {
+			signingKeys, err := LoadKeySet(KeyConfig{File: writeKeyFile(t, "", "k", map[string]interface{}{
+				"kid": "k", "alg": tt.alg, "private_key_file": writePrivateKeyPEM(t, tt.privateKey),
+			})})
+			if err != nil {
+				t.Fatal(err)
+			}
+			user := User{Username: "dev@example.com", Roles: []string{"customer"}}
+			cfg := TokenConfig{RoleScopes: RoleScopes{"customer": {"orders:read"}}}
+			issuer := NewTokenIssuer(signingKeys, cfg, NewMemoryUserStore(user), NewMemoryRefreshTokenStore(), NewMemoryRevocationList())
+			tokens, err := issuer.GenerateAccessToken(context.Background(), &user)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// A verifier holding only the public key, as a service reading
+			// the JWKS would, accepts the token too.
+			publicKeys := &KeySet{
+				keys:       map[string]*Key{"k": {ID: "k", Algorithm: tt.alg, PublicKey: tt.privateKey.Public()}},
+				algorithms: []string{tt.alg},
+			}
+			for name, keys := range map[string]*KeySet{"signing keys": signingKeys, "public keys": publicKeys} {
+				principal, err := NewTokenVerifier(keys, cfg, NewMemoryRevocationList(), nil).Verify(context.Background(), tokens.Token)
+				if err != nil {
+					t.Fatalf("%s: %v", name, err)
+				}
+				if principal.Subject != user.Username || !principal.HasScope("orders:read") {
+					t.Errorf("%s: principal = %+v", name, principal)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,346 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+const (
+	JWTKeyIDHeader     = "kid"
+	JWTAlgorithmHeader = "alg"
+	MinSecretLength    = 32
+	MinRSAKeyBits      = 2048
+
+	AlgorithmHS256 = "HS256"
+	AlgorithmRS256 = "RS256"
+	AlgorithmES256 = "ES256"
+)
+
+var (
+	SupportedAlgorithms = []string{AlgorithmHS256, AlgorithmRS256, AlgorithmES256}
+
+	ErrNoSigningKey            = errors.New("no JWT signing key configured")
+	ErrMissingKeyID            = errors.New("token has no key id")
+	ErrUnknownKeyID            = errors.New("token signed with an unknown or retired key")
+	ErrUnexpectedSigningMethod = errors.New("unexpected signing method")
+)
+
+// Key signs and verifies tokens with one algorithm. HS256 keys hold a shared
+// Secret; RS256 and ES256 keys hold a PublicKey and, when they are used for
+// signing, a PrivateKey. A key with a RetireAt in the past is no longer
+// accepted for verification.
+type Key struct {
+	ID         string
+	Algorithm  string
+	Secret     []byte
+	PrivateKey crypto.Signer
+	PublicKey  crypto.PublicKey
+	RetireAt   time.Time
+}
+
+func (k *Key) retired(now time.Time) bool {
+	return !k.RetireAt.IsZero() && !now.Before(k.RetireAt)
+}
+
+func (k *Key) signingMethod() jwt.SigningMethod {
+	return jwt.GetSigningMethod(k.Algorithm)
+}
+
+func (k *Key) signingKey() interface{} {
+	if k.Algorithm == AlgorithmHS256 {
+		return k.Secret
+	}
+	return k.PrivateKey
+}
+
+func (k *Key) verificationKey() interface{} {
+	if k.Algorithm == AlgorithmHS256 {
+		return k.Secret
+	}
+	return k.PublicKey
+}
+
+func (k *Key) canSign() bool {
+	if k.Algorithm == AlgorithmHS256 {
+		return len(k.Secret) > 0
+	}
+	return k.PrivateKey != nil
+}
+
+func (k *Key) validate() error {
+	switch k.Algorithm {
+	case AlgorithmHS256:
+		if len(k.Secret) < MinSecretLength {
+			return fmt.Errorf("JWT key %q is shorter than %d bytes", k.ID, MinSecretLength)
+		}
+	case AlgorithmRS256:
+		publicKey, ok := k.PublicKey.(*rsa.PublicKey)
+		if !ok {
+			return fmt.Errorf("JWT key %q: RS256 needs an RSA key", k.ID)
+		}
+		if publicKey.N.BitLen() < MinRSAKeyBits {
+			return fmt.Errorf("JWT key %q: RSA keys must be at least %d bits", k.ID, MinRSAKeyBits)
+		}
+	case AlgorithmES256:
+		publicKey, ok := k.PublicKey.(*ecdsa.PublicKey)
+		if !ok || publicKey.Curve != elliptic.P256() {
+			return fmt.Errorf("JWT key %q: ES256 needs an ECDSA P-256 key", k.ID)
+		}
+	default:
+		return fmt.Errorf("JWT key %q: unsupported algorithm %q", k.ID, k.Algorithm)
+	}
+	return nil
+}
+
+// KeyConfig describes where the signing keys are loaded from. Keys from both
+// sources are merged.
+type KeyConfig struct {
+	// Keys is an inline list of "kid:secret" HS256 keys separated by commas.
+	Keys string
+	// File is the path of a JSON key file, see keyFile.
+	File string
+	// SigningKeyID selects the key new tokens are signed with. It defaults to
+	// the signing_key_id of the key file, then to the first key listed.
+	SigningKeyID string
+	// Algorithms restricts the algorithms accepted for verification. It
+	// defaults to the algorithms of the configured keys.
+	Algorithms []string
+}
+
+type keyFile struct {
+	SigningKeyID string `json:"signing_key_id"`
+	Keys         []struct {
+		ID             string    `json:"kid"`
+		Algorithm      string    `json:"alg"`
+		Secret         string    `json:"secret"`
+		SecretFile     string    `json:"secret_file"`
+		PrivateKeyFile string    `json:"private_key_file"`
+		PublicKeyFile  string    `json:"public_key_file"`
+		RetireAt       time.Time `json:"retire_at"`
+	} `json:"keys"`
+}
+
+// KeySet holds the keys currently in use. New tokens are signed with a single
+// signing key while every key that has not retired is accepted for
+// verification, which lets a new key be rolled out before the old one is
+// removed. The set can be reloaded from its KeyConfig at runtime.
+type KeySet struct {
+	cfg KeyConfig
+
+	mu         sync.RWMutex
+	signing    *Key
+	keys       map[string]*Key
+	algorithms []string
+}
+
+func LoadKeySet(cfg KeyConfig) (*KeySet, error) {
+	ks := &KeySet{cfg: cfg}
+	if err := ks.Reload(); err != nil {
+		return nil, err
+	}
+	return ks, nil
+}
+
+// Reload reads the keys again from the KeyConfig. The current keys are kept
+// if the new ones are invalid.
+func (ks *KeySet) Reload() error {
+	signingKeyID, keys, err := loadKeys(ks.cfg)
+	if err != nil {
+		return err
+	}
+
+	byID := make(map[string]*Key, len(keys))
+	var keyAlgorithms []string
+	for _, key := range keys {
+		if _, exists := byID[key.ID]; exists {
+			return fmt.Errorf("duplicate JWT key id %q", key.ID)
+		}
+		byID[key.ID] = key
+		if !slices.Contains(keyAlgorithms, key.Algorithm) {
+			keyAlgorithms = append(keyAlgorithms, key.Algorithm)
+		}
+	}
+	signing, ok := byID[signingKeyID]
+	if !ok {
+		return fmt.Errorf("%w: key %q not found", ErrNoSigningKey, signingKeyID)
+	}
+	if signing.retired(time.Now()) {
+		return fmt.Errorf("%w: key %q has retired", ErrNoSigningKey, signingKeyID)
+	}
+	if !signing.canSign() {
+		return fmt.Errorf("%w: key %q has no private key", ErrNoSigningKey, signingKeyID)
+	}
+
+	algorithms := ks.cfg.Algorithms
+	if len(algorithms) == 0 {
+		algorithms = keyAlgorithms
+	}
+	for _, alg := range algorithms {
+		if !slices.Contains(SupportedAlgorithms, alg) {
+			return fmt.Errorf("unsupported JWT algorithm %q", alg)
+		}
+	}
+	if !slices.Contains(algorithms, signing.Algorithm) {
+		return fmt.Errorf("signing key %q uses %s which is not in the allowed algorithms", signing.ID, signing.Algorithm)
+	}
+
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+	ks.signing = signing
+	ks.keys = byID
+	ks.algorithms = algorithms
+	return nil
+}
+
+func (ks *KeySet) SigningKey() *Key {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+	return ks.signing
+}
+
+func (ks *KeySet) VerificationKey(kid string) (*Key, error) {
+	ks.mu.RLock()
+	key, ok := ks.keys[kid]
+	ks.mu.RUnlock()
+	if !ok || key.retired(time.Now()) {
+		return nil, ErrUnknownKeyID
+	}
+	return key, nil
+}
+
+// Keyfunc resolves the verification key of a token from its kid header. The
+// token's alg must be allowed and match the algorithm of that key, so a
+// public key can never be used as an HMAC secret.
+func (ks *KeySet) Keyfunc(token *jwt.Token) (interface{}, error) {
+	alg, _ := token.Header[JWTAlgorithmHeader].(string)
+	ks.mu.RLock()
+	allowed := slices.Contains(ks.algorithms, alg)
+	ks.mu.RUnlock()
+	if !allowed {
+		return nil, fmt.Errorf("%w: %v", ErrUnexpectedSigningMethod, alg)
+	}
+
+	kid, _ := token.Header[JWTKeyIDHeader].(string)
+	if kid == "" {
+		return nil, ErrMissingKeyID
+	}
+	key, err := ks.VerificationKey(kid)
+	if err != nil {
+		return nil, err
+	}
+	if key.Algorithm != alg || token.Method.Alg() != alg {
+		return nil, fmt.Errorf("%w: %v", ErrUnexpectedSigningMethod, alg)
+	}
+	return key.verificationKey(), nil
+}
+
+func loadKeys(cfg KeyConfig) (string, []*Key, error) {
+	var keys []*Key
+	for _, pair := range strings.Split(cfg.Keys, ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		kid, secret, found := strings.Cut(strings.TrimSpace(pair), ":")
+		if !found || kid == "" {
+			return "", nil, errors.New("invalid JWT key in JWT_KEYS, expected kid:secret")
+		}
+		keys = append(keys, &Key{ID: kid, Algorithm: AlgorithmHS256, Secret: []byte(secret)})
+	}
+
+	signingKeyID := cfg.SigningKeyID
+	if cfg.File != "" {
+		fileSigningKeyID, fileKeys, err := loadKeyFile(cfg.File)
+		if err != nil {
+			return "", nil, err
+		}
+		keys = append(keys, fileKeys...)
+		if signingKeyID == "" {
+			signingKeyID = fileSigningKeyID
+		}
+	}
+
+	if len(keys) == 0 {
+		return "", nil, ErrNoSigningKey
+	}
+	for _, key := range keys {
+		if err := key.validate(); err != nil {
+			return "", nil, err
+		}
+	}
+	if signingKeyID == "" {
+		signingKeyID = keys[0].ID
+	}
+	return signingKeyID, keys, nil
+}
+
+func loadKeyFile(path string) (string, []*Key, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to read JWT key file: %w", err)
+	}
+	var file keyFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return "", nil, fmt.Errorf("failed to parse JWT key file: %w", err)
+	}
+
+	var keys []*Key
+	for _, entry := range file.Keys {
+		if entry.ID == "" {
+			return "", nil, fmt.Errorf("JWT key file %s: key without kid", path)
+		}
+		key := &Key{ID: entry.ID, Algorithm: entry.Algorithm, RetireAt: entry.RetireAt}
+		if key.Algorithm == "" {
+			key.Algorithm = AlgorithmHS256
+		}
+
+		switch {
+		case entry.SecretFile != "":
+			secret, err := os.ReadFile(entry.SecretFile)
+			if err != nil {
+				return "", nil, fmt.Errorf("failed to read secret of JWT key %q: %w", entry.ID, err)
+			}
+			key.Secret = []byte(strings.TrimSpace(string(secret)))
+		case entry.Secret != "":
+			key.Secret = []byte(entry.Secret)
+		}
+
+		if entry.PrivateKeyFile != "" {
+			key.PrivateKey, err = loadPrivateKey(entry.PrivateKeyFile)
+			if err != nil {
+				return "", nil, fmt.Errorf("JWT key %q: %w", entry.ID, err)
+			}
+			key.PublicKey = key.PrivateKey.Public()
+		}
+		if entry.PublicKeyFile != "" {
+			publicKey, err := loadPublicKey(entry.PublicKeyFile)
+			if err != nil {
+				return "", nil, fmt.Errorf("JWT key %q: %w", entry.ID, err)
+			}
+			// A mismatched pair would sign tokens nothing can verify and
+			// publish the wrong key in the JWKS.
+			if key.PrivateKey != nil && !publicKeysEqual(key.PublicKey, publicKey) {
+				return "", nil, fmt.Errorf("JWT key %q: public key does not match the private key", entry.ID)
+			}
+			key.PublicKey = publicKey
+		}
+		keys = append(keys, key)
+	}
+	return file.SigningKeyID, keys, nil
+}
+
+func publicKeysEqual(a, b crypto.PublicKey) bool {
+	key, ok := a.(interface{ Equal(crypto.PublicKey) bool })
+	return ok && key.Equal(b)
+}
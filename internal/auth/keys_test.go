@@ -0,0 +1,286 @@
+package auth
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+var (
+	testSecretA = strings.Repeat("a", MinSecretLength)
+	testSecretB = strings.Repeat("b", MinSecretLength)
+)
+
+func newTestRSAKey(t *testing.T) *rsa.PrivateKey {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, MinRSAKeyBits)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func newTestECKey(t *testing.T) *ecdsa.PrivateKey {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+// writePrivateKeyPEM writes key as PKCS#8 and returns the path.
+func writePrivateKeyPEM(t *testing.T, key interface{}) string {
+	t.Helper()
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return writePEM(t, "PRIVATE KEY", der)
+}
+
+// writePublicKeyPEM writes key as PKIX and returns the path.
+func writePublicKeyPEM(t *testing.T, key interface{}) string {
+	t.Helper()
+	der, err := x509.MarshalPKIXPublicKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return writePEM(t, "PUBLIC KEY", der)
+}
+
+func writePEM(t *testing.T, blockType string, der []byte) string {
+	t.Helper()
+	file, err := os.CreateTemp(t.TempDir(), "*.pem")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	if err := pem.Encode(file, &pem.Block{Type: blockType, Bytes: der}); err != nil {
+		t.Fatal(err)
+	}
+	return file.Name()
+}
+
+// writeKeyFile writes a JWT key file with the given keys and returns its path.
+func writeKeyFile(t *testing.T, path, signingKeyID string, keys ...map[string]interface{}) string {
+	t.Helper()
+	if path == "" {
+		path = filepath.Join(t.TempDir(), "keys.json")
+	}
+	data, err := json.Marshal(map[string]interface{}{"signing_key_id": signingKeyID, "keys": keys})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// signTestToken signs claims with method and key, naming kid in the header
+// unless it is empty.
+func signTestToken(t *testing.T, method jwt.SigningMethod, kid string, key interface{}, claims jwt.MapClaims) string {
+	t.Helper()
+	if claims == nil {
+		claims = jwt.MapClaims{ClaimSubject: "dev@example.com"}
+	}
+	token := jwt.NewWithClaims(method, claims)
+	if kid != "" {
+		token.Header[JWTKeyIDHeader] = kid
+	}
+	signed, err := token.SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed
+}
+
+// parseWithKeySet verifies the signature of token with ks and returns the
+// error behind jwt-go's ValidationError.
+func parseWithKeySet(ks *KeySet, token string) error {
+	_, err := (&jwt.Parser{SkipClaimsValidation: true}).Parse(token, ks.Keyfunc)
+	var validationErr *jwt.ValidationError
+	if errors.As(err, &validationErr) && validationErr.Inner != nil {
+		return validationErr.Inner
+	}
+	return err
+}
+
+func TestKeySetKeyfunc(t *testing.T) {
+	rsaKey := newTestRSAKey(t)
+	ks, err := LoadKeySet(KeyConfig{
+		Keys: "a:" + testSecretA + ",b:" + testSecretB,
+		File: writeKeyFile(t, "", "", map[string]interface{}{
+			"kid": "rsa", "alg": AlgorithmRS256, "private_key_file": writePrivateKeyPEM(t, rsaKey),
+		}),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsaPublicPEM, err := os.ReadFile(writePublicKeyPEM(t, &rsaKey.PublicKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		token   string
+		wantErr error
+	}{
+		{name: "HS256 key", token: signTestToken(t, jwt.SigningMethodHS256, "b", []byte(testSecretB), nil)},
+		{name: "RS256 key", token: signTestToken(t, jwt.SigningMethodRS256, "rsa", rsaKey, nil)},
+		{name: "unknown kid", token: signTestToken(t, jwt.SigningMethodHS256, "c", []byte(testSecretA), nil), wantErr: ErrUnknownKeyID},
+		{name: "no kid with several keys", token: signTestToken(t, jwt.SigningMethodHS256, "", []byte(testSecretA), nil), wantErr: ErrMissingKeyID},
+		{
+			name:    "HS256 signed with the RSA public key",
+			token:   signTestToken(t, jwt.SigningMethodHS256, "rsa", rsaPublicPEM, nil),
+			wantErr: ErrUnexpectedSigningMethod,
+		},
+		{
+			name:    "RS256 naming an HS256 key",
+			token:   signTestToken(t, jwt.SigningMethodRS256, "a", rsaKey, nil),
+			wantErr: ErrUnexpectedSigningMethod,
+		},
+		{
+			name:    "algorithm not allowed",
+			token:   signTestToken(t, jwt.SigningMethodES256, "rsa", newTestECKey(t), nil),
+			wantErr: ErrUnexpectedSigningMethod,
+		},
+		{
+			name:    "alg none",
+			token:   signTestToken(t, jwt.SigningMethodNone, "a", jwt.UnsafeAllowNoneSignatureType, nil),
+			wantErr: ErrUnexpectedSigningMethod,
+		},
+		{
+			name:    "signed with another secret",
+			token:   signTestToken(t, jwt.SigningMethodHS256, "a", []byte(testSecretB), nil),
+			wantErr: jwt.ErrSignatureInvalid,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := parseWithKeySet(ks, tt.token); !errors.Is(err, tt.wantErr) {
+				t.Errorf("err = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestKeySetAlgorithmsRestrictVerification(t *testing.T) {
+	rsaKey := newTestRSAKey(t)
+	ks, err := LoadKeySet(KeyConfig{
+		Keys: "a:" + testSecretA,
+		File: writeKeyFile(t, "", "", map[string]interface{}{
+			"kid": "rsa", "alg": AlgorithmRS256, "private_key_file": writePrivateKeyPEM(t, rsaKey),
+		}),
+		Algorithms: []string{AlgorithmHS256},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	token := signTestToken(t, jwt.SigningMethodRS256, "rsa", rsaKey, nil)
+	if err := parseWithKeySet(ks, token); !errors.Is(err, ErrUnexpectedSigningMethod) {
+		t.Errorf("err = %v, want %v", err, ErrUnexpectedSigningMethod)
+	}
+}
+
+func TestKeySetRetiredKeys(t *testing.T) {
+	now := time.Now()
+	ks, err := LoadKeySet(KeyConfig{File: writeKeyFile(t, "", "new",
+		map[string]interface{}{"kid": "new", "secret": testSecretA},
+		map[string]interface{}{"kid": "retiring", "secret": testSecretB, "retire_at": now.Add(time.Hour)},
+		map[string]interface{}{"kid": "retired", "secret": testSecretB, "retire_at": now.Add(-time.Hour)},
+	)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		kid     string
+		wantErr error
+	}{
+		{kid: "new"},
+		{kid: "retiring"},
+		{kid: "retired", wantErr: ErrUnknownKeyID},
+	}
+	for _, tt := range tests {
+		t.Run(tt.kid, func(t *testing.T) {
+			key := ks.keys[tt.kid]
+			token := signTestToken(t, jwt.SigningMethodHS256, tt.kid, key.Secret, nil)
+			if err := parseWithKeySet(ks, token); !errors.Is(err, tt.wantErr) {
+				t.Errorf("err = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+	if ks.SigningKey().ID != "new" {
+		t.Errorf("signing key = %q, want new", ks.SigningKey().ID)
+	}
+}
+
+func TestKeySetRejectsRetiredSigningKey(t *testing.T) {
+	_, err := LoadKeySet(KeyConfig{File: writeKeyFile(t, "", "old",
+		map[string]interface{}{"kid": "old", "secret": testSecretA, "retire_at": time.Now().Add(-time.Minute)},
+	)})
+	if !errors.Is(err, ErrNoSigningKey) {
+		t.Fatalf("err = %v, want %v", err, ErrNoSigningKey)
+	}
+}
+
+func TestKeySetReload(t *testing.T) {
+	path := writeKeyFile(t, "", "one", map[string]interface{}{"kid": "one", "secret": testSecretA})
+	ks, err := LoadKeySet(KeyConfig{File: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A rotation adds the new key and signs with it, while tokens of the old
+	// key keep verifying.
+	writeKeyFile(t, path, "two",
+		map[string]interface{}{"kid": "one", "secret": testSecretA},
+		map[string]interface{}{"kid": "two", "secret": testSecretB},
+	)
+	if err := ks.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if ks.SigningKey().ID != "two" {
+		t.Errorf("signing key = %q after the reload, want two", ks.SigningKey().ID)
+	}
+	if err := parseWithKeySet(ks, signTestToken(t, jwt.SigningMethodHS256, "one", []byte(testSecretA), nil)); err != nil {
+		t.Errorf("token of the previous key: %v", err)
+	}
+
+	tests := map[string][]map[string]interface{}{
+		"short secret":  {{"kid": "two", "secret": "short"}},
+		"duplicate kid": {{"kid": "two", "secret": testSecretB}, {"kid": "two", "secret": testSecretA}},
+		"no kid":        {{"secret": testSecretB}},
+		"unknown alg":   {{"kid": "two", "alg": "HS512", "secret": testSecretB}},
+	}
+	for name, keys := range tests {
+		t.Run(name, func(t *testing.T) {
+			writeKeyFile(t, path, "two", keys...)
+			if err := ks.Reload(); err == nil {
+				t.Fatal("Reload accepted an invalid key file")
+			}
+			if ks.SigningKey().ID != "two" || ks.SigningKey().Algorithm != AlgorithmHS256 {
+				t.Errorf("signing key = %+v, want the previous keys kept", ks.SigningKey())
+			}
+			if err := parseWithKeySet(ks, signTestToken(t, jwt.SigningMethodHS256, "one", []byte(testSecretA), nil)); err != nil {
+				t.Errorf("token of a previously loaded key: %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,391 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+const (
+	DefaultOIDCRefreshInterval = 15 * time.Minute
+	DefaultOIDCSubjectClaim    = "sub"
+	OIDCDiscoveryPath          = "/.well-known/openid-configuration"
+	// OIDCSubjectPrefix starts the subject of callers authenticated by an
+	// OIDC provider, followed by the issuer, "#" and the subject claim, so
+	// two issuers can never act as the same user.
+	OIDCSubjectPrefix = "oidc:"
+
+	oidcEmailClaim         = "email"
+	oidcEmailVerifiedClaim = "email_verified"
+
+	// oidcMinRefreshInterval limits refreshes triggered by tokens signed with
+	// an unknown key, so garbage tokens cannot hammer the identity provider.
+	oidcMinRefreshInterval = time.Minute
+	oidcRetryInterval      = 30 * time.Second
+	oidcFetchTimeout       = 10 * time.Second
+	oidcMaxResponseBytes   = 1 << 20
+)
+
+var (
+	ErrOIDCUnavailable      = errors.New("identity provider keys are unavailable")
+	ErrOIDCEmailNotVerified = errors.New("token email is not verified")
+)
+
+// OIDCConfig describes an external OpenID Connect issuer whose ID or access
+// tokens are accepted next to the gateway's own tokens.
+type OIDCConfig struct {
+	// Issuer must match the iss claim of its tokens and the issuer in its
+	// discovery document.
+	Issuer string
+	// DiscoveryURL defaults to Issuer + "/.well-known/openid-configuration".
+	DiscoveryURL string
+	// Audience is required in the aud claim, usually the client id of the
+	// gateway at the identity provider.
+	Audience string
+	// SubjectClaim names the claim used as the caller's subject. It defaults
+	// to "sub".
+	SubjectClaim string
+	// MergeLocalUsers uses the email claim as the subject as is, so external
+	// users act as the local user with the same username. The provider must
+	// mark the email as verified. It requires SubjectClaim to be "email".
+	MergeLocalUsers bool
+	// RolesClaim is the dotted path of the claim listing the caller's roles or
+	// groups at the identity provider, e.g. "realm_access.roles".
+	RolesClaim string
+	// RoleMapping maps external roles onto the gateway's roles. External roles
+	// without a mapping grant nothing.
+	RoleMapping map[string][]string
+	// RefreshInterval is how often the discovery document and keys are
+	// fetched again.
+	RefreshInterval time.Duration
+}
+
+// LoadOIDCConfigs reads issuers from a JSON file of the form
+//
+//	{
+//	  "providers": [{
+//	    "issuer": "https://idp.example.com/realms/corp",
+//	    "audience": "oms-gateway",
+//	    "subject_claim": "email",
+//	    "merge_local_users": true,
+//	    "roles_claim": "realm_access.roles",
+//	    "role_mapping": {"oms-admins": ["admin"], "staff": ["customer"]},
+//	    "refresh_interval": "15m"
+//	  }]
+//	}
+func LoadOIDCConfigs(path string) ([]OIDCConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read OIDC providers file: %w", err)
+	}
+	var file struct {
+		Providers []struct {
+			Issuer          string              `json:"issuer"`
+			DiscoveryURL    string              `json:"discovery_url"`
+			Audience        string              `json:"audience"`
+			SubjectClaim    string              `json:"subject_claim"`
+			MergeLocalUsers bool                `json:"merge_local_users"`
+			RolesClaim      string              `json:"roles_claim"`
+			RoleMapping     map[string][]string `json:"role_mapping"`
+			RefreshInterval string              `json:"refresh_interval"`
+		} `json:"providers"`
+	}
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse OIDC providers file: %w", err)
+	}
+
+	var configs []OIDCConfig
+	for _, provider := range file.Providers {
+		if provider.Issuer == "" || provider.Audience == "" {
+			return nil, fmt.Errorf("OIDC providers file %s: every provider needs an issuer and an audience", path)
+		}
+		if provider.MergeLocalUsers && provider.SubjectClaim != oidcEmailClaim {
+			return nil, fmt.Errorf("OIDC provider %s: merge_local_users requires subject_claim %q", provider.Issuer, oidcEmailClaim)
+		}
+		cfg := OIDCConfig{
+			Issuer:          provider.Issuer,
+			DiscoveryURL:    provider.DiscoveryURL,
+			Audience:        provider.Audience,
+			SubjectClaim:    provider.SubjectClaim,
+			MergeLocalUsers: provider.MergeLocalUsers,
+			RolesClaim:      provider.RolesClaim,
+			RoleMapping:     provider.RoleMapping,
+		}
+		if provider.RefreshInterval != "" {
+			cfg.RefreshInterval, err = time.ParseDuration(provider.RefreshInterval)
+			if err != nil {
+				return nil, fmt.Errorf("OIDC provider %s: invalid refresh_interval: %w", provider.Issuer, err)
+			}
+		}
+		configs = append(configs, cfg)
+	}
+	return configs, nil
+}
+
+func (cfg OIDCConfig) withDefaults() OIDCConfig {
+	if cfg.DiscoveryURL == "" {
+		cfg.DiscoveryURL = strings.TrimSuffix(cfg.Issuer, "/") + OIDCDiscoveryPath
+	}
+	if cfg.SubjectClaim == "" {
+		cfg.SubjectClaim = DefaultOIDCSubjectClaim
+	}
+	if cfg.RefreshInterval <= 0 {
+		cfg.RefreshInterval = DefaultOIDCRefreshInterval
+	}
+	return cfg
+}
+
+// OIDCProvider caches the signing keys of an OIDC issuer. Run refreshes them
+// in the background; a token signed with a key that is not cached yet also
+// triggers a refresh, at most once a minute.
+type OIDCProvider struct {
+	cfg    OIDCConfig
+	client *http.Client
+	logger *slog.Logger
+
+	refreshMu sync.Mutex
+
+	mu          sync.RWMutex
+	keys        map[string]*Key
+	lastRefresh time.Time
+	lastErr     error
+}
+
+// NewOIDCProvider returns a provider fetching keys with client and logging
+// failed refreshes to logger. Either may be nil for a default.
+func NewOIDCProvider(cfg OIDCConfig, client *http.Client, logger *slog.Logger) *OIDCProvider {
+	if client == nil {
+		client = &http.Client{Timeout: oidcFetchTimeout}
+	}
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return &OIDCProvider{cfg: cfg.withDefaults(), client: client, logger: logger}
+}
+
+func (p *OIDCProvider) Issuer() string {
+	return p.cfg.Issuer
+}
+
+// Run refreshes the keys until ctx is done, retrying sooner after a failure.
+func (p *OIDCProvider) Run(ctx context.Context) {
+	for {
+		wait := p.cfg.RefreshInterval
+		if err := p.Refresh(ctx); err != nil {
+			p.logger.ErrorContext(ctx, "failed to refresh OIDC keys", "issuer", p.cfg.Issuer, "err", err)
+			wait = min(wait, oidcRetryInterval)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+	}
+}
+
+// Refresh fetches the discovery document and the JWKS it points to. The
+// cached keys are kept when either cannot be fetched or parsed.
+func (p *OIDCProvider) Refresh(ctx context.Context) error {
+	p.refreshMu.Lock()
+	defer p.refreshMu.Unlock()
+
+	keys, err := p.fetchKeys(ctx)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.lastRefresh = time.Now()
+	p.lastErr = err
+	if err != nil {
+		return err
+	}
+	p.keys = keys
+	return nil
+}
+
+func (p *OIDCProvider) fetchKeys(ctx context.Context) (map[string]*Key, error) {
+	var discovery struct {
+		Issuer  string `json:"issuer"`
+		JWKSURI string `json:"jwks_uri"`
+	}
+	if err := p.getJSON(ctx, p.cfg.DiscoveryURL, &discovery); err != nil {
+		return nil, fmt.Errorf("discovery: %w", err)
+	}
+	if discovery.Issuer != p.cfg.Issuer {
+		return nil, fmt.Errorf("discovery: issuer %q does not match %q", discovery.Issuer, p.cfg.Issuer)
+	}
+	if discovery.JWKSURI == "" {
+		return nil, errors.New("discovery: no jwks_uri")
+	}
+
+	var jwks JSONWebKeySet
+	if err := p.getJSON(ctx, discovery.JWKSURI, &jwks); err != nil {
+		return nil, fmt.Errorf("jwks: %w", err)
+	}
+	keys := make(map[string]*Key, len(jwks.Keys))
+	for _, jwk := range jwks.Keys {
+		key, err := jwk.Key()
+		if err != nil {
+			// Identity providers often publish keys for other algorithms or for
+			// encryption next to the ones they sign with.
+			continue
+		}
+		keys[key.ID] = key
+	}
+	if len(keys) == 0 {
+		return nil, errors.New("jwks: no usable RS256 or ES256 signing keys")
+	}
+	return keys, nil
+}
+
+func (p *OIDCProvider) getJSON(ctx context.Context, url string, v interface{}) error {
+	ctx, cancel := context.WithTimeout(ctx, oidcFetchTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s: %s", url, resp.Status)
+	}
+	return json.NewDecoder(io.LimitReader(resp.Body, oidcMaxResponseBytes)).Decode(v)
+}
+
+// Keyfunc resolves the verification key of a token like KeySet.Keyfunc, but
+// only for the asymmetric algorithms an identity provider publishes.
+func (p *OIDCProvider) Keyfunc(token *jwt.Token) (interface{}, error) {
+	alg, _ := token.Header[JWTAlgorithmHeader].(string)
+	kid, _ := token.Header[JWTKeyIDHeader].(string)
+	if kid == "" {
+		return nil, ErrMissingKeyID
+	}
+
+	key, err := p.key(kid)
+	if err != nil {
+		return nil, err
+	}
+	if key.Algorithm != alg || token.Method.Alg() != alg {
+		return nil, fmt.Errorf("%w: %v", ErrUnexpectedSigningMethod, alg)
+	}
+	return key.verificationKey(), nil
+}
+
+func (p *OIDCProvider) key(kid string) (*Key, error) {
+	p.mu.RLock()
+	key, ok := p.keys[kid]
+	stale := time.Since(p.lastRefresh) >= oidcMinRefreshInterval
+	p.mu.RUnlock()
+	if ok {
+		return key, nil
+	}
+
+	if stale {
+		ctx, cancel := context.WithTimeout(context.Background(), oidcFetchTimeout)
+		defer cancel()
+		if err := p.Refresh(ctx); err != nil {
+			p.logger.ErrorContext(ctx, "failed to refresh OIDC keys", "issuer", p.cfg.Issuer, "kid", kid, "err", err)
+		}
+	}
+
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if key, ok := p.keys[kid]; ok {
+		return key, nil
+	}
+	if len(p.keys) == 0 {
+		return nil, fmt.Errorf("%w: %v", ErrOIDCUnavailable, p.lastErr)
+	}
+	return nil, ErrUnknownKeyID
+}
+
+// principal maps the claims of a verified token onto a caller. Only the roles
+// named in RoleMapping carry over; scopes are derived from the mapped roles.
+func (p *OIDCProvider) principal(claims jwt.MapClaims, roleScopes RoleScopes) (*Principal, error) {
+	subject, _ := claims[p.cfg.SubjectClaim].(string)
+	if subject == "" {
+		return nil, fmt.Errorf("%w: missing %s claim", ErrInvalidToken, p.cfg.SubjectClaim)
+	}
+	if p.cfg.MergeLocalUsers {
+		if !emailVerified(claims) {
+			return nil, ErrOIDCEmailNotVerified
+		}
+	} else {
+		subject = OIDCSubjectPrefix + p.cfg.Issuer + "#" + subject
+	}
+
+	var roles []string
+	for _, externalRole := range externalRoles(claims, p.cfg.RolesClaim) {
+		for _, role := range p.cfg.RoleMapping[externalRole] {
+			if !slices.Contains(roles, role) {
+				roles = append(roles, role)
+			}
+		}
+	}
+	slices.Sort(roles)
+
+	principal := principalFromClaims(claims)
+	principal.Subject = subject
+	principal.Roles = roles
+	principal.Scopes = roleScopes.Expand(roles, nil)
+	return principal, nil
+}
+
+// emailVerified accepts email_verified as a boolean or, as some providers
+// send it, as a string.
+func emailVerified(claims jwt.MapClaims) bool {
+	switch v := claims[oidcEmailVerifiedClaim].(type) {
+	case bool:
+		return v
+	case string:
+		return v == "true"
+	}
+	return false
+}
+
+// externalRoles reads the claim at a dotted path, accepting either a list of
+// strings or a space separated string.
+func externalRoles(claims jwt.MapClaims, path string) []string {
+	if path == "" {
+		return nil
+	}
+	var value interface{} = map[string]interface{}(claims)
+	for _, name := range strings.Split(path, ".") {
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		value = object[name]
+	}
+
+	switch v := value.(type) {
+	case string:
+		return strings.Fields(v)
+	case []interface{}:
+		var roles []string
+		for _, role := range v {
+			if s, ok := role.(string); ok {
+				roles = append(roles, s)
+			}
+		}
+		return roles
+	}
+	return nil
+}
@@ -0,0 +1,230 @@
+package auth
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+// testIdentityProvider serves a discovery document and the JWKS of its
+// current keys.
+type testIdentityProvider struct {
+	*httptest.Server
+	issuer string
+
+	mu              sync.Mutex
+	keys            map[string]*Key
+	discoveryIssuer string
+}
+
+func newTestIdentityProvider(t *testing.T) *testIdentityProvider {
+	t.Helper()
+	idp := &testIdentityProvider{}
+	mux := http.NewServeMux()
+	mux.HandleFunc(OIDCDiscoveryPath, func(w http.ResponseWriter, r *http.Request) {
+		idp.mu.Lock()
+		discovery := map[string]string{"issuer": idp.discoveryIssuer, "jwks_uri": idp.URL + "/jwks"}
+		idp.mu.Unlock()
+		json.NewEncoder(w).Encode(discovery)
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		idp.mu.Lock()
+		jwks := (&KeySet{keys: idp.keys}).JWKS()
+		idp.mu.Unlock()
+		json.NewEncoder(w).Encode(jwks)
+	})
+	idp.Server = httptest.NewServer(mux)
+	idp.issuer = idp.URL
+	idp.discoveryIssuer = idp.URL
+	t.Cleanup(idp.Close)
+	idp.rotateKey(t, "idp-1")
+	return idp
+}
+
+// rotateKey replaces the published keys with a new key named kid.
+func (idp *testIdentityProvider) rotateKey(t *testing.T, kid string) {
+	t.Helper()
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	idp.mu.Lock()
+	defer idp.mu.Unlock()
+	idp.keys = map[string]*Key{kid: {ID: kid, Algorithm: AlgorithmES256, PrivateKey: privateKey, PublicKey: &privateKey.PublicKey}}
+}
+
+// sign issues a token with the current key, for the audience "oms-gateway"
+// unless claims say otherwise.
+func (idp *testIdentityProvider) sign(t *testing.T, claims jwt.MapClaims) string {
+	t.Helper()
+	idp.mu.Lock()
+	var key *Key
+	for _, k := range idp.keys {
+		key = k
+	}
+	idp.mu.Unlock()
+
+	now := time.Now()
+	all := jwt.MapClaims{
+		ClaimIssuer:    idp.issuer,
+		ClaimAudience:  "oms-gateway",
+		ClaimIssuedAt:  now.Unix(),
+		ClaimExpiresAt: now.Add(time.Hour).Unix(),
+	}
+	for name, value := range claims {
+		all[name] = value
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodES256, all)
+	token.Header[JWTKeyIDHeader] = key.ID
+	signed, err := token.SignedString(key.PrivateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed
+}
+
+func newTestOIDCVerifier(t *testing.T, cfg OIDCConfig) (*TokenVerifier, *OIDCProvider) {
+	t.Helper()
+	keys, err := LoadKeySet(KeyConfig{Keys: "test:" + strings.Repeat("s", MinSecretLength)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.Audience = "oms-gateway"
+	provider := NewOIDCProvider(cfg, nil, nil)
+	tokenConfig := TokenConfig{RoleScopes: RoleScopes{"customer": {"orders:read", "products:read"}}}
+	return NewTokenVerifier(keys, tokenConfig, NewMemoryRevocationList(), []*OIDCProvider{provider}), provider
+}
+
+func TestOIDCTokenSubjectIsNamespacedByIssuer(t *testing.T) {
+	idp := newTestIdentityProvider(t)
+	verifier, _ := newTestOIDCVerifier(t, OIDCConfig{
+		Issuer:      idp.issuer,
+		RolesClaim:  "realm_access.roles",
+		RoleMapping: map[string][]string{"staff": {"customer"}},
+	})
+
+	token := idp.sign(t, jwt.MapClaims{
+		"sub":          "dev@example.com",
+		"realm_access": map[string]interface{}{"roles": []string{"staff", "unmapped"}},
+	})
+	principal, err := verifier.Verify(context.Background(), token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := OIDCSubjectPrefix + idp.issuer + "#dev@example.com"; principal.Subject != want {
+		t.Errorf("subject = %q, want %q", principal.Subject, want)
+	}
+	if !slices.Equal(principal.Roles, []string{"customer"}) {
+		t.Errorf("roles = %v, want [customer]", principal.Roles)
+	}
+	if !slices.Equal(principal.Scopes, []string{"orders:read", "products:read"}) {
+		t.Errorf("scopes = %v, want the scopes of customer", principal.Scopes)
+	}
+}
+
+func TestOIDCMergeLocalUsersRequiresVerifiedEmail(t *testing.T) {
+	idp := newTestIdentityProvider(t)
+	verifier, _ := newTestOIDCVerifier(t, OIDCConfig{Issuer: idp.issuer, SubjectClaim: "email", MergeLocalUsers: true})
+
+	tests := []struct {
+		name     string
+		verified interface{}
+		wantErr  error
+	}{
+		{name: "verified", verified: true},
+		{name: "verified as a string", verified: "true"},
+		{name: "not verified", verified: false, wantErr: ErrOIDCEmailNotVerified},
+		{name: "no email_verified claim", wantErr: ErrOIDCEmailNotVerified},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims := jwt.MapClaims{"sub": "1234", "email": "dev@example.com"}
+			if tt.verified != nil {
+				claims["email_verified"] = tt.verified
+			}
+			principal, err := verifier.Verify(context.Background(), idp.sign(t, claims))
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && principal.Subject != "dev@example.com" {
+				t.Errorf("subject = %q, want the local username", principal.Subject)
+			}
+		})
+	}
+}
+
+func TestOIDCRejectsTokenOfAnotherAudience(t *testing.T) {
+	idp := newTestIdentityProvider(t)
+	verifier, _ := newTestOIDCVerifier(t, OIDCConfig{Issuer: idp.issuer})
+
+	_, err := verifier.Verify(context.Background(), idp.sign(t, jwt.MapClaims{"sub": "1234", ClaimAudience: "other"}))
+	if !errors.Is(err, ErrInvalidAudience) {
+		t.Fatalf("err = %v, want %v", err, ErrInvalidAudience)
+	}
+}
+
+func TestOIDCProviderFetchesRotatedKeys(t *testing.T) {
+	idp := newTestIdentityProvider(t)
+	verifier, provider := newTestOIDCVerifier(t, OIDCConfig{Issuer: idp.issuer})
+	ctx := context.Background()
+	if err := provider.Refresh(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	idp.rotateKey(t, "idp-2")
+	token := idp.sign(t, jwt.MapClaims{"sub": "1234"})
+
+	// Keys were just fetched, so an unknown kid does not refresh them yet.
+	if _, err := verifier.Verify(ctx, token); !errors.Is(err, ErrUnknownKeyID) {
+		t.Fatalf("err = %v, want %v", err, ErrUnknownKeyID)
+	}
+
+	provider.mu.Lock()
+	provider.lastRefresh = time.Now().Add(-oidcMinRefreshInterval)
+	provider.mu.Unlock()
+	if _, err := verifier.Verify(ctx, token); err != nil {
+		t.Fatalf("after the refresh interval: %v", err)
+	}
+}
+
+func TestOIDCProviderRejectsMismatchedIssuer(t *testing.T) {
+	idp := newTestIdentityProvider(t)
+	verifier, provider := newTestOIDCVerifier(t, OIDCConfig{Issuer: idp.issuer})
+	token := idp.sign(t, jwt.MapClaims{"sub": "1234"})
+	idp.mu.Lock()
+	idp.discoveryIssuer = "https://evil.example.com"
+	idp.mu.Unlock()
+
+	if err := provider.Refresh(context.Background()); err == nil {
+		t.Fatal("Refresh accepted a discovery document of another issuer")
+	}
+	if _, err := verifier.Verify(context.Background(), token); !errors.Is(err, ErrOIDCUnavailable) {
+		t.Fatalf("err = %v, want %v", err, ErrOIDCUnavailable)
+	}
+}
+
+func TestLoadOIDCConfigsMergeLocalUsersRequiresEmail(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "oidc.json")
+	data := `{"providers": [{"issuer": "https://idp.example.com", "audience": "oms-gateway", "merge_local_users": true}]}`
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := LoadOIDCConfigs(path); err == nil {
+		t.Fatal("merge_local_users was accepted with the default subject claim")
+	}
+}
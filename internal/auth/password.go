@@ -0,0 +1,117 @@
+package auth
+
+import (
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var ErrPasswordMismatch = errors.New("password does not match")
+
+// dummyPasswordHash is compared against when a user does not exist so that
+// unknown and known users take about the same time to reject.
+var dummyPasswordHash = "$2a$10$dWkZaOpc.4mFWe2h0EUM0ODHQmWNcpRvMi8VArwHDECO0ohH0Tw7u"
+
+func isBcryptHash(hash string) bool {
+	return strings.HasPrefix(hash, "$2a$") || strings.HasPrefix(hash, "$2b$") || strings.HasPrefix(hash, "$2y$")
+}
+
+// comparePassword checks password against a bcrypt hash or an argon2id hash
+// encoded as $argon2id$v=19$m=<memory>,t=<iterations>,p=<threads>$<salt>$<key>.
+func comparePassword(hash, password string) error {
+	if isBcryptHash(hash) {
+		if err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)); err != nil {
+			return ErrPasswordMismatch
+		}
+		return nil
+	}
+	if strings.HasPrefix(hash, "$argon2id$") {
+		return compareArgon2id(hash, password)
+	}
+	return fmt.Errorf("unsupported password hash")
+}
+
+// Bounds of the argon2id parameters accepted from a users file. The upper
+// bound on memory keeps a bad hash from exhausting the gateway on every login.
+const (
+	maxArgon2idMemoryKiB = 1 << 20
+	minArgon2idSaltLen   = 8
+	minArgon2idKeyLen    = 16
+)
+
+type argon2idHash struct {
+	memory     uint32
+	iterations uint32
+	threads    uint8
+	salt       []byte
+	key        []byte
+}
+
+// validatePasswordHash reports why hash cannot be used to check passwords.
+func validatePasswordHash(hash string) error {
+	if isBcryptHash(hash) {
+		if _, err := bcrypt.Cost([]byte(hash)); err != nil {
+			return fmt.Errorf("malformed bcrypt hash: %w", err)
+		}
+		return nil
+	}
+	if strings.HasPrefix(hash, "$argon2id$") {
+		_, err := parseArgon2idHash(hash)
+		return err
+	}
+	return errors.New("unsupported password hash")
+}
+
+func parseArgon2idHash(hash string) (*argon2idHash, error) {
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 {
+		return nil, errors.New("malformed argon2id hash")
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return nil, errors.New("unsupported argon2id version")
+	}
+	h := &argon2idHash{}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &h.memory, &h.iterations, &h.threads); err != nil {
+		return nil, errors.New("malformed argon2id parameters")
+	}
+	if h.iterations < 1 || h.threads < 1 {
+		return nil, errors.New("argon2id t and p must be at least 1")
+	}
+	if h.memory > maxArgon2idMemoryKiB {
+		return nil, fmt.Errorf("argon2id m must be at most %d KiB", maxArgon2idMemoryKiB)
+	}
+
+	var err error
+	if h.salt, err = base64.RawStdEncoding.DecodeString(parts[4]); err != nil {
+		return nil, errors.New("malformed argon2id salt")
+	}
+	if len(h.salt) < minArgon2idSaltLen {
+		return nil, fmt.Errorf("argon2id salt must be at least %d bytes", minArgon2idSaltLen)
+	}
+	if h.key, err = base64.RawStdEncoding.DecodeString(parts[5]); err != nil {
+		return nil, errors.New("malformed argon2id key")
+	}
+	if len(h.key) < minArgon2idKeyLen {
+		return nil, fmt.Errorf("argon2id key must be at least %d bytes", minArgon2idKeyLen)
+	}
+	return h, nil
+}
+
+func compareArgon2id(hash, password string) error {
+	h, err := parseArgon2idHash(hash)
+	if err != nil {
+		return err
+	}
+	derived := argon2.IDKey([]byte(password), h.salt, h.iterations, h.memory, h.threads, uint32(len(h.key)))
+	if subtle.ConstantTimeCompare(derived, h.key) != 1 {
+		return ErrPasswordMismatch
+	}
+	return nil
+}
@@ -0,0 +1,119 @@
+package auth
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// testArgon2idHash encodes an argon2id hash of password with cheap parameters.
+func testArgon2idHash(password string) string {
+	salt := []byte("0123456789abcdef")
+	key := argon2.IDKey([]byte(password), salt, 1, 64, 1, 32)
+	return fmt.Sprintf("$argon2id$v=%d$m=64,t=1,p=1$%s$%s", argon2.Version,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key))
+}
+
+func TestComparePassword(t *testing.T) {
+	bcryptHash, err := bcrypt.GenerateFromPassword([]byte("password"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, hash := range map[string]string{"bcrypt": string(bcryptHash), "argon2id": testArgon2idHash("password")} {
+		t.Run(name, func(t *testing.T) {
+			if err := comparePassword(hash, "password"); err != nil {
+				t.Errorf("right password: %v", err)
+			}
+			if err := comparePassword(hash, "wrong"); !errors.Is(err, ErrPasswordMismatch) {
+				t.Errorf("wrong password: err = %v, want %v", err, ErrPasswordMismatch)
+			}
+		})
+	}
+}
+
+func TestValidatePasswordHash(t *testing.T) {
+	salt := base64.RawStdEncoding.EncodeToString([]byte("0123456789abcdef"))
+	key := base64.RawStdEncoding.EncodeToString(make([]byte, 32))
+	argon2id := func(params, salt, key string) string {
+		return fmt.Sprintf("$argon2id$v=%d$%s$%s$%s", argon2.Version, params, salt, key)
+	}
+
+	tests := []struct {
+		name    string
+		hash    string
+		wantErr string
+	}{
+		{name: "valid argon2id", hash: testArgon2idHash("password")},
+		{name: "valid bcrypt", hash: dummyPasswordHash},
+		{name: "unsupported scheme", hash: "$argon2i$v=19$m=64,t=1,p=1$" + salt + "$" + key, wantErr: "unsupported password hash"},
+		{name: "plain text", hash: "password", wantErr: "unsupported password hash"},
+		{name: "malformed bcrypt", hash: "$2a$10$short", wantErr: "malformed bcrypt hash"},
+		{name: "missing key", hash: fmt.Sprintf("$argon2id$v=%d$m=64,t=1,p=1$%s", argon2.Version, salt), wantErr: "malformed argon2id hash"},
+		{name: "unknown version", hash: "$argon2id$v=16$m=64,t=1,p=1$" + salt + "$" + key, wantErr: "unsupported argon2id version"},
+		{name: "malformed parameters", hash: argon2id("m=64,p=1", salt, key), wantErr: "malformed argon2id parameters"},
+		{name: "threads overflow", hash: argon2id("m=64,t=1,p=256", salt, key), wantErr: "malformed argon2id parameters"},
+		{name: "zero iterations", hash: argon2id("m=64,t=0,p=1", salt, key), wantErr: "t and p must be at least 1"},
+		{name: "zero threads", hash: argon2id("m=64,t=1,p=0", salt, key), wantErr: "t and p must be at least 1"},
+		{name: "memory too large", hash: argon2id("m=4194304,t=1,p=1", salt, key), wantErr: "m must be at most"},
+		{name: "salt not base64", hash: argon2id("m=64,t=1,p=1", "!!!", key), wantErr: "malformed argon2id salt"},
+		{name: "short salt", hash: argon2id("m=64,t=1,p=1", base64.RawStdEncoding.EncodeToString([]byte("1234567")), key), wantErr: "salt must be at least 8 bytes"},
+		{name: "key not base64", hash: argon2id("m=64,t=1,p=1", salt, "!!!"), wantErr: "malformed argon2id key"},
+		{name: "short key", hash: argon2id("m=64,t=1,p=1", salt, base64.RawStdEncoding.EncodeToString(make([]byte, 15))), wantErr: "key must be at least 16 bytes"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validatePasswordHash(tt.hash)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("err = %v, want nil", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("err = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestFileUserStoreRejectsMalformedHash(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "users.json")
+	writeUsers := func(hash string) {
+		t.Helper()
+		data := fmt.Sprintf(`{"users": [{"username": "dev@example.com", "password_hash": %q}]}`, hash)
+		if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	writeUsers(testArgon2idHash("password"))
+	store, err := NewFileUserStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	writeUsers(strings.Replace(testArgon2idHash("password"), "t=1", "t=0", 1))
+	if err := store.Reload(); err == nil {
+		t.Fatal("Reload accepted a hash with t=0")
+	}
+	if _, err := NewFileUserStore(path); err == nil {
+		t.Error("NewFileUserStore accepted a hash with t=0")
+	}
+
+	// The users loaded before the failed reload are kept.
+	user, err := store.FindUser(context.Background(), "dev@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := comparePassword(user.PasswordHash, "password"); err != nil {
+		t.Errorf("password of the previously loaded user: %v", err)
+	}
+}
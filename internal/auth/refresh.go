@@ -0,0 +1,227 @@
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const DefaultRefreshTokenTTL = 24 * time.Hour
+
+var (
+	ErrRefreshTokenNotFound = errors.New("refresh token not found")
+	ErrInvalidRefreshToken  = errors.New("refresh token is invalid, expired or revoked")
+)
+
+// RefreshToken is the server side record of an issued refresh token. Every
+// token obtained by rotating another one shares its FamilyID, so presenting a
+// token that was already used can revoke everything derived from the same
+// login.
+type RefreshToken struct {
+	FamilyID string
+	Subject  string
+	// AuthTime is when the family was created by a login. It is carried over
+	// on rotation so revoking a subject also ends families created earlier.
+	AuthTime  time.Time
+	ExpiresAt time.Time
+	Used      bool
+}
+
+// RefreshTokenStore persists refresh tokens by the hash of their value.
+type RefreshTokenStore interface {
+	Save(ctx context.Context, tokenHash string, token RefreshToken) error
+	// Use marks the token as used and returns the record as it was before,
+	// atomically, so two concurrent refreshes cannot both succeed.
+	Use(ctx context.Context, tokenHash string) (RefreshToken, error)
+	// RevokeFamily rejects every token of the family until the given time,
+	// which should be no earlier than the expiry of its newest token.
+	RevokeFamily(ctx context.Context, familyID string, until time.Time) error
+	FamilyRevoked(ctx context.Context, familyID string) (bool, error)
+}
+
+func hashRefreshToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// MemoryRefreshTokenStore keeps refresh tokens in process. Tokens do not
+// survive a restart and are not shared between replicas.
+type MemoryRefreshTokenStore struct {
+	mu              sync.Mutex
+	tokens          map[string]RefreshToken
+	revokedFamilies map[string]time.Time
+	lastSweep       time.Time
+}
+
+func NewMemoryRefreshTokenStore() *MemoryRefreshTokenStore {
+	return &MemoryRefreshTokenStore{
+		tokens:          make(map[string]RefreshToken),
+		revokedFamilies: make(map[string]time.Time),
+	}
+}
+
+func (s *MemoryRefreshTokenStore) Save(ctx context.Context, tokenHash string, token RefreshToken) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.sweep(time.Now())
+	s.tokens[tokenHash] = token
+	return nil
+}
+
+func (s *MemoryRefreshTokenStore) Use(ctx context.Context, tokenHash string) (RefreshToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	token, ok := s.tokens[tokenHash]
+	if !ok {
+		return RefreshToken{}, ErrRefreshTokenNotFound
+	}
+	used := token
+	used.Used = true
+	s.tokens[tokenHash] = used
+	return token, nil
+}
+
+func (s *MemoryRefreshTokenStore) RevokeFamily(ctx context.Context, familyID string, until time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.revokedFamilies[familyID] = until
+	return nil
+}
+
+func (s *MemoryRefreshTokenStore) FamilyRevoked(ctx context.Context, familyID string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	until, ok := s.revokedFamilies[familyID]
+	return ok && time.Now().Before(until), nil
+}
+
+// sweep drops expired records at most once a minute.
+func (s *MemoryRefreshTokenStore) sweep(now time.Time) {
+	if now.Sub(s.lastSweep) < time.Minute {
+		return
+	}
+	s.lastSweep = now
+	for hash, token := range s.tokens {
+		if now.After(token.ExpiresAt) {
+			delete(s.tokens, hash)
+		}
+	}
+	for familyID, until := range s.revokedFamilies {
+		if now.After(until) {
+			delete(s.revokedFamilies, familyID)
+		}
+	}
+}
+
+const DefaultRedisRefreshTokenPrefix = "oms-gateway:refresh:"
+
+// useRefreshTokenScript returns the fields of a refresh token and marks it as
+// used in the same step, so two replicas cannot both rotate it.
+//
+// KEYS[1] = token key
+//
+// Returns {family_id, subject, auth_time, expires_at, used}, or nil when the
+// token is unknown.
+var useRefreshTokenScript = redis.NewScript(`
+local token = redis.call("HMGET", KEYS[1], "family_id", "subject", "auth_time", "expires_at", "used")
+if not token[1] then
+  return false
+end
+redis.call("HSET", KEYS[1], "used", 1)
+return token
+`)
+
+// RedisRefreshTokenStore shares refresh tokens between gateway replicas. Keys
+// expire on their own with the tokens and family revocations they hold.
+type RedisRefreshTokenStore struct {
+	client redis.UniversalClient
+	prefix string
+}
+
+func NewRedisRefreshTokenStore(client redis.UniversalClient) *RedisRefreshTokenStore {
+	return &RedisRefreshTokenStore{client: client, prefix: DefaultRedisRefreshTokenPrefix}
+}
+
+func (s *RedisRefreshTokenStore) tokenKey(tokenHash string) string {
+	return s.prefix + "token:" + tokenHash
+}
+
+func (s *RedisRefreshTokenStore) familyKey(familyID string) string {
+	return s.prefix + "family:" + familyID
+}
+
+func (s *RedisRefreshTokenStore) Save(ctx context.Context, tokenHash string, token RefreshToken) error {
+	if !time.Now().Before(token.ExpiresAt) {
+		return nil
+	}
+	key := s.tokenKey(tokenHash)
+	_, err := s.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HSet(ctx, key,
+			"family_id", token.FamilyID,
+			"subject", token.Subject,
+			"auth_time", token.AuthTime.UnixMilli(),
+			"expires_at", token.ExpiresAt.UnixMilli(),
+			"used", token.Used,
+		)
+		pipe.PExpireAt(ctx, key, token.ExpiresAt)
+		return nil
+	})
+	return err
+}
+
+func (s *RedisRefreshTokenStore) Use(ctx context.Context, tokenHash string) (RefreshToken, error) {
+	values, err := useRefreshTokenScript.Run(ctx, s.client, []string{s.tokenKey(tokenHash)}).StringSlice()
+	if errors.Is(err, redis.Nil) {
+		return RefreshToken{}, ErrRefreshTokenNotFound
+	}
+	if err != nil {
+		return RefreshToken{}, err
+	}
+	if len(values) != 5 {
+		return RefreshToken{}, fmt.Errorf("refresh token store: unexpected reply %v", values)
+	}
+
+	authTime, err := strconv.ParseInt(values[2], 10, 64)
+	if err != nil {
+		return RefreshToken{}, err
+	}
+	expiresAt, err := strconv.ParseInt(values[3], 10, 64)
+	if err != nil {
+		return RefreshToken{}, err
+	}
+	used, err := strconv.ParseBool(values[4])
+	if err != nil {
+		return RefreshToken{}, err
+	}
+	return RefreshToken{
+		FamilyID:  values[0],
+		Subject:   values[1],
+		AuthTime:  time.UnixMilli(authTime),
+		ExpiresAt: time.UnixMilli(expiresAt),
+		Used:      used,
+	}, nil
+}
+
+func (s *RedisRefreshTokenStore) RevokeFamily(ctx context.Context, familyID string, until time.Time) error {
+	ttl := time.Until(until)
+	if ttl <= 0 {
+		return nil
+	}
+	return s.client.Set(ctx, s.familyKey(familyID), 1, ttl).Err()
+}
+
+func (s *RedisRefreshTokenStore) FamilyRevoked(ctx context.Context, familyID string) (bool, error) {
+	n, err := s.client.Exists(ctx, s.familyKey(familyID)).Result()
+	return n > 0, err
+}
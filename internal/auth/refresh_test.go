@@ -0,0 +1,156 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+func newTestRedisClient(t *testing.T) redis.UniversalClient {
+	t.Helper()
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { client.Close() })
+	return client
+}
+
+func newTestTokenIssuer(t *testing.T, refreshTokens RefreshTokenStore, revocations RevocationList) (*TokenIssuer, *User) {
+	t.Helper()
+	keys, err := LoadKeySet(KeyConfig{Keys: "test:" + strings.Repeat("s", MinSecretLength)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	user := User{Username: "dev@example.com", Roles: []string{"viewer"}}
+	return NewTokenIssuer(keys, TokenConfig{}, NewMemoryUserStore(user), refreshTokens, revocations), &user
+}
+
+var refreshTokenStores = map[string]func(t *testing.T) RefreshTokenStore{
+	"memory": func(t *testing.T) RefreshTokenStore { return NewMemoryRefreshTokenStore() },
+	"redis":  func(t *testing.T) RefreshTokenStore { return NewRedisRefreshTokenStore(newTestRedisClient(t)) },
+}
+
+func TestRefreshRotatesTokens(t *testing.T) {
+	for name, newStore := range refreshTokenStores {
+		t.Run(name, func(t *testing.T) {
+			issuer, user := newTestTokenIssuer(t, newStore(t), NewMemoryRevocationList())
+			ctx := context.Background()
+
+			login, err := issuer.GenerateAccessToken(ctx, user)
+			if err != nil {
+				t.Fatal(err)
+			}
+			refreshed, err := issuer.Refresh(ctx, login.RefreshToken)
+			if err != nil {
+				t.Fatalf("refresh: %v", err)
+			}
+			if refreshed.RefreshToken == login.RefreshToken {
+				t.Error("refresh token was not rotated")
+			}
+			if _, err := issuer.Refresh(ctx, refreshed.RefreshToken); err != nil {
+				t.Fatalf("refresh with the rotated token: %v", err)
+			}
+		})
+	}
+}
+
+func TestRefreshReuseRevokesFamily(t *testing.T) {
+	for name, newStore := range refreshTokenStores {
+		t.Run(name, func(t *testing.T) {
+			issuer, user := newTestTokenIssuer(t, newStore(t), NewMemoryRevocationList())
+			ctx := context.Background()
+
+			login, err := issuer.GenerateAccessToken(ctx, user)
+			if err != nil {
+				t.Fatal(err)
+			}
+			rotated, err := issuer.Refresh(ctx, login.RefreshToken)
+			if err != nil {
+				t.Fatal(err)
+			}
+			other, err := issuer.GenerateAccessToken(ctx, user)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// Presenting the first token again, as a thief would, fails and
+			// takes the token its owner rotated to down with it.
+			if _, err := issuer.Refresh(ctx, login.RefreshToken); !errors.Is(err, ErrInvalidRefreshToken) {
+				t.Fatalf("reused token: err = %v, want %v", err, ErrInvalidRefreshToken)
+			}
+			if _, err := issuer.Refresh(ctx, rotated.RefreshToken); !errors.Is(err, ErrInvalidRefreshToken) {
+				t.Fatalf("token of the revoked family: err = %v, want %v", err, ErrInvalidRefreshToken)
+			}
+			// Families of other logins are not affected.
+			if _, err := issuer.Refresh(ctx, other.RefreshToken); err != nil {
+				t.Fatalf("token of another family: %v", err)
+			}
+		})
+	}
+}
+
+func TestRefreshRejectsUnknownToken(t *testing.T) {
+	for name, newStore := range refreshTokenStores {
+		t.Run(name, func(t *testing.T) {
+			issuer, _ := newTestTokenIssuer(t, newStore(t), NewMemoryRevocationList())
+
+			if _, err := issuer.Refresh(context.Background(), "unknown"); !errors.Is(err, ErrInvalidRefreshToken) {
+				t.Fatalf("err = %v, want %v", err, ErrInvalidRefreshToken)
+			}
+		})
+	}
+}
+
+func TestRedisRefreshTokenStoreRoundTrip(t *testing.T) {
+	store := NewRedisRefreshTokenStore(newTestRedisClient(t))
+	ctx := context.Background()
+	want := RefreshToken{
+		FamilyID:  "family",
+		Subject:   "dev@example.com",
+		AuthTime:  time.UnixMilli(time.Now().Add(-time.Minute).UnixMilli()),
+		ExpiresAt: time.UnixMilli(time.Now().Add(time.Hour).UnixMilli()),
+	}
+	if err := store.Save(ctx, "hash", want); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := store.Use(ctx, "hash")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.FamilyID != want.FamilyID || got.Subject != want.Subject || !got.AuthTime.Equal(want.AuthTime) || !got.ExpiresAt.Equal(want.ExpiresAt) || got.Used {
+		t.Errorf("first use = %+v, want %+v", got, want)
+	}
+	got, err = store.Use(ctx, "hash")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !got.Used {
+		t.Error("second use did not report the token as used")
+	}
+	if _, err := store.Use(ctx, "missing"); !errors.Is(err, ErrRefreshTokenNotFound) {
+		t.Errorf("unknown token: err = %v, want %v", err, ErrRefreshTokenNotFound)
+	}
+}
+
+func TestRedisRefreshTokenStoreSkipsExpiredRevocation(t *testing.T) {
+	store := NewRedisRefreshTokenStore(newTestRedisClient(t))
+	ctx := context.Background()
+
+	if err := store.RevokeFamily(ctx, "family", time.Now().Add(-time.Second)); err != nil {
+		t.Fatalf("revoking until a past time: %v", err)
+	}
+	if revoked, err := store.FamilyRevoked(ctx, "family"); err != nil || revoked {
+		t.Fatalf("FamilyRevoked = %v, %v; want false", revoked, err)
+	}
+	if err := store.RevokeFamily(ctx, "family", time.Now().Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if revoked, err := store.FamilyRevoked(ctx, "family"); err != nil || !revoked {
+		t.Fatalf("FamilyRevoked = %v, %v; want true", revoked, err)
+	}
+}
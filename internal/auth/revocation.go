@@ -0,0 +1,160 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const DefaultRedisRevocationPrefix = "oms-gateway:revoked:"
+
+var ErrRevocationCheckFailed = errors.New("failed to check token revocation")
+
+// RevocationList records tokens that must be rejected before they expire.
+// Entries only need to live until the tokens they cover have expired, so every
+// entry carries its own expiry.
+type RevocationList interface {
+	// RevokeToken rejects the token with the given jti.
+	RevokeToken(ctx context.Context, tokenID string, expiresAt time.Time) error
+	// RevokeSubject rejects every token of subject issued before the second
+	// of revokedAt.
+	RevokeSubject(ctx context.Context, subject string, revokedAt, expiresAt time.Time) error
+	Revoked(ctx context.Context, tokenID, subject string, issuedAt time.Time) (bool, error)
+}
+
+// revokedBySubject compares at the precision of the iat claim, whole seconds.
+// A token issued in the same second as the revocation is kept, so a user can
+// log in again right after being revoked.
+func revokedBySubject(issuedAt, revokedAt time.Time) bool {
+	return issuedAt.Before(revokedAt.Truncate(time.Second))
+}
+
+// MemoryRevocationList keeps revocations in process. Expired entries are
+// dropped so its size is bounded by the revocations made within one token
+// lifetime. Revocations are not shared between replicas.
+type MemoryRevocationList struct {
+	mu        sync.Mutex
+	tokens    map[string]time.Time
+	subjects  map[string]subjectRevocation
+	lastSweep time.Time
+}
+
+type subjectRevocation struct {
+	revokedAt time.Time
+	expiresAt time.Time
+}
+
+func NewMemoryRevocationList() *MemoryRevocationList {
+	return &MemoryRevocationList{
+		tokens:   make(map[string]time.Time),
+		subjects: make(map[string]subjectRevocation),
+	}
+}
+
+func (l *MemoryRevocationList) RevokeToken(ctx context.Context, tokenID string, expiresAt time.Time) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.sweep(time.Now())
+	l.tokens[tokenID] = expiresAt
+	return nil
+}
+
+func (l *MemoryRevocationList) RevokeSubject(ctx context.Context, subject string, revokedAt, expiresAt time.Time) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.sweep(time.Now())
+	l.subjects[subject] = subjectRevocation{revokedAt: revokedAt, expiresAt: expiresAt}
+	return nil
+}
+
+func (l *MemoryRevocationList) Revoked(ctx context.Context, tokenID, subject string, issuedAt time.Time) (bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	if expiresAt, ok := l.tokens[tokenID]; ok && now.Before(expiresAt) {
+		return true, nil
+	}
+	if revocation, ok := l.subjects[subject]; ok && now.Before(revocation.expiresAt) {
+		return revokedBySubject(issuedAt, revocation.revokedAt), nil
+	}
+	return false, nil
+}
+
+func (l *MemoryRevocationList) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < time.Minute {
+		return
+	}
+	l.lastSweep = now
+	for tokenID, expiresAt := range l.tokens {
+		if now.After(expiresAt) {
+			delete(l.tokens, tokenID)
+		}
+	}
+	for subject, revocation := range l.subjects {
+		if now.After(revocation.expiresAt) {
+			delete(l.subjects, subject)
+		}
+	}
+}
+
+// RedisRevocationList shares revocations between gateway replicas. Keys expire
+// on their own when the tokens they cover have expired.
+type RedisRevocationList struct {
+	client redis.UniversalClient
+	prefix string
+}
+
+func NewRedisRevocationList(client redis.UniversalClient) *RedisRevocationList {
+	return &RedisRevocationList{client: client, prefix: DefaultRedisRevocationPrefix}
+}
+
+func (l *RedisRevocationList) tokenKey(tokenID string) string {
+	return l.prefix + "jti:" + tokenID
+}
+
+func (l *RedisRevocationList) subjectKey(subject string) string {
+	return l.prefix + "sub:" + subject
+}
+
+// RevokeToken and RevokeSubject write nothing when the entry has already
+// expired: Redis would keep a key with a zero TTL forever.
+func (l *RedisRevocationList) RevokeToken(ctx context.Context, tokenID string, expiresAt time.Time) error {
+	ttl := time.Until(expiresAt)
+	if ttl <= 0 {
+		return nil
+	}
+	return l.client.Set(ctx, l.tokenKey(tokenID), 1, ttl).Err()
+}
+
+func (l *RedisRevocationList) RevokeSubject(ctx context.Context, subject string, revokedAt, expiresAt time.Time) error {
+	ttl := time.Until(expiresAt)
+	if ttl <= 0 {
+		return nil
+	}
+	return l.client.Set(ctx, l.subjectKey(subject), revokedAt.Unix(), ttl).Err()
+}
+
+func (l *RedisRevocationList) Revoked(ctx context.Context, tokenID, subject string, issuedAt time.Time) (bool, error) {
+	values, err := l.client.MGet(ctx, l.tokenKey(tokenID), l.subjectKey(subject)).Result()
+	if err != nil {
+		return false, err
+	}
+	if values[0] != nil {
+		return true, nil
+	}
+	if revokedAtStr, ok := values[1].(string); ok {
+		revokedAt, err := strconv.ParseInt(revokedAtStr, 10, 64)
+		if err != nil {
+			return false, err
+		}
+		return revokedBySubject(issuedAt, time.Unix(revokedAt, 0)), nil
+	}
+	return false, nil
+}
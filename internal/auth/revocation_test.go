@@ -0,0 +1,122 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+var revocationLists = map[string]func(t *testing.T) RevocationList{
+	"memory": func(t *testing.T) RevocationList { return NewMemoryRevocationList() },
+	"redis":  func(t *testing.T) RevocationList { return NewRedisRevocationList(newTestRedisClient(t)) },
+}
+
+func TestRevokeToken(t *testing.T) {
+	for name, newList := range revocationLists {
+		t.Run(name, func(t *testing.T) {
+			list := newList(t)
+			ctx := context.Background()
+			issuedAt := time.Now()
+
+			if err := list.RevokeToken(ctx, "jti-1", time.Now().Add(time.Hour)); err != nil {
+				t.Fatal(err)
+			}
+			if revoked, err := list.Revoked(ctx, "jti-1", "dev@example.com", issuedAt); err != nil || !revoked {
+				t.Errorf("revoked token: Revoked = %v, %v; want true", revoked, err)
+			}
+			if revoked, err := list.Revoked(ctx, "jti-2", "dev@example.com", issuedAt); err != nil || revoked {
+				t.Errorf("other token: Revoked = %v, %v; want false", revoked, err)
+			}
+		})
+	}
+}
+
+func TestRevokeSubject(t *testing.T) {
+	for name, newList := range revocationLists {
+		t.Run(name, func(t *testing.T) {
+			list := newList(t)
+			ctx := context.Background()
+			// Half way through a second, to tell truncation from rounding.
+			revokedAt := time.Now().Truncate(time.Second).Add(500 * time.Millisecond)
+			second := revokedAt.Truncate(time.Second)
+
+			if err := list.RevokeSubject(ctx, "dev@example.com", revokedAt, revokedAt.Add(time.Hour)); err != nil {
+				t.Fatal(err)
+			}
+			tests := []struct {
+				name     string
+				subject  string
+				issuedAt time.Time
+				want     bool
+			}{
+				{name: "issued before", subject: "dev@example.com", issuedAt: revokedAt.Add(-time.Minute), want: true},
+				{name: "issued the second before", subject: "dev@example.com", issuedAt: second.Add(-time.Second), want: true},
+				{name: "issued at the end of the second before", subject: "dev@example.com", issuedAt: second.Add(-time.Millisecond), want: true},
+				{name: "issued at the start of the same second", subject: "dev@example.com", issuedAt: second, want: false},
+				{name: "issued later in the same second", subject: "dev@example.com", issuedAt: revokedAt.Add(time.Millisecond), want: false},
+				{name: "issued after", subject: "dev@example.com", issuedAt: revokedAt.Add(time.Second), want: false},
+				{name: "other subject", subject: "customer@example.com", issuedAt: revokedAt.Add(-time.Minute), want: false},
+			}
+			for _, tt := range tests {
+				revoked, err := list.Revoked(ctx, "jti", tt.subject, tt.issuedAt)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if revoked != tt.want {
+					t.Errorf("%s: Revoked = %v, want %v", tt.name, revoked, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestRevokeExpiredEntry(t *testing.T) {
+	for name, newList := range revocationLists {
+		t.Run(name, func(t *testing.T) {
+			list := newList(t)
+			ctx := context.Background()
+			past := time.Now().Add(-time.Second)
+
+			if err := list.RevokeToken(ctx, "jti-1", past); err != nil {
+				t.Fatal(err)
+			}
+			if err := list.RevokeSubject(ctx, "dev@example.com", past.Add(-time.Hour), past); err != nil {
+				t.Fatal(err)
+			}
+			if revoked, err := list.Revoked(ctx, "jti-1", "dev@example.com", past.Add(-2*time.Hour)); err != nil || revoked {
+				t.Errorf("Revoked = %v, %v; want expired entries to be ignored", revoked, err)
+			}
+		})
+	}
+}
+
+func TestRedisRevocationListSkipsExpiredEntries(t *testing.T) {
+	client := newTestRedisClient(t)
+	list := NewRedisRevocationList(client)
+	ctx := context.Background()
+	past := time.Now().Add(-time.Second)
+
+	if err := list.RevokeToken(ctx, "jti-1", past); err != nil {
+		t.Fatal(err)
+	}
+	if err := list.RevokeSubject(ctx, "dev@example.com", past, past); err != nil {
+		t.Fatal(err)
+	}
+	keys, err := client.Keys(ctx, "*").Result()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 0 {
+		t.Errorf("keys = %v, want nothing written for expired entries", keys)
+	}
+}
+
+func TestRevokeAccessTokenWithoutTokenID(t *testing.T) {
+	issuer, _ := newTestTokenIssuer(t, NewMemoryRefreshTokenStore(), NewMemoryRevocationList())
+
+	err := issuer.RevokeAccessToken(context.Background(), &Principal{Subject: "oidc|user", ExpiresAt: time.Now().Add(time.Hour)})
+	if !errors.Is(err, ErrTokenNotRevocable) {
+		t.Fatalf("err = %v, want %v", err, ErrTokenNotRevocable)
+	}
+}
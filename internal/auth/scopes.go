@@ -0,0 +1,54 @@
+package auth
+
+import (
+	"slices"
+	"strings"
+)
+
+const (
+	// ScopeAdmin grants administrative operations such as revoking the tokens
+	// of other users.
+	ScopeAdmin = "admin"
+	// ScopeOrdersAdmin grants access to the orders of every customer.
+	ScopeOrdersAdmin = "orders:admin"
+)
+
+// RoleScopes maps a role to the scopes it grants.
+type RoleScopes map[string][]string
+
+// Expand returns the scopes granted by roles together with the extra scopes,
+// sorted and without duplicates.
+func (rs RoleScopes) Expand(roles, scopes []string) []string {
+	expanded := slices.Clone(scopes)
+	for _, role := range roles {
+		expanded = append(expanded, rs[role]...)
+	}
+	slices.Sort(expanded)
+	return slices.Compact(expanded)
+}
+
+// HasScope reports whether the caller was granted scope.
+func (p *Principal) HasScope(scope string) bool {
+	return slices.Contains(p.Scopes, scope)
+}
+
+// MissingScopes returns the scopes in required that the caller was not
+// granted.
+func (p *Principal) MissingScopes(required []string) []string {
+	var missing []string
+	for _, scope := range required {
+		if !p.HasScope(scope) {
+			missing = append(missing, scope)
+		}
+	}
+	return missing
+}
+
+// formatScope encodes scopes as the space separated scope claim of RFC 9068.
+func formatScope(scopes []string) string {
+	return strings.Join(scopes, " ")
+}
+
+func parseScope(scope string) []string {
+	return strings.Fields(scope)
+}
@@ -1,6 +1,10 @@
 package auth
 
 import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"time"
@@ -10,32 +14,255 @@ import (
 
 type (
 	TokenRequest struct {
-		Email string
+		Email    string
+		Password string
 	}
+	// TokenResponse follows the OAuth 2.0 access token response (RFC 6749,
+	// section 5.1).
 	TokenResponse struct {
-		Token string `json:"access_token"`
+		Token        string `json:"access_token"`
+		TokenType    string `json:"token_type"`
+		ExpiresIn    int64  `json:"expires_in"`
+		RefreshToken string `json:"refresh_token,omitempty"`
 	}
 )
 
+const (
+	DefaultTokenTTL      = 10 * time.Minute
+	DefaultTokenLeeway   = 30 * time.Second
+	DefaultTokenIssuer   = "oms-gateway"
+	DefaultTokenAudience = "oms-gateway"
+	TokenTypeBearer      = "Bearer"
+
+	ClaimSubject   = "username"
+	ClaimExpiresAt = "exp"
+	ClaimIssuedAt  = "iat"
+	ClaimNotBefore = "nbf"
+	ClaimIssuer    = "iss"
+	ClaimAudience  = "aud"
+	ClaimTokenID   = "jti"
+	ClaimRoles     = "roles"
+	ClaimScope     = "scope"
+)
+
 var (
-	DefaultTokenExpiration   = time.Now().Add(time.Minute * 10).Unix()
 	ErrTokenGenerationFailed = errors.New("failed to generate JWT token")
+	ErrTokenNotRevocable     = errors.New("token has no jti claim and cannot be revoked")
 )
 
-const TOKEN_SECRET = "OMS_SECRET_FOR_TOKEN"
+// TokenConfig holds the claims settings shared by token issuance and
+// verification.
+type TokenConfig struct {
+	// TTL is how long an access token stays valid after it is issued.
+	TTL time.Duration
+	// Issuer is written to and required in the iss claim.
+	Issuer string
+	// Audience is written to and required in the aud claim.
+	Audience string
+	// Leeway is the clock skew tolerated when checking exp, nbf and iat.
+	Leeway time.Duration
+	// RefreshTTL is how long a refresh token can be exchanged for new tokens.
+	RefreshTTL time.Duration
+	// RoleScopes expands the roles of a user into the scopes written to the
+	// scope claim.
+	RoleScopes RoleScopes
+}
+
+func (cfg TokenConfig) withDefaults() TokenConfig {
+	if cfg.TTL <= 0 {
+		cfg.TTL = DefaultTokenTTL
+	}
+	if cfg.Issuer == "" {
+		cfg.Issuer = DefaultTokenIssuer
+	}
+	if cfg.Audience == "" {
+		cfg.Audience = DefaultTokenAudience
+	}
+	if cfg.Leeway < 0 {
+		cfg.Leeway = 0
+	}
+	if cfg.RefreshTTL <= 0 {
+		cfg.RefreshTTL = DefaultRefreshTokenTTL
+	}
+	return cfg
+}
+
+// TokenIssuer mints tokens for users of a UserStore. Roles and scopes are read
+// from the store on every refresh, so changes to a user apply as soon as their
+// access token is refreshed.
+type TokenIssuer struct {
+	keys          *KeySet
+	cfg           TokenConfig
+	users         UserStore
+	refreshTokens RefreshTokenStore
+	revocations   RevocationList
+}
+
+func NewTokenIssuer(keys *KeySet, cfg TokenConfig, users UserStore, refreshTokens RefreshTokenStore, revocations RevocationList) *TokenIssuer {
+	return &TokenIssuer{keys: keys, cfg: cfg.withDefaults(), users: users, refreshTokens: refreshTokens, revocations: revocations}
+}
+
+// GenerateAccessToken issues an access token together with the first refresh
+// token of a new token family.
+func (ti *TokenIssuer) GenerateAccessToken(ctx context.Context, user *User) (*TokenResponse, error) {
+	familyID, err := newTokenID()
+	if err != nil {
+		return nil, fmt.Errorf("%w: family id: %v", ErrTokenGenerationFailed, err)
+	}
+	return ti.issueTokens(ctx, familyID, user, time.Now())
+}
+
+// Refresh exchanges a refresh token for a new access token and a new refresh
+// token of the same family. Each refresh token can be used once; presenting
+// one again is treated as theft and revokes the whole family.
+func (ti *TokenIssuer) Refresh(ctx context.Context, refreshToken string) (*TokenResponse, error) {
+	record, err := ti.refreshTokens.Use(ctx, hashRefreshToken(refreshToken))
+	if errors.Is(err, ErrRefreshTokenNotFound) {
+		return nil, ErrInvalidRefreshToken
+	}
+	if err != nil {
+		return nil, err
+	}
 
-func GenerateAccessToken(req TokenRequest) (*TokenResponse, error) {
+	now := time.Now()
+	if record.Used {
+		if err := ti.refreshTokens.RevokeFamily(ctx, record.FamilyID, now.Add(ti.cfg.RefreshTTL)); err != nil {
+			return nil, err
+		}
+		return nil, ErrInvalidRefreshToken
+	}
+	if now.After(record.ExpiresAt) {
+		return nil, ErrInvalidRefreshToken
+	}
+	revoked, err := ti.refreshTokens.FamilyRevoked(ctx, record.FamilyID)
+	if err != nil {
+		return nil, err
+	}
+	if revoked {
+		return nil, ErrInvalidRefreshToken
+	}
+	revoked, err = ti.revocations.Revoked(ctx, "", record.Subject, record.AuthTime)
+	if err != nil {
+		return nil, err
+	}
+	if revoked {
+		return nil, ErrInvalidRefreshToken
+	}
+
+	user, err := ti.users.FindUser(ctx, record.Subject)
+	if errors.Is(err, ErrUserNotFound) {
+		return nil, ErrInvalidRefreshToken
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return ti.issueTokens(ctx, record.FamilyID, user, record.AuthTime)
+}
+
+// RevokeAccessToken rejects the access token of principal until it expires.
+// Tokens without a jti, which some OIDC providers issue, cannot be revoked
+// and give ErrTokenNotRevocable.
+func (ti *TokenIssuer) RevokeAccessToken(ctx context.Context, principal *Principal) error {
+	if principal.TokenID == "" {
+		return ErrTokenNotRevocable
+	}
+	return ti.revocations.RevokeToken(ctx, principal.TokenID, principal.ExpiresAt.Add(ti.cfg.Leeway))
+}
+
+// RevokeRefreshToken revokes the family of refreshToken. Tokens that are
+// unknown or already expired are ignored.
+func (ti *TokenIssuer) RevokeRefreshToken(ctx context.Context, refreshToken string) error {
+	record, err := ti.refreshTokens.Use(ctx, hashRefreshToken(refreshToken))
+	if errors.Is(err, ErrRefreshTokenNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return ti.refreshTokens.RevokeFamily(ctx, record.FamilyID, time.Now().Add(ti.cfg.RefreshTTL))
+}
+
+// RevokeSubject rejects every access and refresh token issued to subject so
+// far. The entry is kept until the longest lived of those tokens has expired:
+// a refresh token family can only be rotated while it is not revoked, so none
+// of its tokens outlives the revocation by more than RefreshTTL.
+func (ti *TokenIssuer) RevokeSubject(ctx context.Context, subject string) error {
+	now := time.Now()
+	return ti.revocations.RevokeSubject(ctx, subject, now, now.Add(max(ti.cfg.TTL+ti.cfg.Leeway, ti.cfg.RefreshTTL)))
+}
+
+func (ti *TokenIssuer) issueTokens(ctx context.Context, familyID string, user *User, authTime time.Time) (*TokenResponse, error) {
+	accessToken, err := ti.signAccessToken(user)
+	if err != nil {
+		return nil, err
+	}
+
+	refreshToken, err := newRefreshToken()
+	if err != nil {
+		return nil, fmt.Errorf("%w: refresh token: %v", ErrTokenGenerationFailed, err)
+	}
+	err = ti.refreshTokens.Save(ctx, hashRefreshToken(refreshToken), RefreshToken{
+		FamilyID:  familyID,
+		Subject:   user.Username,
+		AuthTime:  authTime,
+		ExpiresAt: time.Now().Add(ti.cfg.RefreshTTL),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%w: saving refresh token: %v", ErrTokenGenerationFailed, err)
+	}
+
+	return &TokenResponse{
+		Token:        accessToken,
+		TokenType:    TokenTypeBearer,
+		ExpiresIn:    int64(ti.cfg.TTL.Seconds()),
+		RefreshToken: refreshToken,
+	}, nil
+}
+
+func (ti *TokenIssuer) signAccessToken(user *User) (string, error) {
+	tokenID, err := newTokenID()
+	if err != nil {
+		return "", fmt.Errorf("%w: token id: %v", ErrTokenGenerationFailed, err)
+	}
+
+	now := time.Now()
 	claims := jwt.MapClaims{
-		"username": req.Email,
-		"exp":      DefaultTokenExpiration,
+		ClaimSubject:   user.Username,
+		ClaimIssuer:    ti.cfg.Issuer,
+		ClaimAudience:  ti.cfg.Audience,
+		ClaimIssuedAt:  now.Unix(),
+		ClaimNotBefore: now.Unix(),
+		ClaimExpiresAt: now.Add(ti.cfg.TTL).Unix(),
+		ClaimTokenID:   tokenID,
+		ClaimScope:     formatScope(ti.cfg.RoleScopes.Expand(user.Roles, user.Scopes)),
+	}
+	if len(user.Roles) > 0 {
+		claims[ClaimRoles] = user.Roles
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	tokenString, err := token.SignedString([]byte(TOKEN_SECRET))
+	key := ti.keys.SigningKey()
+	token := jwt.NewWithClaims(key.signingMethod(), claims)
+	token.Header[JWTKeyIDHeader] = key.ID
+	tokenString, err := token.SignedString(key.signingKey())
 	if err != nil {
-		fmt.Println("Error generating token:", err)
-		return nil, ErrTokenGenerationFailed
+		return "", fmt.Errorf("%w: %v", ErrTokenGenerationFailed, err)
+	}
+	return tokenString, nil
+}
+
+func newTokenID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
 	}
+	return hex.EncodeToString(b), nil
+}
 
-	return &TokenResponse{Token: tokenString}, nil
+func newRefreshToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
 }
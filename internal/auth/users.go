@@ -0,0 +1,110 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+)
+
+var ErrUserNotFound = errors.New("user not found")
+
+type User struct {
+	Username string `json:"username"`
+	// PasswordHash is a bcrypt hash or an argon2id hash in PHC string format.
+	PasswordHash string `json:"password_hash"`
+	// Roles grant the scopes mapped to them by TokenConfig.RoleScopes.
+	Roles []string `json:"roles,omitempty"`
+	// Scopes are granted in addition to those of Roles.
+	Scopes []string `json:"scopes,omitempty"`
+}
+
+// UserStore looks up the users allowed to log in.
+type UserStore interface {
+	FindUser(ctx context.Context, username string) (*User, error)
+}
+
+// MemoryUserStore keeps users in process, mainly for tests and local setups.
+type MemoryUserStore struct {
+	mu    sync.RWMutex
+	users map[string]User
+}
+
+func NewMemoryUserStore(users ...User) *MemoryUserStore {
+	s := &MemoryUserStore{users: make(map[string]User, len(users))}
+	for _, user := range users {
+		s.users[user.Username] = user
+	}
+	return s
+}
+
+func (s *MemoryUserStore) AddUser(user User) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.users[user.Username] = user
+}
+
+func (s *MemoryUserStore) FindUser(ctx context.Context, username string) (*User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	user, ok := s.users[username]
+	if !ok {
+		return nil, ErrUserNotFound
+	}
+	return &user, nil
+}
+
+// FileUserStore serves users from a JSON file of the form
+// {"users": [{"username": "...", "password_hash": "..."}]}. Reload picks up
+// changes to the file.
+type FileUserStore struct {
+	path string
+
+	mu    sync.RWMutex
+	users *MemoryUserStore
+}
+
+func NewFileUserStore(path string) (*FileUserStore, error) {
+	s := &FileUserStore{path: path}
+	if err := s.Reload(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *FileUserStore) Reload() error {
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		return fmt.Errorf("failed to read users file: %w", err)
+	}
+	var file struct {
+		Users []User `json:"users"`
+	}
+	if err := json.Unmarshal(data, &file); err != nil {
+		return fmt.Errorf("failed to parse users file: %w", err)
+	}
+	for _, user := range file.Users {
+		if user.Username == "" {
+			return fmt.Errorf("users file %s: user without username", s.path)
+		}
+		if err := validatePasswordHash(user.PasswordHash); err != nil {
+			return fmt.Errorf("users file %s: user %q: %w", s.path, user.Username, err)
+		}
+	}
+
+	users := NewMemoryUserStore(file.Users...)
+	s.mu.Lock()
+	s.users = users
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *FileUserStore) FindUser(ctx context.Context, username string) (*User, error) {
+	s.mu.RLock()
+	users := s.users
+	s.mu.RUnlock()
+	return users.FindUser(ctx, username)
+}
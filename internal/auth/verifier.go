@@ -0,0 +1,217 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+var (
+	ErrInvalidToken      = errors.New("invalid token")
+	ErrTokenExpired      = errors.New("token is expired")
+	ErrTokenNotYetValid  = errors.New("token is not valid yet")
+	ErrTokenUsedTooEarly = errors.New("token used before issued")
+	ErrInvalidIssuer     = errors.New("token has an invalid issuer")
+	ErrInvalidAudience   = errors.New("token has an invalid audience")
+	ErrTokenRevoked      = errors.New("token has been revoked")
+)
+
+// TokenVerifier checks the signature of access tokens against a KeySet, or
+// against the keys of an OIDC provider when the token names one as its
+// issuer, and validates their registered claims. jwt-go's own claim
+// validation has no notion of clock skew, so it is skipped in favour of
+// validateClaims. Tokens that pass are finally checked against the revocation
+// list.
+type TokenVerifier struct {
+	keys        *KeySet
+	cfg         TokenConfig
+	parser      *jwt.Parser
+	revocations RevocationList
+	providers   map[string]*OIDCProvider
+}
+
+func NewTokenVerifier(keys *KeySet, cfg TokenConfig, revocations RevocationList, providers []*OIDCProvider) *TokenVerifier {
+	byIssuer := make(map[string]*OIDCProvider, len(providers))
+	for _, provider := range providers {
+		byIssuer[provider.Issuer()] = provider
+	}
+	return &TokenVerifier{
+		keys:        keys,
+		cfg:         cfg.withDefaults(),
+		parser:      &jwt.Parser{UseJSONNumber: true, SkipClaimsValidation: true},
+		revocations: revocations,
+		providers:   byIssuer,
+	}
+}
+
+// Verify returns ErrRevocationCheckFailed when the revocation list cannot be
+// reached and ErrOIDCUnavailable when the keys of an OIDC provider cannot be
+// fetched, so callers can tell an unavailable dependency from an invalid
+// token.
+func (tv *TokenVerifier) Verify(ctx context.Context, tokenString string) (*Principal, error) {
+	unverified := jwt.MapClaims{}
+	if _, _, err := tv.parser.ParseUnverified(tokenString, unverified); err != nil {
+		return nil, err
+	}
+	issuer, _ := unverified[ClaimIssuer].(string)
+	provider, external := tv.providers[issuer]
+
+	keyfunc, audience := tv.keys.Keyfunc, tv.cfg.Audience
+	if external {
+		keyfunc, audience = provider.Keyfunc, provider.cfg.Audience
+	} else {
+		issuer = tv.cfg.Issuer
+	}
+
+	token, err := tv.parser.Parse(tokenString, keyfunc)
+	if err != nil {
+		// jwt-go v3 errors do not unwrap, so errors.Is cannot see through them.
+		var validationErr *jwt.ValidationError
+		if errors.As(err, &validationErr) && validationErr.Inner != nil {
+			return nil, validationErr.Inner
+		}
+		return nil, err
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !token.Valid || !ok {
+		return nil, ErrInvalidToken
+	}
+	if err := tv.validateClaims(claims, issuer, audience, time.Now()); err != nil {
+		return nil, err
+	}
+
+	var principal *Principal
+	if external {
+		principal, err = provider.principal(claims, tv.cfg.RoleScopes)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		principal = principalFromClaims(claims)
+	}
+	if principal.Subject == "" {
+		return nil, fmt.Errorf("%w: missing subject", ErrInvalidToken)
+	}
+
+	revoked, err := tv.revocations.Revoked(ctx, principal.TokenID, principal.Subject, principal.IssuedAt)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrRevocationCheckFailed, err)
+	}
+	if revoked {
+		return nil, ErrTokenRevoked
+	}
+	return principal, nil
+}
+
+// principalFromClaims expects claims that already passed validateClaims.
+func principalFromClaims(claims jwt.MapClaims) *Principal {
+	subject, _ := claims[ClaimSubject].(string)
+	tokenID, _ := claims[ClaimTokenID].(string)
+	issuedAt, _ := timeClaim(claims, ClaimIssuedAt, false)
+	expiresAt, _ := timeClaim(claims, ClaimExpiresAt, true)
+	scope, _ := claims[ClaimScope].(string)
+	return &Principal{
+		Subject:    subject,
+		Roles:      stringsClaim(claims, ClaimRoles),
+		Scopes:     parseScope(scope),
+		AuthScheme: SchemeBearer,
+		TokenID:    tokenID,
+		IssuedAt:   issuedAt,
+		ExpiresAt:  expiresAt,
+	}
+}
+
+func stringsClaim(claims jwt.MapClaims, name string) []string {
+	values, _ := claims[name].([]interface{})
+	var strs []string
+	for _, v := range values {
+		if s, ok := v.(string); ok {
+			strs = append(strs, s)
+		}
+	}
+	return strs
+}
+
+func (tv *TokenVerifier) validateClaims(claims jwt.MapClaims, issuer, audience string, now time.Time) error {
+	exp, err := timeClaim(claims, ClaimExpiresAt, true)
+	if err != nil {
+		return err
+	}
+	if now.After(exp.Add(tv.cfg.Leeway)) {
+		return ErrTokenExpired
+	}
+
+	nbf, err := timeClaim(claims, ClaimNotBefore, false)
+	if err != nil {
+		return err
+	}
+	if !nbf.IsZero() && now.Add(tv.cfg.Leeway).Before(nbf) {
+		return ErrTokenNotYetValid
+	}
+
+	iat, err := timeClaim(claims, ClaimIssuedAt, false)
+	if err != nil {
+		return err
+	}
+	if !iat.IsZero() && now.Add(tv.cfg.Leeway).Before(iat) {
+		return ErrTokenUsedTooEarly
+	}
+
+	if iss, _ := claims[ClaimIssuer].(string); iss != issuer {
+		return ErrInvalidIssuer
+	}
+	if !hasAudience(claims, audience) {
+		return ErrInvalidAudience
+	}
+	return nil
+}
+
+func timeClaim(claims jwt.MapClaims, name string, required bool) (time.Time, error) {
+	value, ok := claims[name]
+	if !ok {
+		if required {
+			return time.Time{}, fmt.Errorf("%w: missing %s claim", ErrInvalidToken, name)
+		}
+		return time.Time{}, nil
+	}
+
+	var seconds int64
+	switch v := value.(type) {
+	case json.Number:
+		n, err := v.Int64()
+		if err != nil {
+			f, ferr := v.Float64()
+			if ferr != nil {
+				return time.Time{}, fmt.Errorf("%w: malformed %s claim", ErrInvalidToken, name)
+			}
+			n = int64(f)
+		}
+		seconds = n
+	case float64:
+		seconds = int64(v)
+	default:
+		return time.Time{}, fmt.Errorf("%w: malformed %s claim", ErrInvalidToken, name)
+	}
+	return time.Unix(seconds, 0), nil
+}
+
+// hasAudience accepts aud as either a single string or a list of strings, as
+// allowed by RFC 7519.
+func hasAudience(claims jwt.MapClaims, audience string) bool {
+	switch aud := claims[ClaimAudience].(type) {
+	case string:
+		return aud == audience
+	case []interface{}:
+		for _, v := range aud {
+			if s, ok := v.(string); ok && s == audience {
+				return true
+			}
+		}
+	}
+	return false
+}
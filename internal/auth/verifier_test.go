@@ -0,0 +1,130 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+// newTestTokenVerifier returns a verifier of HS256 tokens signed with
+// testSecretA under kid "a", with the default issuer and audience and
+// DefaultTokenLeeway.
+func newTestTokenVerifier(t *testing.T) *TokenVerifier {
+	t.Helper()
+	keys, err := LoadKeySet(KeyConfig{Keys: "a:" + testSecretA})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewTokenVerifier(keys, TokenConfig{Leeway: DefaultTokenLeeway}, NewMemoryRevocationList(), nil)
+}
+
+// validTestClaims returns the claims of a token the default verifier accepts.
+func validTestClaims() jwt.MapClaims {
+	now := time.Now()
+	return jwt.MapClaims{
+		ClaimSubject:   "dev@example.com",
+		ClaimIssuer:    DefaultTokenIssuer,
+		ClaimAudience:  DefaultTokenAudience,
+		ClaimIssuedAt:  now.Unix(),
+		ClaimNotBefore: now.Unix(),
+		ClaimExpiresAt: now.Add(time.Minute).Unix(),
+	}
+}
+
+func TestTokenVerifierValidatesClaims(t *testing.T) {
+	now := time.Now()
+	// Well inside and well outside DefaultTokenLeeway, so the test does not
+	// depend on how long signing takes.
+	within, beyond := DefaultTokenLeeway/3, 2*DefaultTokenLeeway
+
+	tests := []struct {
+		name    string
+		claims  jwt.MapClaims
+		wantErr error
+	}{
+		{name: "valid", claims: jwt.MapClaims{}},
+		{name: "expired within leeway", claims: jwt.MapClaims{ClaimExpiresAt: now.Add(-within).Unix()}},
+		{name: "expired beyond leeway", claims: jwt.MapClaims{ClaimExpiresAt: now.Add(-beyond).Unix()}, wantErr: ErrTokenExpired},
+		{name: "missing exp", claims: jwt.MapClaims{ClaimExpiresAt: nil}, wantErr: ErrInvalidToken},
+		{name: "nbf within leeway", claims: jwt.MapClaims{ClaimNotBefore: now.Add(within).Unix()}},
+		{name: "nbf beyond leeway", claims: jwt.MapClaims{ClaimNotBefore: now.Add(beyond).Unix()}, wantErr: ErrTokenNotYetValid},
+		{name: "iat within leeway", claims: jwt.MapClaims{ClaimIssuedAt: now.Add(within).Unix()}},
+		{name: "iat beyond leeway", claims: jwt.MapClaims{ClaimIssuedAt: now.Add(beyond).Unix()}, wantErr: ErrTokenUsedTooEarly},
+		{name: "malformed iat", claims: jwt.MapClaims{ClaimIssuedAt: "yesterday"}, wantErr: ErrInvalidToken},
+		{name: "issuer mismatch", claims: jwt.MapClaims{ClaimIssuer: "someone-else"}, wantErr: ErrInvalidIssuer},
+		{name: "missing issuer", claims: jwt.MapClaims{ClaimIssuer: nil}, wantErr: ErrInvalidIssuer},
+		{name: "audience string mismatch", claims: jwt.MapClaims{ClaimAudience: "billing"}, wantErr: ErrInvalidAudience},
+		{name: "audience array", claims: jwt.MapClaims{ClaimAudience: []string{"billing", DefaultTokenAudience}}},
+		{name: "audience array mismatch", claims: jwt.MapClaims{ClaimAudience: []string{"billing"}}, wantErr: ErrInvalidAudience},
+		{name: "empty audience array", claims: jwt.MapClaims{ClaimAudience: []string{}}, wantErr: ErrInvalidAudience},
+		{name: "audience array of non-strings", claims: jwt.MapClaims{ClaimAudience: []int{1}}, wantErr: ErrInvalidAudience},
+		{name: "missing audience", claims: jwt.MapClaims{ClaimAudience: nil}, wantErr: ErrInvalidAudience},
+		{name: "missing subject", claims: jwt.MapClaims{ClaimSubject: nil}, wantErr: ErrInvalidToken},
+	}
+	verifier := newTestTokenVerifier(t)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims := validTestClaims()
+			for name, value := range tt.claims {
+				if value == nil {
+					delete(claims, name)
+					continue
+				}
+				claims[name] = value
+			}
+			token := signTestToken(t, jwt.SigningMethodHS256, "a", []byte(testSecretA), claims)
+
+			_, err := verifier.Verify(context.Background(), token)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("err = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// jwt-go v3 reads an aud array as a missing audience, which
+// MapClaims.VerifyAudience accepts unless the audience is required
+// (CVE-2020-26160). The verifier skips jwt-go's claim validation and checks
+// the audience itself with hasAudience.
+func TestTokenVerifierRejectsAudienceArrayWithoutItsAudience(t *testing.T) {
+	aud := []interface{}{"billing"}
+	if !(jwt.MapClaims{ClaimAudience: aud}).VerifyAudience(DefaultTokenAudience, false) {
+		t.Skip("jwt-go no longer accepts a foreign aud array, the workaround may be obsolete")
+	}
+
+	claims := validTestClaims()
+	claims[ClaimAudience] = aud
+	token := signTestToken(t, jwt.SigningMethodHS256, "a", []byte(testSecretA), claims)
+	if _, err := newTestTokenVerifier(t).Verify(context.Background(), token); !errors.Is(err, ErrInvalidAudience) {
+		t.Errorf("err = %v, want %v", err, ErrInvalidAudience)
+	}
+}
+
+func TestTokenVerifierLeewayIsConfigurable(t *testing.T) {
+	keys, err := LoadKeySet(KeyConfig{Keys: "a:" + testSecretA})
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims := validTestClaims()
+	claims[ClaimExpiresAt] = time.Now().Add(-2 * time.Minute).Unix()
+	token := signTestToken(t, jwt.SigningMethodHS256, "a", []byte(testSecretA), claims)
+
+	tests := []struct {
+		leeway  time.Duration
+		wantErr error
+	}{
+		{leeway: time.Minute, wantErr: ErrTokenExpired},
+		{leeway: 5 * time.Minute},
+	}
+	for _, tt := range tests {
+		t.Run(tt.leeway.String(), func(t *testing.T) {
+			verifier := NewTokenVerifier(keys, TokenConfig{Leeway: tt.leeway}, NewMemoryRevocationList(), nil)
+			if _, err := verifier.Verify(context.Background(), token); !errors.Is(err, tt.wantErr) {
+				t.Errorf("err = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
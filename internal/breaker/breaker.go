@@ -0,0 +1,280 @@
+// Package breaker implements circuit breakers that stop calls to a failing
+// backend. A breaker opens when too many calls in a window fail or are slow,
+// rejects calls while open, then lets a few probe calls through half-open to
+// decide whether to close again.
+package breaker
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+type State int
+
+const (
+	Closed State = iota
+	Open
+	HalfOpen
+)
+
+func (s State) String() string {
+	switch s {
+	case Closed:
+		return "closed"
+	case Open:
+		return "open"
+	case HalfOpen:
+		return "half_open"
+	}
+	return fmt.Sprintf("State(%d)", int(s))
+}
+
+// Outcome is the result of a call as far as the breaker is concerned.
+type Outcome int
+
+const (
+	Success Outcome = iota
+	Failure
+	// Ignore is for calls that say nothing about the backend, such as ones
+	// cancelled by the caller.
+	Ignore
+)
+
+const (
+	DefaultWindow           = 10 * time.Second
+	DefaultMinRequests      = 20
+	DefaultFailureRatio     = 0.5
+	DefaultSlowCallDuration = 2 * time.Second
+	DefaultSlowCallRatio    = 0.8
+	DefaultOpenDuration     = 15 * time.Second
+	DefaultHalfOpenRequests = 3
+
+	// halfOpenRetryAfter is suggested to callers rejected because all
+	// half-open probes are in flight.
+	halfOpenRetryAfter = time.Second
+)
+
+type Config struct {
+	// Window is how long calls are counted before the counts start over.
+	Window time.Duration
+	// MinRequests is the number of calls in a window below which the
+	// breaker does not open.
+	MinRequests int
+	// FailureRatio opens the breaker when reached by the failed calls of a
+	// window. Zero disables the breakers.
+	FailureRatio float64
+	// SlowCallDuration is the latency from which a call counts as slow. Zero
+	// disables the latency criterion.
+	SlowCallDuration time.Duration
+	// SlowCallRatio opens the breaker when reached by the slow calls of a
+	// window.
+	SlowCallRatio float64
+	// OpenDuration is how long the breaker rejects calls before probing.
+	OpenDuration time.Duration
+	// HalfOpenRequests is the number of probe calls that must succeed to
+	// close the breaker. It also bounds the concurrent probes.
+	HalfOpenRequests int
+}
+
+func (c Config) Enabled() bool {
+	return c.FailureRatio > 0
+}
+
+// OpenError is returned for calls rejected by an open breaker.
+type OpenError struct {
+	RetryAfter time.Duration
+}
+
+func (e *OpenError) Error() string {
+	return "circuit breaker is open"
+}
+
+// Breaker guards the calls to one backend method. Its zero value is not
+// usable; create it with New.
+type Breaker struct {
+	cfg           Config
+	onStateChange func(from, to State)
+	now           func() time.Time
+
+	mu          sync.Mutex
+	state       State
+	generation  uint64
+	windowStart time.Time
+	total       int
+	failures    int
+	slow        int
+	openUntil   time.Time
+	probes      int
+	successes   int
+}
+
+// New returns a closed breaker. onStateChange, if set, is called on every
+// transition with the breaker locked, so it must not call the breaker.
+func New(cfg Config, onStateChange func(from, to State)) *Breaker {
+	b := &Breaker{cfg: cfg, onStateChange: onStateChange, now: time.Now}
+	b.windowStart = b.now()
+	return b
+}
+
+// Allow reports whether a call may proceed. The caller must report the
+// outcome of an allowed call with done. Rejected calls get an *OpenError.
+func (b *Breaker) Allow() (done func(outcome Outcome, latency time.Duration), err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := b.now()
+	switch b.currentState(now) {
+	case Open:
+		return nil, &OpenError{RetryAfter: b.openUntil.Sub(now)}
+	case HalfOpen:
+		if b.probes >= b.cfg.HalfOpenRequests {
+			return nil, &OpenError{RetryAfter: halfOpenRetryAfter}
+		}
+		b.probes++
+	}
+
+	generation := b.generation
+	return func(outcome Outcome, latency time.Duration) {
+		b.done(generation, outcome, latency)
+	}, nil
+}
+
+// State returns the current state.
+func (b *Breaker) State() State {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.currentState(b.now())
+}
+
+// currentState moves an open breaker whose open duration has passed to
+// half-open.
+func (b *Breaker) currentState(now time.Time) State {
+	if b.state == Open && !now.Before(b.openUntil) {
+		b.setState(HalfOpen, now)
+	}
+	return b.state
+}
+
+func (b *Breaker) done(generation uint64, outcome Outcome, latency time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	// The breaker changed state since the call was allowed, so the call
+	// belongs to counts that were already reset.
+	if generation != b.generation {
+		return
+	}
+	now := b.now()
+	slow := b.cfg.SlowCallDuration > 0 && latency >= b.cfg.SlowCallDuration
+
+	switch b.state {
+	case Closed:
+		if outcome == Ignore {
+			return
+		}
+		if now.Sub(b.windowStart) >= b.cfg.Window {
+			b.resetCounts(now)
+		}
+		b.total++
+		if outcome == Failure {
+			b.failures++
+		}
+		if slow {
+			b.slow++
+		}
+		if b.shouldOpen() {
+			b.setState(Open, now)
+		}
+	case HalfOpen:
+		b.probes--
+		switch {
+		case outcome == Ignore:
+		case outcome == Failure || slow:
+			b.setState(Open, now)
+		default:
+			b.successes++
+			if b.successes >= b.cfg.HalfOpenRequests {
+				b.setState(Closed, now)
+			}
+		}
+	}
+}
+
+func (b *Breaker) shouldOpen() bool {
+	if b.total < b.cfg.MinRequests {
+		return false
+	}
+	total := float64(b.total)
+	if float64(b.failures)/total >= b.cfg.FailureRatio {
+		return true
+	}
+	return b.cfg.SlowCallDuration > 0 && float64(b.slow)/total >= b.cfg.SlowCallRatio
+}
+
+func (b *Breaker) setState(state State, now time.Time) {
+	from := b.state
+	b.state = state
+	b.generation++
+	b.resetCounts(now)
+	b.probes, b.successes = 0, 0
+	if state == Open {
+		b.openUntil = now.Add(b.cfg.OpenDuration)
+	}
+	if b.onStateChange != nil {
+		b.onStateChange(from, state)
+	}
+}
+
+func (b *Breaker) resetCounts(now time.Time) {
+	b.windowStart = now
+	b.total, b.failures, b.slow = 0, 0, 0
+}
+
+// Set holds one breaker per name, created on first use.
+type Set struct {
+	cfg           Config
+	onStateChange func(name string, from, to State)
+
+	mu       sync.Mutex
+	breakers map[string]*Breaker
+}
+
+// NewSet returns a Set whose breakers report their transitions to
+// onStateChange, with the set or breaker locked. A new breaker reports a
+// transition from Closed to Closed.
+func NewSet(cfg Config, onStateChange func(name string, from, to State)) *Set {
+	return &Set{cfg: cfg, onStateChange: onStateChange, breakers: make(map[string]*Breaker)}
+}
+
+func (s *Set) Get(name string) *Breaker {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if b, ok := s.breakers[name]; ok {
+		return b
+	}
+	var onStateChange func(from, to State)
+	if s.onStateChange != nil {
+		onStateChange = func(from, to State) { s.onStateChange(name, from, to) }
+		onStateChange(Closed, Closed)
+	}
+	b := New(s.cfg, onStateChange)
+	s.breakers[name] = b
+	return b
+}
+
+// States returns the state of every breaker created so far.
+func (s *Set) States() map[string]State {
+	s.mu.Lock()
+	breakers := make(map[string]*Breaker, len(s.breakers))
+	for name, b := range s.breakers {
+		breakers[name] = b
+	}
+	s.mu.Unlock()
+
+	states := make(map[string]State, len(breakers))
+	for name, b := range breakers {
+		states[name] = b.State()
+	}
+	return states
+}
@@ -0,0 +1,241 @@
+package breaker
+
+import (
+	"errors"
+	"slices"
+	"testing"
+	"time"
+)
+
+var testConfig = Config{
+	Window:           10 * time.Second,
+	MinRequests:      4,
+	FailureRatio:     0.5,
+	SlowCallDuration: time.Second,
+	SlowCallRatio:    0.75,
+	OpenDuration:     15 * time.Second,
+	HalfOpenRequests: 2,
+}
+
+type transition struct{ from, to State }
+
+// testBreaker is a breaker on a clock that only moves when advanced.
+type testBreaker struct {
+	*Breaker
+	clock       time.Time
+	transitions []transition
+}
+
+func newTestBreaker(cfg Config) *testBreaker {
+	tb := &testBreaker{clock: time.Unix(0, 0)}
+	tb.Breaker = New(cfg, func(from, to State) { tb.transitions = append(tb.transitions, transition{from, to}) })
+	tb.now = func() time.Time { return tb.clock }
+	tb.windowStart = tb.clock
+	return tb
+}
+
+func (tb *testBreaker) advance(d time.Duration) {
+	tb.clock = tb.clock.Add(d)
+}
+
+// call makes one allowed call with outcome and latency.
+func (tb *testBreaker) call(t *testing.T, outcome Outcome, latency time.Duration) {
+	t.Helper()
+	done, err := tb.Allow()
+	if err != nil {
+		t.Fatalf("call rejected in state %v: %v", tb.State(), err)
+	}
+	done(outcome, latency)
+}
+
+// open trips the breaker with failed calls.
+func (tb *testBreaker) open(t *testing.T) {
+	t.Helper()
+	for i := 0; i < tb.cfg.MinRequests; i++ {
+		tb.call(t, Failure, 0)
+	}
+	if tb.State() != Open {
+		t.Fatalf("state = %v after %d failures, want open", tb.State(), tb.cfg.MinRequests)
+	}
+}
+
+func TestBreakerOpensOnFailureRatio(t *testing.T) {
+	tb := newTestBreaker(testConfig)
+	tb.call(t, Failure, 0)
+	tb.call(t, Success, 0)
+	tb.call(t, Failure, 0)
+	if tb.State() != Closed {
+		t.Fatalf("state = %v below MinRequests, want closed", tb.State())
+	}
+	tb.call(t, Success, 0)
+	if tb.State() != Open {
+		t.Fatalf("state = %v with half the calls failed, want open", tb.State())
+	}
+
+	_, err := tb.Allow()
+	var openErr *OpenError
+	if !errors.As(err, &openErr) || openErr.RetryAfter != testConfig.OpenDuration {
+		t.Errorf("Allow err = %v, want an OpenError retrying after %v", err, testConfig.OpenDuration)
+	}
+}
+
+func TestBreakerOpensOnSlowCallRatio(t *testing.T) {
+	tb := newTestBreaker(testConfig)
+	for i := 0; i < 3; i++ {
+		tb.call(t, Success, 2*time.Second)
+	}
+	tb.call(t, Success, 0)
+	if tb.State() != Open {
+		t.Fatalf("state = %v with three in four calls slow, want open", tb.State())
+	}
+}
+
+func TestBreakerStartsNewWindow(t *testing.T) {
+	tb := newTestBreaker(testConfig)
+	tb.call(t, Failure, 0)
+	tb.call(t, Failure, 0)
+	tb.call(t, Failure, 0)
+	tb.advance(testConfig.Window)
+	tb.call(t, Failure, 0)
+	if tb.State() != Closed {
+		t.Fatalf("state = %v, want failures of the previous window forgotten", tb.State())
+	}
+}
+
+func TestBreakerIgnoredCallsDoNotCount(t *testing.T) {
+	tb := newTestBreaker(testConfig)
+	for i := 0; i < 3; i++ {
+		tb.call(t, Failure, 0)
+	}
+	tb.call(t, Ignore, 0)
+	if tb.State() != Closed {
+		t.Fatalf("state = %v, want an ignored call not to reach MinRequests", tb.State())
+	}
+}
+
+func TestBreakerHalfOpensAfterOpenDuration(t *testing.T) {
+	tb := newTestBreaker(testConfig)
+	tb.open(t)
+
+	tb.advance(testConfig.OpenDuration - time.Millisecond)
+	_, err := tb.Allow()
+	var openErr *OpenError
+	if !errors.As(err, &openErr) || openErr.RetryAfter != time.Millisecond {
+		t.Fatalf("Allow err = %v, want an OpenError retrying after 1ms", err)
+	}
+
+	tb.advance(time.Millisecond)
+	if tb.State() != HalfOpen {
+		t.Fatalf("state = %v after the open duration, want half-open", tb.State())
+	}
+}
+
+func TestBreakerHalfOpenBoundsProbes(t *testing.T) {
+	tb := newTestBreaker(testConfig)
+	tb.open(t)
+	tb.advance(testConfig.OpenDuration)
+
+	var dones []func(Outcome, time.Duration)
+	for i := 0; i < testConfig.HalfOpenRequests; i++ {
+		done, err := tb.Allow()
+		if err != nil {
+			t.Fatalf("probe %d rejected: %v", i, err)
+		}
+		dones = append(dones, done)
+	}
+	_, err := tb.Allow()
+	var openErr *OpenError
+	if !errors.As(err, &openErr) || openErr.RetryAfter != halfOpenRetryAfter {
+		t.Fatalf("Allow err = %v with all probes in flight, want an OpenError retrying after %v", err, halfOpenRetryAfter)
+	}
+
+	dones[0](Ignore, 0)
+	if _, err := tb.Allow(); err != nil {
+		t.Errorf("Allow err = %v after an ignored probe, want its slot back", err)
+	}
+}
+
+func TestBreakerHalfOpenTransitions(t *testing.T) {
+	tests := []struct {
+		name      string
+		outcomes  []Outcome
+		latency   time.Duration
+		wantState State
+	}{
+		{name: "successful probes close", outcomes: []Outcome{Success, Success}, wantState: Closed},
+		{name: "failed probe reopens", outcomes: []Outcome{Success, Failure}, wantState: Open},
+		{name: "slow probe reopens", outcomes: []Outcome{Success}, latency: 2 * time.Second, wantState: Open},
+		{name: "too few probes stay half-open", outcomes: []Outcome{Success}, wantState: HalfOpen},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tb := newTestBreaker(testConfig)
+			tb.open(t)
+			tb.advance(testConfig.OpenDuration)
+			for _, outcome := range tt.outcomes {
+				tb.call(t, outcome, tt.latency)
+			}
+			if tb.State() != tt.wantState {
+				t.Errorf("state = %v, want %v", tb.State(), tt.wantState)
+			}
+		})
+	}
+}
+
+func TestBreakerReportsTransitions(t *testing.T) {
+	tb := newTestBreaker(testConfig)
+	tb.open(t)
+	tb.advance(testConfig.OpenDuration)
+	tb.call(t, Failure, 0)
+	tb.advance(testConfig.OpenDuration)
+	tb.call(t, Success, 0)
+	tb.call(t, Success, 0)
+
+	want := []transition{{Closed, Open}, {Open, HalfOpen}, {HalfOpen, Open}, {Open, HalfOpen}, {HalfOpen, Closed}}
+	if !slices.Equal(tb.transitions, want) {
+		t.Errorf("transitions = %v, want %v", tb.transitions, want)
+	}
+}
+
+func TestBreakerIgnoresOutcomesOfEarlierGeneration(t *testing.T) {
+	tb := newTestBreaker(testConfig)
+	done, err := tb.Allow()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tb.open(t)
+	tb.advance(testConfig.OpenDuration)
+	if tb.State() != HalfOpen {
+		t.Fatalf("state = %v, want half-open", tb.State())
+	}
+
+	// A call allowed while closed finishes during the half-open state; it
+	// must neither count as a probe nor reopen the breaker.
+	done(Failure, 0)
+	if tb.State() != HalfOpen {
+		t.Errorf("state = %v after a stale failure, want half-open", tb.State())
+	}
+	tb.call(t, Success, 0)
+	tb.call(t, Success, 0)
+	if tb.State() != Closed {
+		t.Errorf("state = %v after the probes succeeded, want closed", tb.State())
+	}
+}
+
+func TestSetCreatesOneBreakerPerName(t *testing.T) {
+	var reported []string
+	set := NewSet(testConfig, func(name string, from, to State) {
+		reported = append(reported, name+":"+from.String()+"->"+to.String())
+	})
+	if set.Get("Get") != set.Get("Get") {
+		t.Fatal("Get returned a new breaker for a known name")
+	}
+	set.Get("List")
+
+	if want := []string{"Get:closed->closed", "List:closed->closed"}; !slices.Equal(reported, want) {
+		t.Errorf("reported = %v, want %v", reported, want)
+	}
+	if states := set.States(); len(states) != 2 || states["Get"] != Closed || states["List"] != Closed {
+		t.Errorf("States = %v, want two closed breakers", states)
+	}
+}
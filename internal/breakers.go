@@ -0,0 +1,127 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/ilivestrong/oms-gateway/internal/breaker"
+	"github.com/ilivestrong/oms-gateway/internal/metrics"
+	"github.com/ilivestrong/oms-gateway/internal/middlewares"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+// healthServicePrefix is the method prefix of grpc.health.v1, whose checks
+// must reach the backends even while their breakers are open.
+const healthServicePrefix = "/grpc.health.v1.Health/"
+
+// breakerFailureCodes are the codes that tell a backend is failing or
+// overloaded. Other errors are answers from a working backend.
+var breakerFailureCodes = map[codes.Code]bool{
+	codes.Unavailable:       true,
+	codes.DeadlineExceeded:  true,
+	codes.Internal:          true,
+	codes.Unknown:           true,
+	codes.ResourceExhausted: true,
+	codes.DataLoss:          true,
+}
+
+// newBreakers returns the circuit breakers of a backend, one per method,
+// which report their state in the metrics and log their transitions. It
+// returns nil when breakers are disabled.
+func newBreakers(backend string, opts *Options, logger *slog.Logger) *breaker.Set {
+	if !opts.CircuitBreaker.Enabled() {
+		return nil
+	}
+	return breaker.NewSet(opts.CircuitBreaker, func(method string, from, to breaker.State) {
+		opts.Metrics.CircuitBreakerStateChanged(backend, method, from.String(), to.String())
+		if from == to {
+			return
+		}
+		level := slog.LevelInfo
+		if to == breaker.Open {
+			level = slog.LevelWarn
+		}
+		logger.Log(context.Background(), level, "circuit breaker state changed",
+			"backend", backend,
+			"method", metrics.BackendMethod(method),
+			"from", from.String(),
+			"to", to.String(),
+		)
+	})
+}
+
+// breakerInterceptor fails calls fast with Unavailable while the breaker of
+// their method is open. It runs before the retries, so a call counts once
+// with the latency of all its attempts.
+func breakerInterceptor(backend string, breakers *breaker.Set, m *metrics.Metrics) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		if strings.HasPrefix(method, healthServicePrefix) {
+			return invoker(ctx, method, req, reply, cc, opts...)
+		}
+
+		done, err := breakers.Get(method).Allow()
+		if err != nil {
+			var openErr *breaker.OpenError
+			errors.As(err, &openErr)
+			m.CircuitBreakerRejected(backend, method)
+			return circuitOpenError(backend, method, openErr.RetryAfter)
+		}
+
+		start := time.Now()
+		err = invoker(ctx, method, req, reply, cc, opts...)
+		done(breakerOutcome(ctx, err), time.Since(start))
+		return err
+	}
+}
+
+// breakerOutcome classifies a call. Calls whose caller gave up, through its
+// own cancellation or deadline, say nothing about the backend.
+func breakerOutcome(ctx context.Context, err error) breaker.Outcome {
+	switch {
+	case err == nil:
+		return breaker.Success
+	case ctx.Err() != nil:
+		return breaker.Ignore
+	case breakerFailureCodes[status.Code(err)]:
+		return breaker.Failure
+	}
+	return breaker.Success
+}
+
+func circuitOpenError(backend, method string, retryAfter time.Duration) error {
+	st := status.New(codes.Unavailable, fmt.Sprintf("%s is failing, calls to it are suspended", metrics.BackendMethod(method)))
+	st, err := st.WithDetails(
+		&errdetails.ErrorInfo{
+			Reason:   middlewares.CodeCircuitOpen,
+			Domain:   middlewares.ErrorDomain,
+			Metadata: map[string]string{"backend": backend, "method": metrics.BackendMethod(method)},
+		},
+		&errdetails.RetryInfo{RetryDelay: durationpb.New(retryAfter)},
+	)
+	if err != nil {
+		return status.Error(codes.Unavailable, "circuit breaker is open")
+	}
+	return st.Err()
+}
+
+// CircuitStates returns the state of each circuit breaker of backend keyed by
+// method, e.g. "ProductService/Get".
+func (svc *Service) CircuitStates(backend string) map[string]string {
+	breakers := svc.breakers[backend]
+	if breakers == nil {
+		return nil
+	}
+	states := make(map[string]string)
+	for method, state := range breakers.States() {
+		states[metrics.BackendMethod(method)] = state.String()
+	}
+	return states
+}
@@ -0,0 +1,306 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/ilivestrong/oms-gateway/internal/breaker"
+	"github.com/ilivestrong/oms-gateway/internal/metrics"
+	"github.com/ilivestrong/oms-gateway/internal/middlewares"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/stats"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	DefaultBackendTimeout        = 5 * time.Second
+	DefaultRetryMaxAttempts      = 3
+	DefaultRetryInitialBackoff   = 100 * time.Millisecond
+	DefaultRetryMaxBackoff       = time.Second
+	DefaultHedgingMaxAttempts    = 2
+	retryBackoffMultiplier       = 2
+	hedgedMethod                 = "/oms.ProductService/Get"
+	productServiceName           = "oms.ProductService"
+	orderServiceName             = "oms.OrderService"
+	retryableStatusCode          = "UNAVAILABLE"
+	backendMethodSeparator       = "/"
+	backendTimeoutRuleSeparator  = "="
+	backendTimeoutRulesSeparator = ","
+)
+
+// idempotentMethods are retried automatically. Creates, updates and deletes
+// are not, as a retry after a lost response could apply them twice.
+var idempotentMethods = map[string][]string{
+	productServiceName: {"Get", "List"},
+	orderServiceName:   {"List"},
+}
+
+// RetryPolicy configures the retries of idempotent backend calls that fail
+// with Unavailable. MaxAttempts includes the first attempt; 1 disables
+// retries.
+type RetryPolicy struct {
+	MaxAttempts    int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+}
+
+// HedgingPolicy sends another ProductService.Get when the previous attempts
+// have not answered within Delay, or failed with Unavailable, and uses the
+// first answer. A zero Delay disables hedging.
+type HedgingPolicy struct {
+	MaxAttempts int
+	Delay       time.Duration
+}
+
+// CallPolicy bounds and retries the RPCs made to the backends.
+type CallPolicy struct {
+	// Timeout applies to calls without an entry in Timeouts.
+	Timeout time.Duration
+	// Timeouts is keyed by "Service/Method", e.g. "ProductService/Get".
+	Timeouts map[string]time.Duration
+	Retry    RetryPolicy
+	Hedging  HedgingPolicy
+}
+
+// ParseBackendTimeouts parses a comma separated list such as
+// "ProductService/Get=1s,OrderService/Create=10s".
+func ParseBackendTimeouts(s string) (map[string]time.Duration, error) {
+	timeouts := make(map[string]time.Duration)
+	for _, rule := range strings.Split(s, backendTimeoutRulesSeparator) {
+		rule = strings.TrimSpace(rule)
+		if rule == "" {
+			continue
+		}
+		method, value, found := strings.Cut(rule, backendTimeoutRuleSeparator)
+		if !found || !strings.Contains(method, backendMethodSeparator) {
+			return nil, fmt.Errorf("invalid backend timeout %q, expected Service/Method=duration", rule)
+		}
+		timeout, err := time.ParseDuration(value)
+		if err != nil || timeout <= 0 {
+			return nil, fmt.Errorf("invalid backend timeout %q: timeout must be a positive duration", rule)
+		}
+		timeouts[strings.TrimSpace(method)] = timeout
+	}
+	return timeouts, nil
+}
+
+// serviceConfig returns the default service config of a backend connection,
+// which holds the retry policy of its idempotent methods.
+func serviceConfig(service string, policy CallPolicy) string {
+	type methodName struct {
+		Service string `json:"service"`
+		Method  string `json:"method"`
+	}
+	type retryPolicy struct {
+		MaxAttempts          int      `json:"maxAttempts"`
+		InitialBackoff       string   `json:"initialBackoff"`
+		MaxBackoff           string   `json:"maxBackoff"`
+		BackoffMultiplier    float64  `json:"backoffMultiplier"`
+		RetryableStatusCodes []string `json:"retryableStatusCodes"`
+	}
+	type methodConfig struct {
+		Name        []methodName `json:"name"`
+		RetryPolicy *retryPolicy `json:"retryPolicy,omitempty"`
+	}
+
+	var names []methodName
+	for _, method := range idempotentMethods[service] {
+		// Hedged calls are re-sent by the hedging interceptor instead.
+		if policy.Hedging.Delay > 0 && "/"+service+"/"+method == hedgedMethod {
+			continue
+		}
+		names = append(names, methodName{Service: service, Method: method})
+	}
+	if policy.Retry.MaxAttempts < 2 || len(names) == 0 {
+		return "{}"
+	}
+
+	config, _ := json.Marshal(struct {
+		MethodConfig []methodConfig `json:"methodConfig"`
+	}{[]methodConfig{{
+		Name: names,
+		RetryPolicy: &retryPolicy{
+			MaxAttempts:          policy.Retry.MaxAttempts,
+			InitialBackoff:       formatSeconds(policy.Retry.InitialBackoff),
+			MaxBackoff:           formatSeconds(policy.Retry.MaxBackoff),
+			BackoffMultiplier:    retryBackoffMultiplier,
+			RetryableStatusCodes: []string{retryableStatusCode},
+		},
+	}}})
+	return string(config)
+}
+
+func formatSeconds(d time.Duration) string {
+	return strconv.FormatFloat(d.Seconds(), 'f', -1, 64) + "s"
+}
+
+// timeoutInterceptor gives every call the deadline configured for its
+// method, unless the caller's deadline is earlier. The deadline covers
+// retries and hedged attempts.
+func timeoutInterceptor(policy CallPolicy) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		timeout, ok := policy.Timeouts[metrics.BackendMethod(method)]
+		if !ok {
+			timeout = policy.Timeout
+		}
+		if timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, timeout)
+			defer cancel()
+		}
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+}
+
+// hedgingInterceptor implements policy for ProductService.Get, since
+// grpc-go does not support the hedgingPolicy of the service config.
+func hedgingInterceptor(policy HedgingPolicy) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		replyMsg, ok := reply.(proto.Message)
+		if method != hedgedMethod || policy.Delay <= 0 || policy.MaxAttempts < 2 || !ok {
+			return invoker(ctx, method, req, reply, cc, opts...)
+		}
+
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+
+		type result struct {
+			reply proto.Message
+			err   error
+		}
+		results := make(chan result, policy.MaxAttempts)
+		attempt := func() {
+			attemptReply := proto.Clone(replyMsg)
+			proto.Reset(attemptReply)
+			err := invoker(ctx, method, req, attemptReply, cc, opts...)
+			results <- result{attemptReply, err}
+		}
+
+		started, pending := 1, 1
+		go attempt()
+		timer := time.NewTimer(policy.Delay)
+		defer timer.Stop()
+
+		var lastErr error
+		for pending > 0 {
+			select {
+			case <-timer.C:
+				if started < policy.MaxAttempts {
+					started++
+					pending++
+					go attempt()
+					resetTimer(timer, policy.Delay)
+				}
+			case res := <-results:
+				pending--
+				if res.err == nil {
+					proto.Reset(replyMsg)
+					proto.Merge(replyMsg, res.reply)
+					return nil
+				}
+				lastErr = res.err
+				if status.Code(res.err) != codes.Unavailable {
+					return res.err
+				}
+				if started < policy.MaxAttempts {
+					started++
+					pending++
+					go attempt()
+					resetTimer(timer, policy.Delay)
+				}
+			}
+		}
+		return lastErr
+	}
+}
+
+// resetTimer restarts timer for d. A tick that fired but was not received yet
+// is dropped first, so it cannot start the next hedge early.
+func resetTimer(timer *time.Timer, d time.Duration) {
+	if !timer.Stop() {
+		select {
+		case <-timer.C:
+		default:
+		}
+	}
+	timer.Reset(d)
+}
+
+type attemptsKey struct{}
+
+// attemptCounter is a stats handler counting the attempts of each call,
+// including the ones made by retries and hedging. Transparent retries, which
+// never reached the backend, are not counted.
+type attemptCounter struct{}
+
+func (attemptCounter) TagRPC(ctx context.Context, _ *stats.RPCTagInfo) context.Context {
+	return ctx
+}
+
+func (attemptCounter) HandleRPC(ctx context.Context, s stats.RPCStats) {
+	if begin, ok := s.(*stats.Begin); ok && begin.IsClient() && !begin.IsTransparentRetryAttempt {
+		if attempts, ok := ctx.Value(attemptsKey{}).(*atomic.Int32); ok {
+			attempts.Add(1)
+		}
+	}
+}
+
+func (attemptCounter) TagConn(ctx context.Context, _ *stats.ConnTagInfo) context.Context {
+	return ctx
+}
+
+func (attemptCounter) HandleConn(context.Context, stats.ConnStats) {}
+
+// attemptsInterceptor reports the number of attempts each call took in the
+// metrics, the access log and, for calls that needed more than one, a log
+// line of their own.
+func attemptsInterceptor(backend string, opts *Options, logger *slog.Logger) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, callOpts ...grpc.CallOption) error {
+		attempts := new(atomic.Int32)
+		err := invoker(context.WithValue(ctx, attemptsKey{}, attempts), method, req, reply, cc, callOpts...)
+
+		n := int(attempts.Load())
+		opts.Metrics.ObserveBackendAttempts(backend, method, n)
+		middlewares.AddBackendAttempts(ctx, n)
+		if n > 1 {
+			logger.InfoContext(ctx, "backend call needed several attempts",
+				"backend", backend,
+				"method", metrics.BackendMethod(method),
+				"attempts", n,
+				"code", status.Code(err).String(),
+				"request_id", middlewares.RequestIDFromContext(ctx),
+			)
+		}
+		return err
+	}
+}
+
+// dialOptions returns the options shared by the backend connections. The
+// interceptors run in order, so calls rejected by a circuit breaker never
+// reach the backend metrics, the metrics cover all attempts of a call and the
+// timeout covers every hedged attempt. breakers may be nil.
+func dialOptions(backend, service string, breakers *breaker.Set, opts *Options, logger *slog.Logger) []grpc.DialOption {
+	interceptors := []grpc.UnaryClientInterceptor{middlewares.ForwardRequestID}
+	if breakers != nil {
+		interceptors = append(interceptors, breakerInterceptor(backend, breakers, opts.Metrics))
+	}
+	interceptors = append(interceptors,
+		opts.Metrics.UnaryClientInterceptor(backend),
+		attemptsInterceptor(backend, opts, logger),
+		timeoutInterceptor(opts.BackendCalls),
+		hedgingInterceptor(opts.BackendCalls.Hedging),
+	)
+	return []grpc.DialOption{
+		grpc.WithDefaultServiceConfig(serviceConfig(service, opts.BackendCalls)),
+		grpc.WithStatsHandler(attemptCounter{}),
+		grpc.WithChainUnaryInterceptor(interceptors...),
+	}
+}
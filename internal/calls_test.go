@@ -0,0 +1,163 @@
+package internal
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	omspb "github.com/ilivestrong/oms-gateway/internal/protos"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+const testHedgeDelay = 50 * time.Millisecond
+
+// fakeInvoker answers the nth attempt, counting from 0, with answers[n]. An
+// attempt without an answer blocks until its context is done.
+type fakeInvoker struct {
+	answers []func(ctx context.Context, reply *omspb.Product) error
+
+	mu     sync.Mutex
+	starts []time.Time
+}
+
+func (f *fakeInvoker) invoke(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+	f.mu.Lock()
+	n := len(f.starts)
+	f.starts = append(f.starts, time.Now())
+	f.mu.Unlock()
+	if n < len(f.answers) && f.answers[n] != nil {
+		return f.answers[n](ctx, reply.(*omspb.Product))
+	}
+	<-ctx.Done()
+	return status.FromContextError(ctx.Err()).Err()
+}
+
+func (f *fakeInvoker) attemptStarts() []time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]time.Time(nil), f.starts...)
+}
+
+func answerProduct(id string) func(context.Context, *omspb.Product) error {
+	return func(_ context.Context, reply *omspb.Product) error {
+		reply.Id = id
+		return nil
+	}
+}
+
+func answerError(code codes.Code) func(context.Context, *omspb.Product) error {
+	return func(context.Context, *omspb.Product) error {
+		return status.Error(code, "failed")
+	}
+}
+
+func TestHedgingInterceptor(t *testing.T) {
+	tests := []struct {
+		name         string
+		method       string
+		answers      []func(context.Context, *omspb.Product) error
+		wantCode     codes.Code
+		wantID       string
+		wantAttempts int
+	}{
+		{
+			name:         "slow first attempt is hedged",
+			method:       hedgedMethod,
+			answers:      []func(context.Context, *omspb.Product) error{nil, answerProduct("hedge")},
+			wantID:       "hedge",
+			wantAttempts: 2,
+		},
+		{
+			name:         "unavailable attempt is replaced at once",
+			method:       hedgedMethod,
+			answers:      []func(context.Context, *omspb.Product) error{answerError(codes.Unavailable), answerProduct("second")},
+			wantID:       "second",
+			wantAttempts: 2,
+		},
+		{
+			name:         "other errors are returned",
+			method:       hedgedMethod,
+			answers:      []func(context.Context, *omspb.Product) error{answerError(codes.NotFound)},
+			wantCode:     codes.NotFound,
+			wantAttempts: 1,
+		},
+		{
+			name:   "attempts are bounded",
+			method: hedgedMethod,
+			answers: []func(context.Context, *omspb.Product) error{
+				answerError(codes.Unavailable), answerError(codes.Unavailable), answerError(codes.Unavailable),
+			},
+			wantCode:     codes.Unavailable,
+			wantAttempts: 3,
+		},
+		{
+			name:         "other methods are not hedged",
+			method:       "/oms.OrderService/Get",
+			answers:      []func(context.Context, *omspb.Product) error{answerError(codes.Unavailable)},
+			wantCode:     codes.Unavailable,
+			wantAttempts: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			invoker := &fakeInvoker{answers: tt.answers}
+			interceptor := hedgingInterceptor(HedgingPolicy{MaxAttempts: 3, Delay: testHedgeDelay})
+
+			reply := &omspb.Product{}
+			err := interceptor(context.Background(), tt.method, &omspb.GetProductRequest{ProductId: "7"}, reply, nil, invoker.invoke)
+			if status.Code(err) != tt.wantCode {
+				t.Fatalf("err = %v, want code %v", err, tt.wantCode)
+			}
+			if reply.GetId() != tt.wantID {
+				t.Errorf("reply id = %q, want %q", reply.GetId(), tt.wantID)
+			}
+			if got := len(invoker.attemptStarts()); got != tt.wantAttempts {
+				t.Errorf("attempts = %d, want %d", got, tt.wantAttempts)
+			}
+		})
+	}
+}
+
+func TestHedgingInterceptorWaitsFullDelayAfterReplacingAttempt(t *testing.T) {
+	invoker := &fakeInvoker{answers: []func(context.Context, *omspb.Product) error{
+		func(ctx context.Context, _ *omspb.Product) error {
+			time.Sleep(testHedgeDelay / 2)
+			return status.Error(codes.Unavailable, "failed")
+		},
+		nil,
+		answerProduct("third"),
+	}}
+	interceptor := hedgingInterceptor(HedgingPolicy{MaxAttempts: 3, Delay: testHedgeDelay})
+
+	reply := &omspb.Product{}
+	if err := interceptor(context.Background(), hedgedMethod, &omspb.GetProductRequest{}, reply, nil, invoker.invoke); err != nil {
+		t.Fatal(err)
+	}
+	if !proto.Equal(reply, &omspb.Product{Id: "third"}) {
+		t.Errorf("reply = %v, want the third attempt's", reply)
+	}
+	starts := invoker.attemptStarts()
+	if len(starts) != 3 {
+		t.Fatalf("attempts = %d, want 3", len(starts))
+	}
+	if gap := starts[2].Sub(starts[1]); gap < testHedgeDelay*9/10 {
+		t.Errorf("third attempt started %v after the second, want at least the hedging delay", gap)
+	}
+}
+
+func TestResetTimerDropsPendingTick(t *testing.T) {
+	timer := time.NewTimer(time.Millisecond)
+	defer timer.Stop()
+	time.Sleep(10 * time.Millisecond)
+
+	resetTimer(timer, testHedgeDelay)
+	select {
+	case <-timer.C:
+		t.Fatal("timer delivered the tick from before the reset")
+	case <-time.After(testHedgeDelay / 2):
+	}
+}
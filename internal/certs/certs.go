@@ -0,0 +1,93 @@
+// Package certs loads TLS certificates and CA bundles from disk and picks up
+// changes to the files without a restart.
+package certs
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"log/slog"
+	"os"
+)
+
+// KeyPair serves a certificate and private key that are reloaded when their
+// files change.
+type KeyPair struct {
+	r *reloader[*tls.Certificate]
+}
+
+// LoadKeyPair loads a key pair and logs its reloads to logger.
+func LoadKeyPair(certFile, keyFile string, logger *slog.Logger) (*KeyPair, error) {
+	r, err := newReloader(logger, func() (*tls.Certificate, error) {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load key pair %s: %w", certFile, err)
+		}
+		return &cert, nil
+	}, certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+	return &KeyPair{r: r}, nil
+}
+
+func (kp *KeyPair) Certificate() *tls.Certificate {
+	return kp.r.get()
+}
+
+// GetCertificate can be used as tls.Config.GetCertificate.
+func (kp *KeyPair) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return kp.Certificate(), nil
+}
+
+// GetClientCertificate can be used as tls.Config.GetClientCertificate.
+func (kp *KeyPair) GetClientCertificate(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	return kp.Certificate(), nil
+}
+
+// CertPool serves a bundle of PEM encoded CA certificates that is reloaded
+// when its file changes.
+type CertPool struct {
+	r *reloader[*x509.CertPool]
+}
+
+// LoadCertPool loads a CA bundle and logs its reloads to logger.
+func LoadCertPool(caFile string, logger *slog.Logger) (*CertPool, error) {
+	r, err := newReloader(logger, func() (*x509.CertPool, error) {
+		data, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(data) {
+			return nil, fmt.Errorf("CA file %s contains no certificates", caFile)
+		}
+		return pool, nil
+	}, caFile)
+	if err != nil {
+		return nil, err
+	}
+	return &CertPool{r: r}, nil
+}
+
+func (cp *CertPool) Pool() *x509.CertPool {
+	return cp.r.get()
+}
+
+// verifyChain verifies the peer's chain against roots the way crypto/tls
+// would, so roots can change after the tls.Config was built.
+func verifyChain(cs tls.ConnectionState, roots *x509.CertPool, dnsName string, usage x509.ExtKeyUsage) ([][]*x509.Certificate, error) {
+	if len(cs.PeerCertificates) == 0 {
+		return nil, fmt.Errorf("peer sent no certificate")
+	}
+	intermediates := x509.NewCertPool()
+	for _, cert := range cs.PeerCertificates[1:] {
+		intermediates.AddCert(cert)
+	}
+	return cs.PeerCertificates[0].Verify(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		DNSName:       dnsName,
+		KeyUsages:     []x509.ExtKeyUsage{usage},
+	})
+}
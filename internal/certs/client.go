@@ -0,0 +1,225 @@
+package certs
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// Mode is the transport security used to reach a backend.
+type Mode string
+
+const (
+	ModePlaintext Mode = "plaintext"
+	ModeTLS       Mode = "tls"
+	ModeMutualTLS Mode = "mtls"
+)
+
+func ParseMode(s string) (Mode, error) {
+	switch mode := Mode(strings.ToLower(strings.TrimSpace(s))); mode {
+	case "":
+		return ModePlaintext, nil
+	case ModePlaintext, ModeTLS, ModeMutualTLS:
+		return mode, nil
+	}
+	return "", fmt.Errorf("unknown transport security mode %q, expected plaintext, tls or mtls", s)
+}
+
+// ClientConfig describes how to secure the connection to one backend.
+type ClientConfig struct {
+	Mode Mode
+	// CAFile is a PEM bundle of the CAs trusted to sign the backend's
+	// certificate. The system roots are used when it is empty.
+	CAFile string
+	// CertFile and KeyFile hold the client certificate presented in ModeMutualTLS.
+	CertFile string
+	KeyFile  string
+	// ServerName overrides the name the backend's certificate is checked
+	// against, which defaults to the host of its address.
+	ServerName string
+}
+
+// ClientCredentials are gRPC transport credentials that remember the outcome
+// of the last handshake, so a backend rejecting the gateway's certificate, or
+// presenting one the gateway does not trust, shows up in logs and health
+// checks instead of only as an opaque Unavailable error.
+type ClientCredentials struct {
+	credentials.TransportCredentials
+	backend string
+	state   *handshakeState
+}
+
+type handshakeState struct {
+	logger *slog.Logger
+
+	mu      sync.Mutex
+	lastErr error
+}
+
+// NewClientCredentials builds the credentials for backend as described by
+// cfg. Certificates and CA bundles are reloaded when their files change.
+// Reloads and handshake failures are logged to logger, or to slog.Default()
+// if logger is nil.
+func NewClientCredentials(backend string, cfg ClientConfig, logger *slog.Logger) (*ClientCredentials, error) {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	creds, err := newTransportCredentials(cfg, logger)
+	if err != nil {
+		return nil, fmt.Errorf("backend %s: %w", backend, err)
+	}
+	return &ClientCredentials{TransportCredentials: creds, backend: backend, state: &handshakeState{logger: logger}}, nil
+}
+
+func newTransportCredentials(cfg ClientConfig, logger *slog.Logger) (credentials.TransportCredentials, error) {
+	if cfg.Mode == ModePlaintext || cfg.Mode == "" {
+		return insecure.NewCredentials(), nil
+	}
+
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12, ServerName: cfg.ServerName}
+	var roots *CertPool
+	if cfg.CAFile != "" {
+		var err error
+		roots, err = LoadCertPool(cfg.CAFile, logger)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	switch cfg.Mode {
+	case ModeTLS:
+	case ModeMutualTLS:
+		if cfg.CertFile == "" || cfg.KeyFile == "" {
+			return nil, fmt.Errorf("mtls needs a client certificate and key")
+		}
+		keyPair, err := LoadKeyPair(cfg.CertFile, cfg.KeyFile, logger)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.GetClientCertificate = keyPair.GetClientCertificate
+	default:
+		return nil, fmt.Errorf("unknown transport security mode %q", cfg.Mode)
+	}
+	if roots != nil {
+		return &reloadingRootsCredentials{TransportCredentials: credentials.NewTLS(tlsConfig), config: tlsConfig, roots: roots}, nil
+	}
+	return credentials.NewTLS(tlsConfig), nil
+}
+
+// reloadingRootsCredentials verify the backend's certificate against the
+// current CA bundle. crypto/tls only verifies against a fixed pool, so
+// verification is done in VerifyConnection instead. The name to check is
+// captured before each handshake: the connection state only carries the name
+// sent as SNI, which is empty for IP addresses and would skip the check.
+type reloadingRootsCredentials struct {
+	credentials.TransportCredentials
+	config *tls.Config
+	roots  *CertPool
+}
+
+func (c *reloadingRootsCredentials) ClientHandshake(ctx context.Context, authority string, rawConn net.Conn) (net.Conn, credentials.AuthInfo, error) {
+	serverName := c.config.ServerName
+	if serverName == "" {
+		host, _, err := net.SplitHostPort(authority)
+		if err != nil {
+			host = authority
+		}
+		serverName = host
+	}
+	if serverName == "" {
+		return nil, nil, fmt.Errorf("no server name to verify the certificate of %q against", authority)
+	}
+
+	config := c.config.Clone()
+	config.ServerName = serverName
+	config.InsecureSkipVerify = true
+	config.VerifyConnection = func(cs tls.ConnectionState) error {
+		_, err := verifyChain(cs, c.roots.Pool(), serverName, x509.ExtKeyUsageServerAuth)
+		return err
+	}
+	return credentials.NewTLS(config).ClientHandshake(ctx, authority, rawConn)
+}
+
+func (c *reloadingRootsCredentials) Clone() credentials.TransportCredentials {
+	return &reloadingRootsCredentials{TransportCredentials: c.TransportCredentials.Clone(), config: c.config.Clone(), roots: c.roots}
+}
+
+// ClientHandshake records handshake failures. With TLS 1.3 the backend only
+// checks the client certificate after the client considers the handshake
+// done, so the outcome is settled by the first read from the connection: a
+// TLS alert fails the handshake, data completes it.
+func (c *ClientCredentials) ClientHandshake(ctx context.Context, authority string, rawConn net.Conn) (net.Conn, credentials.AuthInfo, error) {
+	conn, authInfo, err := c.TransportCredentials.ClientHandshake(ctx, authority, rawConn)
+	if err != nil {
+		c.state.record(c.backend, authority, err)
+		return conn, authInfo, err
+	}
+	if _, ok := authInfo.(credentials.TLSInfo); !ok {
+		return conn, authInfo, nil
+	}
+	return &handshakeConn{Conn: conn, backend: c.backend, authority: authority, state: c.state}, authInfo, nil
+}
+
+func (s *handshakeState) record(backend, authority string, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err != nil {
+		s.logger.Error("backend TLS handshake failed", "backend", backend, "authority", authority, "err", err)
+		s.lastErr = fmt.Errorf("TLS handshake with %s failed: %w", authority, err)
+		return
+	}
+	if s.lastErr != nil {
+		s.logger.Info("backend TLS handshake succeeded", "backend", backend, "authority", authority)
+	}
+	s.lastErr = nil
+}
+
+// handshakeConn reports the outcome of the handshake on its first read.
+type handshakeConn struct {
+	net.Conn
+	backend   string
+	authority string
+	state     *handshakeState
+	settled   atomic.Bool
+}
+
+func (c *handshakeConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	if c.settled.Load() {
+		return n, err
+	}
+
+	var opErr *net.OpError
+	switch {
+	case n > 0:
+		c.settled.Store(true)
+		c.state.record(c.backend, c.authority, nil)
+	case errors.As(err, &opErr) && opErr.Op == "remote error":
+		// crypto/tls reports alerts sent by the peer as "remote error".
+		c.settled.Store(true)
+		c.state.record(c.backend, c.authority, err)
+	}
+	return n, err
+}
+
+func (c *ClientCredentials) Clone() credentials.TransportCredentials {
+	return &ClientCredentials{TransportCredentials: c.TransportCredentials.Clone(), backend: c.backend, state: c.state}
+}
+
+// HandshakeError returns the error of the last handshake, or nil if it
+// succeeded or none was attempted yet.
+func (c *ClientCredentials) HandshakeError() error {
+	c.state.mu.Lock()
+	defer c.state.mu.Unlock()
+	return c.state.lastErr
+}
@@ -0,0 +1,144 @@
+package certs
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	file string
+}
+
+func newTestCA(t *testing.T) *testCA {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file := filepath.Join(t.TempDir(), "ca.pem")
+	if err := os.WriteFile(file, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return &testCA{cert: cert, key: key, file: file}
+}
+
+// issue returns a server certificate for the given DNS names and IPs.
+func (ca *testCA) issue(t *testing.T, dnsNames []string, ips []net.IP) tls.Certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "backend"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		DNSNames:     dnsNames,
+		IPAddresses:  ips,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+// serveTLS accepts TLS connections on a loopback IP address with cert and
+// returns the address.
+func serveTLS(t *testing.T, cert tls.Certificate) string {
+	t.Helper()
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: []tls.Certificate{cert}, NextProtos: []string{"h2"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				conn.(*tls.Conn).Handshake()
+			}()
+		}
+	}()
+	return listener.Addr().String()
+}
+
+func TestClientCredentialsVerifyServerName(t *testing.T) {
+	ca := newTestCA(t)
+	tests := []struct {
+		name       string
+		dnsNames   []string
+		ips        []net.IP
+		serverName string
+		wantErr    bool
+	}{
+		{name: "certificate for the IP address", ips: []net.IP{net.IPv4(127, 0, 0, 1)}},
+		{name: "certificate for another name", dnsNames: []string{"other.example.com"}, wantErr: true},
+		{name: "certificate for another IP address", ips: []net.IP{net.IPv4(10, 0, 0, 1)}, wantErr: true},
+		{name: "server name override", dnsNames: []string{"backend.example.com"}, serverName: "backend.example.com"},
+		{name: "server name override with another name", dnsNames: []string{"other.example.com"}, serverName: "backend.example.com", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			addr := serveTLS(t, ca.issue(t, tt.dnsNames, tt.ips))
+			creds, err := NewClientCredentials("product", ClientConfig{Mode: ModeTLS, CAFile: ca.file, ServerName: tt.serverName}, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			rawConn, err := net.Dial("tcp", addr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer rawConn.Close()
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			_, _, err = creds.ClientHandshake(ctx, addr, rawConn)
+			if gotErr := err != nil; gotErr != tt.wantErr {
+				t.Fatalf("handshake err = %v, want error %v", err, tt.wantErr)
+			}
+			if gotErr := creds.HandshakeError() != nil; gotErr != tt.wantErr {
+				t.Errorf("HandshakeError = %v, want error %v", creds.HandshakeError(), tt.wantErr)
+			}
+		})
+	}
+}
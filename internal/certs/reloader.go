@@ -0,0 +1,87 @@
+package certs
+
+import (
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+)
+
+// reloadCheckInterval bounds how often the files behind a reloader are
+// checked for changes.
+const reloadCheckInterval = 10 * time.Second
+
+// reloader caches a value loaded from files and loads it again once any of
+// the files has a new modification time. A value that fails to load does not
+// replace the current one, so a half written certificate never takes effect.
+type reloader[T any] struct {
+	files  []string
+	load   func() (T, error)
+	logger *slog.Logger
+
+	mu        sync.Mutex
+	value     T
+	modTimes  []time.Time
+	lastCheck time.Time
+}
+
+// newReloader loads the value and logs later reloads to logger, or to
+// slog.Default() if logger is nil.
+func newReloader[T any](logger *slog.Logger, load func() (T, error), files ...string) (*reloader[T], error) {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	r := &reloader[T]{files: files, load: load, logger: logger}
+	value, err := load()
+	if err != nil {
+		return nil, err
+	}
+	r.value = value
+	r.modTimes = r.stat()
+	r.lastCheck = time.Now()
+	return r, nil
+}
+
+func (r *reloader[T]) get() T {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(r.lastCheck) < reloadCheckInterval {
+		return r.value
+	}
+	r.lastCheck = now
+
+	modTimes := r.stat()
+	if equalTimes(modTimes, r.modTimes) {
+		return r.value
+	}
+	value, err := r.load()
+	if err != nil {
+		r.logger.Error("failed to reload certificates, keeping current", "files", r.files, "err", err)
+		return r.value
+	}
+	r.logger.Info("reloaded certificates", "files", r.files)
+	r.value = value
+	r.modTimes = modTimes
+	return r.value
+}
+
+func (r *reloader[T]) stat() []time.Time {
+	modTimes := make([]time.Time, len(r.files))
+	for i, file := range r.files {
+		if info, err := os.Stat(file); err == nil {
+			modTimes[i] = info.ModTime()
+		}
+	}
+	return modTimes
+}
+
+func equalTimes(a, b []time.Time) bool {
+	for i := range a {
+		if !a[i].Equal(b[i]) {
+			return false
+		}
+	}
+	return true
+}
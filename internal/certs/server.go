@@ -0,0 +1,138 @@
+package certs
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+)
+
+// ClientAuth decides whether the public listener asks callers for a
+// certificate.
+type ClientAuth string
+
+const (
+	ClientAuthNone ClientAuth = "none"
+	// ClientAuthRequest verifies a certificate when the caller sends one.
+	ClientAuthRequest ClientAuth = "request"
+	// ClientAuthRequire rejects callers without a valid certificate.
+	ClientAuthRequire ClientAuth = "require"
+)
+
+func ParseClientAuth(s string) (ClientAuth, error) {
+	switch clientAuth := ClientAuth(strings.ToLower(strings.TrimSpace(s))); clientAuth {
+	case "":
+		return ClientAuthNone, nil
+	case ClientAuthNone, ClientAuthRequest, ClientAuthRequire:
+		return clientAuth, nil
+	}
+	return "", fmt.Errorf("unknown client auth %q, expected none, request or require", s)
+}
+
+// ParseTLSVersion accepts "1.2" or "1.3".
+func ParseTLSVersion(s string) (uint16, error) {
+	switch strings.TrimSpace(s) {
+	case "", "1.2":
+		return tls.VersionTLS12, nil
+	case "1.3":
+		return tls.VersionTLS13, nil
+	}
+	return 0, fmt.Errorf("unsupported TLS version %q, expected 1.2 or 1.3", s)
+}
+
+// ParseCipherSuites parses a comma separated list of cipher suite names as
+// returned by tls.CipherSuiteName. Only suites crypto/tls considers secure are
+// accepted. The list only applies to TLS 1.2; TLS 1.3 suites are not
+// configurable.
+func ParseCipherSuites(s string) ([]uint16, error) {
+	var ids []uint16
+	for _, name := range strings.Split(s, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		i := slices.IndexFunc(tls.CipherSuites(), func(suite *tls.CipherSuite) bool { return suite.Name == name })
+		if i < 0 {
+			return nil, fmt.Errorf("unknown or insecure cipher suite %q", name)
+		}
+		ids = append(ids, tls.CipherSuites()[i].ID)
+	}
+	return ids, nil
+}
+
+// ServerConfig describes TLS on the gateway's own listeners.
+type ServerConfig struct {
+	CertFile     string
+	KeyFile      string
+	MinVersion   uint16
+	CipherSuites []uint16
+	// ClientCAFile is a PEM bundle of the CAs trusted to sign client
+	// certificates. It is required unless ClientAuth is ClientAuthNone.
+	ClientCAFile string
+	ClientAuth   ClientAuth
+}
+
+// NewServerTLSConfig builds a tls.Config that reloads the server certificate
+// and the client CA bundle when their files change. Reloads are logged to
+// logger.
+func NewServerTLSConfig(cfg ServerConfig, logger *slog.Logger) (*tls.Config, error) {
+	keyPair, err := LoadKeyPair(cfg.CertFile, cfg.KeyFile, logger)
+	if err != nil {
+		return nil, err
+	}
+	tlsConfig := &tls.Config{
+		MinVersion:     cfg.MinVersion,
+		CipherSuites:   cfg.CipherSuites,
+		GetCertificate: keyPair.GetCertificate,
+	}
+	if tlsConfig.MinVersion == 0 {
+		tlsConfig.MinVersion = tls.VersionTLS12
+	}
+
+	if cfg.ClientAuth == ClientAuthNone || cfg.ClientAuth == "" {
+		return tlsConfig, nil
+	}
+	if cfg.ClientCAFile == "" {
+		return nil, fmt.Errorf("client auth %q needs a client CA file", cfg.ClientAuth)
+	}
+	clientCAs, err := LoadCertPool(cfg.ClientCAFile, logger)
+	if err != nil {
+		return nil, err
+	}
+
+	// Certificates are verified in VerifyConnection against the current
+	// bundle, since crypto/tls would only verify against a fixed pool.
+	tlsConfig.ClientAuth = tls.RequestClientCert
+	if cfg.ClientAuth == ClientAuthRequire {
+		tlsConfig.ClientAuth = tls.RequireAnyClientCert
+	}
+	tlsConfig.VerifyConnection = func(cs tls.ConnectionState) error {
+		if len(cs.PeerCertificates) == 0 {
+			return nil
+		}
+		_, err := verifyChain(cs, clientCAs.Pool(), "", x509.ExtKeyUsageClientAuth)
+		return err
+	}
+	return tlsConfig, nil
+}
+
+// PeerIdentity returns the identity of the client certificate of a
+// connection accepted with a config from NewServerTLSConfig, which only
+// accepts verified certificates. The identity is the first DNS name of the
+// certificate, then its first URI, then its common name. It is empty when the
+// caller sent no certificate.
+func PeerIdentity(cs *tls.ConnectionState) string {
+	if cs == nil || len(cs.PeerCertificates) == 0 {
+		return ""
+	}
+	cert := cs.PeerCertificates[0]
+	switch {
+	case len(cert.DNSNames) > 0:
+		return cert.DNSNames[0]
+	case len(cert.URIs) > 0:
+		return cert.URIs[0].String()
+	}
+	return cert.Subject.CommonName
+}
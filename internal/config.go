@@ -1,10 +1,44 @@
 package internal
 
-import "time"
+import (
+	"log/slog"
+	"time"
+
+	"github.com/ilivestrong/oms-gateway/internal/auth"
+	"github.com/ilivestrong/oms-gateway/internal/breaker"
+	"github.com/ilivestrong/oms-gateway/internal/certs"
+	"github.com/ilivestrong/oms-gateway/internal/metrics"
+	"github.com/ilivestrong/oms-gateway/internal/middlewares"
+)
 
 type Options struct {
-	ListenAddressHTTPPort       string
+	ListenAddressHTTPPort string
+	ListenAddressGRPCPort string
+	// TLS enables TLS on both public listeners when set.
+	TLS                         *certs.ServerConfig
 	OrderServiceListenAddress   string
 	ProductServiceListenAddress string
-	TokenExpirationInSeconds    time.Time
+	OrderServiceTLS             certs.ClientConfig
+	ProductServiceTLS           certs.ClientConfig
+	BackendCalls                CallPolicy
+	CircuitBreaker              breaker.Config
+	HealthCheckTimeout          time.Duration
+	ShutdownPreStopDelay        time.Duration
+	ShutdownDrainTimeout        time.Duration
+	RateLimiter                 middlewares.RateLimiterConfig
+	IPRateLimiter               middlewares.RateLimiterConfig
+	JWTKeys                     *auth.KeySet
+	Token                       auth.TokenConfig
+	Users                       *auth.FileUserStore
+	Lockout                     auth.LockoutConfig
+	Revocations                 auth.RevocationList
+	RefreshTokens               auth.RefreshTokenStore
+	Policy                      *middlewares.Policy
+	APIKeys                     auth.APIKeyStore
+	OIDCProviders               []auth.OIDCConfig
+	Metrics                     *metrics.Metrics
+	// MetricsListenPort is the port of the listener serving /metrics, kept
+	// apart from the public HTTP listener.
+	MetricsListenPort string
+	Logger            *slog.Logger
 }
@@ -0,0 +1,82 @@
+package config
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/ilivestrong/oms-gateway/internal/auth"
+	"github.com/redis/go-redis/v9"
+)
+
+// LoadKeys reads JWT_KEYS, JWT_KEYS_FILE, JWT_SIGNING_KEY_ID and
+// JWT_ALGORITHMS. The keys themselves are loaded by auth.LoadKeySet.
+func LoadKeys() auth.KeyConfig {
+	return auth.KeyConfig{
+		Keys:         os.Getenv("JWT_KEYS"),
+		File:         os.Getenv("JWT_KEYS_FILE"),
+		SigningKeyID: os.Getenv("JWT_SIGNING_KEY_ID"),
+		Algorithms:   lookupEnvList("JWT_ALGORITHMS"),
+	}
+}
+
+// LoadToken reads TOKEN_ISSUER, TOKEN_AUDIENCE, TOKEN_TTL, TOKEN_LEEWAY and
+// REFRESH_TOKEN_TTL.
+func LoadToken() (auth.TokenConfig, error) {
+	cfg := auth.TokenConfig{
+		Issuer:   os.Getenv("TOKEN_ISSUER"),
+		Audience: os.Getenv("TOKEN_AUDIENCE"),
+	}
+
+	var err error
+	cfg.TTL, err = lookupEnvDuration("TOKEN_TTL", auth.DefaultTokenTTL)
+	if err != nil {
+		return cfg, err
+	}
+	cfg.Leeway, err = lookupEnvDuration("TOKEN_LEEWAY", auth.DefaultTokenLeeway)
+	if err != nil {
+		return cfg, err
+	}
+	cfg.RefreshTTL, err = lookupEnvDuration("REFRESH_TOKEN_TTL", auth.DefaultRefreshTokenTTL)
+	return cfg, err
+}
+
+// LoadLockout reads LOGIN_MAX_FAILURES and LOGIN_LOCKOUT_DURATION.
+func LoadLockout() (auth.LockoutConfig, error) {
+	var cfg auth.LockoutConfig
+	var err error
+	cfg.MaxFailures, err = lookupEnvInt("LOGIN_MAX_FAILURES", auth.DefaultMaxLoginFailures)
+	if err != nil {
+		return cfg, err
+	}
+	cfg.Duration, err = lookupEnvDuration("LOGIN_LOCKOUT_DURATION", auth.DefaultLockoutDuration)
+	return cfg, err
+}
+
+// LoadAPIKeyStore stores API keys in API_KEYS_FILE, or in memory when it is
+// not set.
+func LoadAPIKeyStore() (auth.APIKeyStore, error) {
+	path, exist := os.LookupEnv("API_KEYS_FILE")
+	if !exist || path == "" {
+		return auth.NewMemoryAPIKeyStore(), nil
+	}
+	return auth.NewFileAPIKeyStore(path)
+}
+
+// LoadRevocationStores returns the revocation list and the refresh token
+// store, which are kept in the same place so that revoking a refresh token
+// family applies wherever the family can be used.
+func LoadRevocationStores() (auth.RevocationList, auth.RefreshTokenStore, error) {
+	switch store := os.Getenv("REVOCATION_STORE"); store {
+	case "", "memory":
+		return auth.NewMemoryRevocationList(), auth.NewMemoryRefreshTokenStore(), nil
+	case "redis":
+		redisOpts, err := redis.ParseURL(os.Getenv("REVOCATION_REDIS_URL"))
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid REVOCATION_REDIS_URL: %w", err)
+		}
+		client := redis.NewClient(redisOpts)
+		return auth.NewRedisRevocationList(client), auth.NewRedisRefreshTokenStore(client), nil
+	default:
+		return nil, nil, fmt.Errorf("unknown revocation store %q", store)
+	}
+}
@@ -0,0 +1,120 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	internal "github.com/ilivestrong/oms-gateway/internal"
+	"github.com/ilivestrong/oms-gateway/internal/breaker"
+	"github.com/ilivestrong/oms-gateway/internal/certs"
+)
+
+// LoadHealthCheckTimeout reads HEALTH_CHECK_TIMEOUT.
+func LoadHealthCheckTimeout() (time.Duration, error) {
+	return lookupEnvDuration("HEALTH_CHECK_TIMEOUT", internal.DefaultHealthCheckTimeout)
+}
+
+// LoadBackendCallPolicy reads BACKEND_TIMEOUT, BACKEND_TIMEOUTS,
+// BACKEND_RETRY_MAX_ATTEMPTS, BACKEND_RETRY_INITIAL_BACKOFF,
+// BACKEND_RETRY_MAX_BACKOFF, BACKEND_HEDGE_DELAY and BACKEND_HEDGE_MAX_ATTEMPTS.
+func LoadBackendCallPolicy() (internal.CallPolicy, error) {
+	var policy internal.CallPolicy
+	var err error
+	policy.Timeout, err = lookupEnvDuration("BACKEND_TIMEOUT", internal.DefaultBackendTimeout)
+	if err != nil {
+		return policy, err
+	}
+	policy.Timeouts, err = internal.ParseBackendTimeouts(os.Getenv("BACKEND_TIMEOUTS"))
+	if err != nil {
+		return policy, err
+	}
+	policy.Retry.MaxAttempts, err = lookupEnvInt("BACKEND_RETRY_MAX_ATTEMPTS", internal.DefaultRetryMaxAttempts)
+	if err != nil {
+		return policy, err
+	}
+	if policy.Retry.MaxAttempts < 1 || policy.Retry.MaxAttempts > 5 {
+		return policy, fmt.Errorf("BACKEND_RETRY_MAX_ATTEMPTS must be between 1 and 5")
+	}
+	policy.Retry.InitialBackoff, err = lookupEnvDuration("BACKEND_RETRY_INITIAL_BACKOFF", internal.DefaultRetryInitialBackoff)
+	if err != nil {
+		return policy, err
+	}
+	policy.Retry.MaxBackoff, err = lookupEnvDuration("BACKEND_RETRY_MAX_BACKOFF", internal.DefaultRetryMaxBackoff)
+	if err != nil {
+		return policy, err
+	}
+	if policy.Retry.InitialBackoff <= 0 || policy.Retry.MaxBackoff < policy.Retry.InitialBackoff {
+		return policy, fmt.Errorf("BACKEND_RETRY_INITIAL_BACKOFF must be positive and at most BACKEND_RETRY_MAX_BACKOFF")
+	}
+	policy.Hedging.Delay, err = lookupEnvDuration("BACKEND_HEDGE_DELAY", 0)
+	if err != nil {
+		return policy, err
+	}
+	policy.Hedging.MaxAttempts, err = lookupEnvInt("BACKEND_HEDGE_MAX_ATTEMPTS", internal.DefaultHedgingMaxAttempts)
+	if err != nil {
+		return policy, err
+	}
+	if policy.Hedging.MaxAttempts < 1 || policy.Hedging.MaxAttempts > 5 {
+		return policy, fmt.Errorf("BACKEND_HEDGE_MAX_ATTEMPTS must be between 1 and 5")
+	}
+	return policy, nil
+}
+
+// LoadCircuitBreaker reads the CIRCUIT_BREAKER_* variables. Setting
+// CIRCUIT_BREAKER_FAILURE_RATIO to 0 disables the breakers.
+func LoadCircuitBreaker() (breaker.Config, error) {
+	var cfg breaker.Config
+	var err error
+	cfg.FailureRatio, err = lookupEnvFloat("CIRCUIT_BREAKER_FAILURE_RATIO", breaker.DefaultFailureRatio)
+	if err != nil || cfg.FailureRatio < 0 || cfg.FailureRatio > 1 {
+		return cfg, fmt.Errorf("CIRCUIT_BREAKER_FAILURE_RATIO must be between 0 and 1")
+	}
+	cfg.SlowCallRatio, err = lookupEnvFloat("CIRCUIT_BREAKER_SLOW_CALL_RATIO", breaker.DefaultSlowCallRatio)
+	if err != nil || cfg.SlowCallRatio <= 0 || cfg.SlowCallRatio > 1 {
+		return cfg, fmt.Errorf("CIRCUIT_BREAKER_SLOW_CALL_RATIO must be above 0 and at most 1")
+	}
+	cfg.SlowCallDuration, err = lookupEnvDuration("CIRCUIT_BREAKER_SLOW_CALL_DURATION", breaker.DefaultSlowCallDuration)
+	if err != nil {
+		return cfg, err
+	}
+	cfg.Window, err = lookupEnvDuration("CIRCUIT_BREAKER_WINDOW", breaker.DefaultWindow)
+	if err != nil {
+		return cfg, err
+	}
+	cfg.OpenDuration, err = lookupEnvDuration("CIRCUIT_BREAKER_OPEN_DURATION", breaker.DefaultOpenDuration)
+	if err != nil {
+		return cfg, err
+	}
+	if cfg.Window <= 0 || cfg.OpenDuration <= 0 {
+		return cfg, fmt.Errorf("CIRCUIT_BREAKER_WINDOW and CIRCUIT_BREAKER_OPEN_DURATION must be positive")
+	}
+	cfg.MinRequests, err = lookupEnvInt("CIRCUIT_BREAKER_MIN_REQUESTS", breaker.DefaultMinRequests)
+	if err != nil {
+		return cfg, err
+	}
+	cfg.HalfOpenRequests, err = lookupEnvInt("CIRCUIT_BREAKER_HALF_OPEN_REQUESTS", breaker.DefaultHalfOpenRequests)
+	if err != nil {
+		return cfg, err
+	}
+	if cfg.MinRequests < 1 || cfg.HalfOpenRequests < 1 {
+		return cfg, fmt.Errorf("CIRCUIT_BREAKER_MIN_REQUESTS and CIRCUIT_BREAKER_HALF_OPEN_REQUESTS must be at least 1")
+	}
+	return cfg, nil
+}
+
+// LoadBackendTLS reads <prefix>_TLS_MODE, <prefix>_TLS_CA_FILE,
+// <prefix>_TLS_CERT_FILE, <prefix>_TLS_KEY_FILE and <prefix>_TLS_SERVER_NAME.
+func LoadBackendTLS(prefix string) (certs.ClientConfig, error) {
+	mode, err := certs.ParseMode(os.Getenv(prefix + "_TLS_MODE"))
+	if err != nil {
+		return certs.ClientConfig{}, err
+	}
+	return certs.ClientConfig{
+		Mode:       mode,
+		CAFile:     os.Getenv(prefix + "_TLS_CA_FILE"),
+		CertFile:   os.Getenv(prefix + "_TLS_CERT_FILE"),
+		KeyFile:    os.Getenv(prefix + "_TLS_KEY_FILE"),
+		ServerName: os.Getenv(prefix + "_TLS_SERVER_NAME"),
+	}, nil
+}
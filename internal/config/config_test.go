@@ -0,0 +1,382 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	internal "github.com/ilivestrong/oms-gateway/internal"
+	"github.com/ilivestrong/oms-gateway/internal/auth"
+	"github.com/ilivestrong/oms-gateway/internal/breaker"
+	"github.com/ilivestrong/oms-gateway/internal/certs"
+	"github.com/ilivestrong/oms-gateway/internal/middlewares"
+	"github.com/ilivestrong/oms-gateway/internal/tracing"
+)
+
+// setEnv sets every variable of env for the duration of the test.
+func setEnv(t *testing.T, env map[string]string) {
+	t.Helper()
+	for key, value := range env {
+		t.Setenv(key, value)
+	}
+}
+
+func TestLoadToken(t *testing.T) {
+	cfg, err := LoadToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := auth.TokenConfig{TTL: auth.DefaultTokenTTL, Leeway: auth.DefaultTokenLeeway, RefreshTTL: auth.DefaultRefreshTokenTTL}
+	if !reflect.DeepEqual(cfg, want) {
+		t.Errorf("defaults = %+v, want %+v", cfg, want)
+	}
+
+	setEnv(t, map[string]string{
+		"TOKEN_ISSUER":      "issuer",
+		"TOKEN_AUDIENCE":    "audience",
+		"TOKEN_TTL":         "5m",
+		"TOKEN_LEEWAY":      "0s",
+		"REFRESH_TOKEN_TTL": "1h",
+	})
+	cfg, err = LoadToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = auth.TokenConfig{Issuer: "issuer", Audience: "audience", TTL: 5 * time.Minute, RefreshTTL: time.Hour}
+	if !reflect.DeepEqual(cfg, want) {
+		t.Errorf("cfg = %+v, want %+v", cfg, want)
+	}
+
+	t.Setenv("TOKEN_LEEWAY", "soon")
+	if _, err := LoadToken(); err == nil {
+		t.Error("LoadToken accepted TOKEN_LEEWAY=soon")
+	}
+}
+
+func TestLoadKeysAndLockout(t *testing.T) {
+	setEnv(t, map[string]string{
+		"JWT_KEYS":               "a:secret",
+		"JWT_ALGORITHMS":         " HS256, ,RS256 ",
+		"LOGIN_MAX_FAILURES":     "3",
+		"LOGIN_LOCKOUT_DURATION": "1m",
+	})
+	keys := LoadKeys()
+	if keys.Keys != "a:secret" || !reflect.DeepEqual(keys.Algorithms, []string{"HS256", "RS256"}) {
+		t.Errorf("keys = %+v", keys)
+	}
+	lockout, err := LoadLockout()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lockout != (auth.LockoutConfig{MaxFailures: 3, Duration: time.Minute}) {
+		t.Errorf("lockout = %+v", lockout)
+	}
+
+	t.Setenv("LOGIN_MAX_FAILURES", "three")
+	if _, err := LoadLockout(); err == nil {
+		t.Error("LoadLockout accepted LOGIN_MAX_FAILURES=three")
+	}
+}
+
+func TestLoadRevocationStores(t *testing.T) {
+	tests := []struct {
+		name    string
+		env     map[string]string
+		wantErr bool
+	}{
+		{name: "default"},
+		{name: "memory", env: map[string]string{"REVOCATION_STORE": "memory"}},
+		{name: "redis", env: map[string]string{"REVOCATION_STORE": "redis", "REVOCATION_REDIS_URL": "redis://localhost:6379/0"}},
+		{name: "redis without URL", env: map[string]string{"REVOCATION_STORE": "redis"}, wantErr: true},
+		{name: "unknown store", env: map[string]string{"REVOCATION_STORE": "etcd"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setEnv(t, tt.env)
+			revocations, refreshTokens, err := LoadRevocationStores()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, want error %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && (revocations == nil || refreshTokens == nil) {
+				t.Error("stores missing")
+			}
+		})
+	}
+}
+
+func TestLoadAPIKeyStore(t *testing.T) {
+	store, err := LoadAPIKeyStore()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := store.(*auth.MemoryAPIKeyStore); !ok {
+		t.Errorf("store = %T, want *auth.MemoryAPIKeyStore without API_KEYS_FILE", store)
+	}
+
+	path := filepath.Join(t.TempDir(), "api-keys.json")
+	if err := os.WriteFile(path, []byte(`{"keys": []}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("API_KEYS_FILE", path)
+	store, err = LoadAPIKeyStore()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := store.(*auth.FileAPIKeyStore); !ok {
+		t.Errorf("store = %T, want *auth.FileAPIKeyStore", store)
+	}
+}
+
+func TestLoadBackendCallPolicy(t *testing.T) {
+	policy, err := LoadBackendCallPolicy()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if policy.Timeout != internal.DefaultBackendTimeout || policy.Retry.MaxAttempts != internal.DefaultRetryMaxAttempts ||
+		policy.Retry.InitialBackoff != internal.DefaultRetryInitialBackoff || policy.Retry.MaxBackoff != internal.DefaultRetryMaxBackoff ||
+		policy.Hedging.Delay != 0 || policy.Hedging.MaxAttempts != internal.DefaultHedgingMaxAttempts {
+		t.Errorf("defaults = %+v", policy)
+	}
+
+	tests := []struct {
+		name string
+		env  map[string]string
+	}{
+		{name: "malformed timeout", env: map[string]string{"BACKEND_TIMEOUT": "fast"}},
+		{name: "malformed per-method timeouts", env: map[string]string{"BACKEND_TIMEOUTS": "ProductService/Get"}},
+		{name: "no attempts", env: map[string]string{"BACKEND_RETRY_MAX_ATTEMPTS": "0"}},
+		{name: "too many attempts", env: map[string]string{"BACKEND_RETRY_MAX_ATTEMPTS": "6"}},
+		{name: "zero initial backoff", env: map[string]string{"BACKEND_RETRY_INITIAL_BACKOFF": "0s"}},
+		{name: "max below initial backoff", env: map[string]string{"BACKEND_RETRY_INITIAL_BACKOFF": "2s", "BACKEND_RETRY_MAX_BACKOFF": "1s"}},
+		{name: "malformed hedge delay", env: map[string]string{"BACKEND_HEDGE_DELAY": "later"}},
+		{name: "too many hedged attempts", env: map[string]string{"BACKEND_HEDGE_MAX_ATTEMPTS": "6"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setEnv(t, tt.env)
+			if _, err := LoadBackendCallPolicy(); err == nil {
+				t.Errorf("LoadBackendCallPolicy accepted %v", tt.env)
+			}
+		})
+	}
+}
+
+func TestLoadCircuitBreaker(t *testing.T) {
+	cfg, err := LoadCircuitBreaker()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := breaker.Config{
+		FailureRatio:     breaker.DefaultFailureRatio,
+		SlowCallRatio:    breaker.DefaultSlowCallRatio,
+		SlowCallDuration: breaker.DefaultSlowCallDuration,
+		Window:           breaker.DefaultWindow,
+		OpenDuration:     breaker.DefaultOpenDuration,
+		MinRequests:      breaker.DefaultMinRequests,
+		HalfOpenRequests: breaker.DefaultHalfOpenRequests,
+	}
+	if !reflect.DeepEqual(cfg, want) {
+		t.Errorf("defaults = %+v, want %+v", cfg, want)
+	}
+
+	t.Setenv("CIRCUIT_BREAKER_FAILURE_RATIO", "0")
+	if cfg, err := LoadCircuitBreaker(); err != nil || cfg.FailureRatio != 0 {
+		t.Errorf("disabled breakers: cfg = %+v, err = %v", cfg, err)
+	}
+
+	tests := []struct {
+		name string
+		env  map[string]string
+	}{
+		{name: "failure ratio above 1", env: map[string]string{"CIRCUIT_BREAKER_FAILURE_RATIO": "1.5"}},
+		{name: "zero slow call ratio", env: map[string]string{"CIRCUIT_BREAKER_SLOW_CALL_RATIO": "0"}},
+		{name: "zero window", env: map[string]string{"CIRCUIT_BREAKER_WINDOW": "0s"}},
+		{name: "zero open duration", env: map[string]string{"CIRCUIT_BREAKER_OPEN_DURATION": "0s"}},
+		{name: "no minimum requests", env: map[string]string{"CIRCUIT_BREAKER_MIN_REQUESTS": "0"}},
+		{name: "no half-open requests", env: map[string]string{"CIRCUIT_BREAKER_HALF_OPEN_REQUESTS": "0"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setEnv(t, tt.env)
+			if _, err := LoadCircuitBreaker(); err == nil {
+				t.Errorf("LoadCircuitBreaker accepted %v", tt.env)
+			}
+		})
+	}
+}
+
+func TestLoadBackendTLS(t *testing.T) {
+	setEnv(t, map[string]string{
+		"ORDER_TLS_MODE":        "mtls",
+		"ORDER_TLS_CA_FILE":     "ca.pem",
+		"ORDER_TLS_SERVER_NAME": "orders.internal",
+		"PRODUCT_TLS_MODE":      "ssh",
+	})
+	cfg, err := LoadBackendTLS("ORDER")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg != (certs.ClientConfig{Mode: certs.ModeMutualTLS, CAFile: "ca.pem", ServerName: "orders.internal"}) {
+		t.Errorf("cfg = %+v", cfg)
+	}
+	if _, err := LoadBackendTLS("PRODUCT"); err == nil {
+		t.Error("LoadBackendTLS accepted PRODUCT_TLS_MODE=ssh")
+	}
+}
+
+func TestLoadServerTLS(t *testing.T) {
+	cfg, err := LoadServerTLS()
+	if err != nil || cfg != nil {
+		t.Errorf("without a certificate: cfg = %+v, err = %v; want plaintext", cfg, err)
+	}
+
+	t.Setenv("TLS_CERT_FILE", "cert.pem")
+	if _, err := LoadServerTLS(); err == nil {
+		t.Error("LoadServerTLS accepted TLS_CERT_FILE without TLS_KEY_FILE")
+	}
+
+	t.Setenv("TLS_KEY_FILE", "key.pem")
+	cfg, err = LoadServerTLS()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.CertFile != "cert.pem" || cfg.KeyFile != "key.pem" {
+		t.Errorf("cfg = %+v", cfg)
+	}
+}
+
+func TestLoadShutdown(t *testing.T) {
+	cfg, err := LoadShutdown()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg != (Shutdown{PreStopDelay: defaultPreStopDelay, DrainTimeout: defaultDrainTimeout}) {
+		t.Errorf("defaults = %+v", cfg)
+	}
+
+	t.Setenv("SHUTDOWN_PRE_STOP_DELAY", "-1s")
+	if _, err := LoadShutdown(); err == nil {
+		t.Error("LoadShutdown accepted a negative pre-stop delay")
+	}
+}
+
+func TestLoadMetricsPort(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    string
+		wantErr bool
+	}{
+		{value: "", want: "9090"},
+		{value: "9100", want: "9100"},
+		{value: "0", wantErr: true},
+		{value: "65536", wantErr: true},
+		{value: "metrics", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			t.Setenv("METRICS_PORT", tt.value)
+			port, err := LoadMetricsPort()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, want error %v", err, tt.wantErr)
+			}
+			if port != tt.want {
+				t.Errorf("port = %q, want %q", port, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadTracing(t *testing.T) {
+	cfg, err := LoadTracing("v1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg != (tracing.Config{Exporter: tracing.ExporterNone, SampleRatio: 1, ServiceVersion: "v1"}) {
+		t.Errorf("defaults = %+v", cfg)
+	}
+
+	tests := map[string]string{"TRACING_EXPORTER": "zipkin", "TRACING_SAMPLE_RATIO": "2"}
+	for key, value := range tests {
+		t.Run(key, func(t *testing.T) {
+			t.Setenv(key, value)
+			if _, err := LoadTracing("v1"); err == nil {
+				t.Errorf("LoadTracing accepted %s=%s", key, value)
+			}
+		})
+	}
+}
+
+func TestLoadRateLimiters(t *testing.T) {
+	base, err := LoadRateLimiter()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if base.Default != (middlewares.RateLimit{Limit: 10, Period: time.Second}) || base.MaxClients != middlewares.DefaultRateLimitMaxClients || base.ByIP {
+		t.Errorf("per-subject defaults = %+v", base)
+	}
+
+	ip, err := LoadIPRateLimiter(base)
+	if err != nil {
+		t.Fatal(err)
+	}
+	login := middlewares.RateLimit{Limit: 10, Period: time.Minute}
+	wantRules := []middlewares.RateLimitRule{
+		{Route: middlewares.Route{Method: "*", Pattern: "/login"}, RateLimit: login},
+		{Route: middlewares.Route{Method: "*", Pattern: "/token/refresh"}, RateLimit: login},
+	}
+	if !ip.ByIP || ip.Default != (middlewares.RateLimit{Limit: 50, Period: time.Second}) || !reflect.DeepEqual(ip.Rules, wantRules) {
+		t.Errorf("per-IP defaults = %+v", ip)
+	}
+
+	setEnv(t, map[string]string{
+		"RATE_LIMIT_DEFAULT":        "5/1m",
+		"RATE_LIMIT_RULES":          "POST /v1/orders=1/1s",
+		"RATE_LIMIT_FAILURE_POLICY": string(middlewares.FailClosed),
+		"RATE_LIMIT_IP":             "100/1m",
+		"RATE_LIMIT_LOGIN":          "3/1m",
+	})
+	base, err = LoadRateLimiter()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if base.Default != (middlewares.RateLimit{Limit: 5, Period: time.Minute}) || len(base.Rules) != 1 || base.FailurePolicy != middlewares.FailClosed {
+		t.Errorf("per-subject = %+v", base)
+	}
+	ip, err = LoadIPRateLimiter(base)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ip.FailurePolicy != middlewares.FailClosed || ip.Default.Limit != 100 || ip.Rules[0].Limit != 3 {
+		t.Errorf("per-IP = %+v, want the overrides and the failure policy of the per-subject limiter", ip)
+	}
+
+	tests := []struct {
+		name string
+		env  map[string]string
+	}{
+		{name: "malformed default", env: map[string]string{"RATE_LIMIT_DEFAULT": "ten"}},
+		{name: "malformed rule", env: map[string]string{"RATE_LIMIT_RULES": "POST /v1/orders"}},
+		{name: "malformed max clients", env: map[string]string{"RATE_LIMIT_MAX_CLIENTS": "many"}},
+		{name: "unknown failure policy", env: map[string]string{"RATE_LIMIT_FAILURE_POLICY": "maybe"}},
+		{name: "unknown store", env: map[string]string{"RATE_LIMIT_STORE": "etcd"}},
+		{name: "redis without URL", env: map[string]string{"RATE_LIMIT_STORE": "redis", "RATE_LIMIT_REDIS_URL": ""}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setEnv(t, tt.env)
+			if _, err := LoadRateLimiter(); err == nil {
+				t.Errorf("LoadRateLimiter accepted %v", tt.env)
+			}
+		})
+	}
+	for key, value := range map[string]string{"RATE_LIMIT_IP": "0/1s", "RATE_LIMIT_LOGIN": "1/0s"} {
+		t.Run(key, func(t *testing.T) {
+			t.Setenv(key, value)
+			if _, err := LoadIPRateLimiter(middlewares.RateLimiterConfig{}); err == nil {
+				t.Errorf("LoadIPRateLimiter accepted %s=%s", key, value)
+			}
+		})
+	}
+}
@@ -0,0 +1,45 @@
+// Package config reads the gateway's settings from environment variables.
+// Unset and empty variables take their documented defaults; invalid values
+// are reported as errors naming the variable where possible.
+package config
+
+import (
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+func lookupEnvList(key string) []string {
+	var values []string
+	for _, value := range strings.Split(os.Getenv(key), ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+func lookupEnvInt(key string, fallback int) (int, error) {
+	value, exist := os.LookupEnv(key)
+	if !exist || value == "" {
+		return fallback, nil
+	}
+	return strconv.Atoi(value)
+}
+
+func lookupEnvFloat(key string, fallback float64) (float64, error) {
+	value, exist := os.LookupEnv(key)
+	if !exist || value == "" {
+		return fallback, nil
+	}
+	return strconv.ParseFloat(value, 64)
+}
+
+func lookupEnvDuration(key string, fallback time.Duration) (time.Duration, error) {
+	value, exist := os.LookupEnv(key)
+	if !exist || value == "" {
+		return fallback, nil
+	}
+	return time.ParseDuration(value)
+}
@@ -0,0 +1,98 @@
+package config
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/ilivestrong/oms-gateway/internal/middlewares"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	defaultRateLimit   = "10/1s"
+	defaultIPRateLimit = "50/1s"
+	defaultLoginLimit  = "10/1m"
+)
+
+// LoadRateLimiter reads the per-subject limits from RATE_LIMIT_DEFAULT,
+// RATE_LIMIT_RULES, RATE_LIMIT_MAX_CLIENTS, RATE_LIMIT_FAILURE_POLICY,
+// RATE_LIMIT_STORE and RATE_LIMIT_REDIS_URL.
+func LoadRateLimiter() (middlewares.RateLimiterConfig, error) {
+	var cfg middlewares.RateLimiterConfig
+
+	defaultLimit := defaultRateLimit
+	if value, exist := os.LookupEnv("RATE_LIMIT_DEFAULT"); exist && value != "" {
+		defaultLimit = value
+	}
+	limit, err := middlewares.ParseRateLimit(defaultLimit)
+	if err != nil {
+		return cfg, err
+	}
+	cfg.Default = limit
+
+	cfg.Rules, err = middlewares.ParseRateLimitRules(os.Getenv("RATE_LIMIT_RULES"))
+	if err != nil {
+		return cfg, err
+	}
+
+	cfg.MaxClients, err = lookupEnvInt("RATE_LIMIT_MAX_CLIENTS", middlewares.DefaultRateLimitMaxClients)
+	if err != nil {
+		return cfg, err
+	}
+
+	if value, exist := os.LookupEnv("RATE_LIMIT_FAILURE_POLICY"); exist && value != "" {
+		cfg.FailurePolicy, err = middlewares.ParseFailurePolicy(value)
+		if err != nil {
+			return cfg, err
+		}
+	}
+
+	switch store := os.Getenv("RATE_LIMIT_STORE"); store {
+	case "", "memory":
+	case "redis":
+		redisOpts, err := redis.ParseURL(os.Getenv("RATE_LIMIT_REDIS_URL"))
+		if err != nil {
+			return cfg, fmt.Errorf("invalid RATE_LIMIT_REDIS_URL: %w", err)
+		}
+		cfg.Limiter = middlewares.NewRedisLimiter(redis.NewClient(redisOpts))
+	default:
+		return cfg, fmt.Errorf("unknown rate limit store %q", store)
+	}
+	return cfg, nil
+}
+
+// LoadIPRateLimiter configures the limit applied per remote IP before
+// authentication, with a stricter budget for /login and /token/refresh. It
+// shares the store of base.
+func LoadIPRateLimiter(base middlewares.RateLimiterConfig) (middlewares.RateLimiterConfig, error) {
+	cfg := middlewares.RateLimiterConfig{
+		MaxClients:    base.MaxClients,
+		Limiter:       base.Limiter,
+		FailurePolicy: base.FailurePolicy,
+		ByIP:          true,
+	}
+
+	ipLimit := defaultIPRateLimit
+	if value, exist := os.LookupEnv("RATE_LIMIT_IP"); exist && value != "" {
+		ipLimit = value
+	}
+	limit, err := middlewares.ParseRateLimit(ipLimit)
+	if err != nil {
+		return cfg, err
+	}
+	cfg.Default = limit
+
+	loginLimit := defaultLoginLimit
+	if value, exist := os.LookupEnv("RATE_LIMIT_LOGIN"); exist && value != "" {
+		loginLimit = value
+	}
+	limit, err = middlewares.ParseRateLimit(loginLimit)
+	if err != nil {
+		return cfg, err
+	}
+	cfg.Rules = []middlewares.RateLimitRule{
+		{Route: middlewares.Route{Method: "*", Pattern: "/login"}, RateLimit: limit},
+		{Route: middlewares.Route{Method: "*", Pattern: "/token/refresh"}, RateLimit: limit},
+	}
+	return cfg, nil
+}
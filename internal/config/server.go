@@ -0,0 +1,100 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/ilivestrong/oms-gateway/internal/certs"
+	"github.com/ilivestrong/oms-gateway/internal/tracing"
+)
+
+const (
+	defaultDrainTimeout = 15 * time.Second
+	defaultPreStopDelay = 5 * time.Second
+	defaultMetricsPort  = 9090
+)
+
+// Shutdown holds the timings of a graceful shutdown, see
+// internal.Options.ShutdownPreStopDelay and ShutdownDrainTimeout.
+type Shutdown struct {
+	PreStopDelay time.Duration
+	DrainTimeout time.Duration
+}
+
+// LoadShutdown reads SHUTDOWN_PRE_STOP_DELAY and SHUTDOWN_DRAIN_TIMEOUT.
+func LoadShutdown() (Shutdown, error) {
+	var cfg Shutdown
+	var err error
+	cfg.DrainTimeout, err = lookupEnvDuration("SHUTDOWN_DRAIN_TIMEOUT", defaultDrainTimeout)
+	if err != nil {
+		return cfg, err
+	}
+	cfg.PreStopDelay, err = lookupEnvDuration("SHUTDOWN_PRE_STOP_DELAY", defaultPreStopDelay)
+	if err != nil {
+		return cfg, err
+	}
+	if cfg.PreStopDelay < 0 {
+		return cfg, errors.New("SHUTDOWN_PRE_STOP_DELAY must not be negative")
+	}
+	return cfg, nil
+}
+
+// LoadMetricsPort reads METRICS_PORT, the port of the listener that serves
+// /metrics. The metrics are never served on the public HTTP listener.
+func LoadMetricsPort() (string, error) {
+	port, err := lookupEnvInt("METRICS_PORT", defaultMetricsPort)
+	if err != nil || port < 1 || port > 65535 {
+		return "", errors.New("METRICS_PORT must be a port number")
+	}
+	return strconv.Itoa(port), nil
+}
+
+// LoadTracing reads TRACING_EXPORTER and TRACING_SAMPLE_RATIO. Spans are
+// tagged with serviceVersion.
+func LoadTracing(serviceVersion string) (tracing.Config, error) {
+	exporter, err := tracing.ParseExporter(os.Getenv("TRACING_EXPORTER"))
+	if err != nil {
+		return tracing.Config{}, err
+	}
+	ratio, err := lookupEnvFloat("TRACING_SAMPLE_RATIO", 1)
+	if err != nil || ratio < 0 || ratio > 1 {
+		return tracing.Config{}, fmt.Errorf("TRACING_SAMPLE_RATIO must be between 0 and 1")
+	}
+	return tracing.Config{Exporter: exporter, SampleRatio: ratio, ServiceVersion: serviceVersion}, nil
+}
+
+// LoadServerTLS reads TLS_CERT_FILE, TLS_KEY_FILE, TLS_MIN_VERSION,
+// TLS_CIPHER_SUITES, TLS_CLIENT_CA_FILE and TLS_CLIENT_AUTH. It returns nil,
+// leaving the listeners in plaintext, when no certificate is configured.
+func LoadServerTLS() (*certs.ServerConfig, error) {
+	certFile, keyFile := os.Getenv("TLS_CERT_FILE"), os.Getenv("TLS_KEY_FILE")
+	if certFile == "" && keyFile == "" {
+		return nil, nil
+	}
+	if certFile == "" || keyFile == "" {
+		return nil, errors.New("TLS_CERT_FILE and TLS_KEY_FILE must be set together")
+	}
+	minVersion, err := certs.ParseTLSVersion(os.Getenv("TLS_MIN_VERSION"))
+	if err != nil {
+		return nil, err
+	}
+	cipherSuites, err := certs.ParseCipherSuites(os.Getenv("TLS_CIPHER_SUITES"))
+	if err != nil {
+		return nil, err
+	}
+	clientAuth, err := certs.ParseClientAuth(os.Getenv("TLS_CLIENT_AUTH"))
+	if err != nil {
+		return nil, err
+	}
+	return &certs.ServerConfig{
+		CertFile:     certFile,
+		KeyFile:      keyFile,
+		MinVersion:   minVersion,
+		CipherSuites: cipherSuites,
+		ClientCAFile: os.Getenv("TLS_CLIENT_CA_FILE"),
+		ClientAuth:   clientAuth,
+	}, nil
+}
@@ -2,33 +2,71 @@ package gatewayservice
 
 import (
 	"context"
-	"fmt"
+	"log/slog"
 
+	"github.com/ilivestrong/oms-gateway/internal/auth"
 	omspb "github.com/ilivestrong/oms-gateway/internal/protos"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 	"google.golang.org/protobuf/types/known/emptypb"
 )
 
+const (
+	ErrInvalidDecrementOffset = "offset must be a positive number"
+	ErrInsufficientStock      = "not enough stock to decrement by offset"
+	ErrUnauthenticated        = "request has no authenticated caller"
+	ErrForeignCustomer        = "customer_id must match the authenticated caller"
+)
+
 type (
 	GatewayService struct {
 		omspb.UnimplementedGatewayServiceServer
 
 		productSvc omspb.ProductServiceClient
 		orderSvc   omspb.OrderServiceClient
+		logger     *slog.Logger
 	}
 )
 
-func New(productSvcClient omspb.ProductServiceClient, orderSvcClient omspb.OrderServiceClient) *GatewayService {
+func New(productSvcClient omspb.ProductServiceClient, orderSvcClient omspb.OrderServiceClient, logger *slog.Logger) *GatewayService {
 	return &GatewayService{
 		productSvc: productSvcClient,
 		orderSvc:   orderSvcClient,
+		logger:     logger,
 	}
 }
 
+// ListOrders returns only the caller's own orders unless the caller holds
+// the orders:admin scope. The order service does the filtering.
 func (gw *GatewayService) ListOrders(ctx context.Context, in *emptypb.Empty) (*omspb.ListOrdersResponse, error) {
-	return gw.orderSvc.List(ctx, nil)
+	principal, ok := auth.PrincipalFromContext(ctx)
+	if !ok {
+		return nil, status.Error(codes.Unauthenticated, ErrUnauthenticated)
+	}
+	req := &omspb.ListOrdersRequest{CustomerId: principal.Subject}
+	if principal.HasScope(auth.ScopeOrdersAdmin) {
+		req.CustomerId = ""
+	}
+	return gw.orderSvc.List(ctx, req)
 }
 
+// CreateOrder places the order for the caller. An empty customer_id defaults
+// to the caller; naming another customer needs the orders:admin scope.
 func (gw *GatewayService) CreateOrder(ctx context.Context, req *omspb.CreateOrderRequest) (*omspb.CreateOrderResponse, error) {
+	principal, ok := auth.PrincipalFromContext(ctx)
+	if !ok {
+		return nil, status.Error(codes.Unauthenticated, ErrUnauthenticated)
+	}
+	switch req.GetCustomerId() {
+	case "":
+		req.CustomerId = principal.Subject
+	case principal.Subject:
+	default:
+		if !principal.HasScope(auth.ScopeOrdersAdmin) {
+			return nil, status.Error(codes.PermissionDenied, ErrForeignCustomer)
+		}
+	}
 	return gw.orderSvc.Create(ctx, req)
 }
 
@@ -37,7 +75,6 @@ func (gw *GatewayService) GetProduct(ctx context.Context, req *omspb.GetProductR
 }
 
 func (gw *GatewayService) ListProducts(ctx context.Context, req *omspb.ListProductsRequest) (*omspb.ListProductsResponse, error) {
-	fmt.Println("calling ListProducts....")
 	return gw.productSvc.List(ctx, req)
 }
 
@@ -53,6 +90,32 @@ func (gw *GatewayService) DeleteProduct(ctx context.Context, req *omspb.DeletePr
 	return gw.productSvc.Delete(ctx, req)
 }
 
+// DecrementProductQty leaves the stock check to the backend, which applies it
+// atomically with the decrement, and reports a refusal as a conflict.
 func (gw *GatewayService) DecrementProductQty(ctx context.Context, req *omspb.DecrementQtyRequest) (*omspb.DecrementQtyResponse, error) {
-	return gw.productSvc.DecrementQty(ctx, req)
+	if req.GetOffset() <= 0 {
+		return nil, invalidField("offset", ErrInvalidDecrementOffset)
+	}
+
+	resp, err := gw.productSvc.DecrementQty(ctx, req)
+	if err != nil {
+		if code := status.Code(err); code == codes.FailedPrecondition || code == codes.OutOfRange {
+			return nil, status.Error(codes.Aborted, ErrInsufficientStock)
+		}
+		return nil, err
+	}
+	return resp, nil
+}
+
+// invalidField returns InvalidArgument with a BadRequest detail naming the
+// field, which the HTTP error handler lists as a field violation.
+func invalidField(field, description string) error {
+	st := status.New(codes.InvalidArgument, description)
+	detailed, err := st.WithDetails(&errdetails.BadRequest{
+		FieldViolations: []*errdetails.BadRequest_FieldViolation{{Field: field, Description: description}},
+	})
+	if err != nil {
+		return st.Err()
+	}
+	return detailed.Err()
 }
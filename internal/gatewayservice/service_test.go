@@ -0,0 +1,124 @@
+package gatewayservice
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"testing"
+
+	"github.com/ilivestrong/oms-gateway/internal/auth"
+	omspb "github.com/ilivestrong/oms-gateway/internal/protos"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+)
+
+type fakeProductClient struct {
+	omspb.ProductServiceClient
+	decrementErr   error
+	getCalls       int
+	decrementCalls int
+}
+
+func (c *fakeProductClient) Get(ctx context.Context, in *omspb.GetProductRequest, opts ...grpc.CallOption) (*omspb.Product, error) {
+	c.getCalls++
+	return &omspb.Product{Id: in.GetProductId()}, nil
+}
+
+func (c *fakeProductClient) DecrementQty(ctx context.Context, in *omspb.DecrementQtyRequest, opts ...grpc.CallOption) (*omspb.DecrementQtyResponse, error) {
+	c.decrementCalls++
+	if c.decrementErr != nil {
+		return nil, c.decrementErr
+	}
+	return &omspb.DecrementQtyResponse{}, nil
+}
+
+func TestDecrementProductQty(t *testing.T) {
+	tests := []struct {
+		name          string
+		offset        int32
+		decrementErr  error
+		wantCode      codes.Code
+		wantDecrement int
+	}{
+		{name: "decremented", offset: 2, wantCode: codes.OK, wantDecrement: 1},
+		{name: "non-positive offset", offset: 0, wantCode: codes.InvalidArgument},
+		{name: "not enough stock", offset: 5, decrementErr: status.Error(codes.FailedPrecondition, "stock"), wantCode: codes.Aborted, wantDecrement: 1},
+		{name: "out of range", offset: 5, decrementErr: status.Error(codes.OutOfRange, "stock"), wantCode: codes.Aborted, wantDecrement: 1},
+		{name: "backend error", offset: 1, decrementErr: status.Error(codes.Unavailable, "down"), wantCode: codes.Unavailable, wantDecrement: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			products := &fakeProductClient{decrementErr: tt.decrementErr}
+			gw := New(products, nil, slog.Default())
+
+			_, err := gw.DecrementProductQty(context.Background(), &omspb.DecrementQtyRequest{ProductId: "7", Offset: tt.offset})
+			if code := status.Code(err); code != tt.wantCode {
+				t.Fatalf("code = %v, want %v (err %v)", code, tt.wantCode, err)
+			}
+			if tt.wantCode == codes.Aborted && !errors.Is(err, status.Error(codes.Aborted, ErrInsufficientStock)) {
+				t.Errorf("err = %v, want %q", err, ErrInsufficientStock)
+			}
+			if products.decrementCalls != tt.wantDecrement {
+				t.Errorf("DecrementQty calls = %d, want %d", products.decrementCalls, tt.wantDecrement)
+			}
+			if products.getCalls != 0 {
+				t.Errorf("Get calls = %d, want none", products.getCalls)
+			}
+		})
+	}
+}
+
+type fakeOrderClient struct {
+	omspb.OrderServiceClient
+	listReq *omspb.ListOrdersRequest
+	orders  []*omspb.Order
+}
+
+func (c *fakeOrderClient) List(ctx context.Context, in *omspb.ListOrdersRequest, opts ...grpc.CallOption) (*omspb.ListOrdersResponse, error) {
+	c.listReq = in
+	return &omspb.ListOrdersResponse{Orders: c.orders}, nil
+}
+
+func TestListOrders(t *testing.T) {
+	tests := []struct {
+		name           string
+		principal      *auth.Principal
+		wantCode       codes.Code
+		wantCustomerID string
+	}{
+		{name: "customer", principal: &auth.Principal{Subject: "customer@example.com"}, wantCustomerID: "customer@example.com"},
+		{name: "admin", principal: &auth.Principal{Subject: "dev@example.com", Scopes: []string{auth.ScopeOrdersAdmin}}, wantCustomerID: ""},
+		{name: "unauthenticated", wantCode: codes.Unauthenticated},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// The order service filters by customer_id, so whatever it
+			// returns is passed on as is.
+			orders := &fakeOrderClient{orders: []*omspb.Order{{Id: "1", CustomerId: "other@example.com"}}}
+			gw := New(nil, orders, slog.Default())
+			ctx := context.Background()
+			if tt.principal != nil {
+				ctx = auth.NewContext(ctx, tt.principal)
+			}
+
+			resp, err := gw.ListOrders(ctx, &emptypb.Empty{})
+			if code := status.Code(err); code != tt.wantCode {
+				t.Fatalf("code = %v, want %v (err %v)", code, tt.wantCode, err)
+			}
+			if tt.wantCode != codes.OK {
+				if orders.listReq != nil {
+					t.Error("the order service was called")
+				}
+				return
+			}
+			if got := orders.listReq.GetCustomerId(); got != tt.wantCustomerID {
+				t.Errorf("customer_id = %q, want %q", got, tt.wantCustomerID)
+			}
+			if len(resp.GetOrders()) != 1 {
+				t.Errorf("orders = %v, want the order service's response unchanged", resp.GetOrders())
+			}
+		})
+	}
+}
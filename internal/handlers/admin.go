@@ -0,0 +1,150 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"github.com/ilivestrong/oms-gateway/internal/auth"
+	"github.com/ilivestrong/oms-gateway/internal/middlewares"
+)
+
+// requireAdmin checks the admin scope in the admin handlers as well as in the
+// policy, so a policy without a rule for an admin route cannot expose it.
+func requireAdmin(w http.ResponseWriter, r *http.Request) (*auth.Principal, bool) {
+	principal, ok := auth.PrincipalFromContext(r.Context())
+	if !ok || !principal.HasScope(auth.ScopeAdmin) {
+		p := middlewares.NewProblem(http.StatusForbidden, middlewares.ErrInsufficientScope, ErrAdminRequired)
+		p.RequiredScopes = []string{auth.ScopeAdmin}
+		middlewares.WriteProblem(w, r, p)
+		return nil, false
+	}
+	return principal, true
+}
+
+// RevokeSubject lets an admin revoke every token issued so far to a
+// subject, e.g. when an account is compromised.
+func RevokeSubject(tokenIssuer *auth.TokenIssuer, logger *slog.Logger) runtime.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request, _ map[string]string) {
+		principal, ok := requireAdmin(w, r)
+		if !ok {
+			return
+		}
+
+		var revocationRequest RevocationRequest
+		if err := json.NewDecoder(r.Body).Decode(&revocationRequest); err != nil || strings.TrimSpace(revocationRequest.Subject) == "" {
+			sendProblem(w, r, http.StatusBadRequest, middlewares.CodeInvalidRequest, ErrInvalidRevocationRequest)
+			return
+		}
+
+		if err := tokenIssuer.RevokeSubject(r.Context(), revocationRequest.Subject); err != nil {
+			logger.Error("RevokeSubject:", "err", fmt.Sprintf("failed to revoke subject: %v", err))
+			sendProblem(w, r, http.StatusInternalServerError, middlewares.CodeInternal, "failed to revoke tokens")
+			return
+		}
+		logger.Info("revoked tokens", "subject", revocationRequest.Subject, "by", principal.Subject)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func CreateAPIKey(apiKeys *auth.APIKeys, logger *slog.Logger) runtime.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request, _ map[string]string) {
+		principal, ok := requireAdmin(w, r)
+		if !ok {
+			return
+		}
+
+		var createRequest CreateAPIKeyRequest
+		if err := json.NewDecoder(r.Body).Decode(&createRequest); err != nil || strings.TrimSpace(createRequest.Name) == "" {
+			sendProblem(w, r, http.StatusBadRequest, middlewares.CodeInvalidRequest, ErrInvalidAPIKeyRequest)
+			return
+		}
+		var ttl time.Duration
+		if createRequest.ExpiresIn != "" {
+			var err error
+			ttl, err = time.ParseDuration(createRequest.ExpiresIn)
+			if err != nil || ttl <= 0 {
+				sendProblem(w, r, http.StatusBadRequest, middlewares.CodeInvalidRequest, ErrInvalidAPIKeyExpiry)
+				return
+			}
+		}
+
+		key, record, err := apiKeys.Create(r.Context(), createRequest.Name, createRequest.Scopes, ttl)
+		if errors.Is(err, auth.ErrUnknownScopes) {
+			sendProblem(w, r, http.StatusBadRequest, middlewares.CodeInvalidRequest, err.Error())
+			return
+		}
+		if err != nil {
+			logger.Error("CreateAPIKey:", "err", fmt.Sprintf("failed to create API key: %v", err))
+			sendProblem(w, r, http.StatusInternalServerError, middlewares.CodeInternal, "failed to create API key")
+			return
+		}
+		logger.Info("created API key", "id", record.ID, "name", record.Name, "by", principal.Subject)
+
+		resp := newAPIKeyResponse(*record)
+		resp.Key = key
+		respBytes, _ := json.Marshal(resp)
+		w.Header().Set("Cache-Control", "no-store")
+		sendResponse(w, respBytes, EncodingTypeJSON, http.StatusCreated)
+	}
+}
+
+func ListAPIKeys(apiKeys *auth.APIKeys, logger *slog.Logger) runtime.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request, _ map[string]string) {
+		if _, ok := requireAdmin(w, r); !ok {
+			return
+		}
+
+		records, err := apiKeys.List(r.Context())
+		if err != nil {
+			logger.Error("ListAPIKeys:", "err", fmt.Sprintf("failed to list API keys: %v", err))
+			sendProblem(w, r, http.StatusInternalServerError, middlewares.CodeInternal, "failed to list API keys")
+			return
+		}
+		resp := ListAPIKeysResponse{APIKeys: make([]APIKeyResponse, 0, len(records))}
+		for _, record := range records {
+			resp.APIKeys = append(resp.APIKeys, newAPIKeyResponse(record))
+		}
+		respBytes, _ := json.Marshal(resp)
+		sendResponse(w, respBytes, EncodingTypeJSON, http.StatusOK)
+	}
+}
+
+func RevokeAPIKey(apiKeys *auth.APIKeys, logger *slog.Logger) runtime.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request, pathParams map[string]string) {
+		principal, ok := requireAdmin(w, r)
+		if !ok {
+			return
+		}
+
+		err := apiKeys.Revoke(r.Context(), pathParams["id"])
+		if errors.Is(err, auth.ErrAPIKeyNotFound) {
+			sendProblem(w, r, http.StatusNotFound, middlewares.CodeNotFound, err.Error())
+			return
+		}
+		if err != nil {
+			logger.Error("RevokeAPIKey:", "err", fmt.Sprintf("failed to revoke API key: %v", err))
+			sendProblem(w, r, http.StatusInternalServerError, middlewares.CodeInternal, "failed to revoke API key")
+			return
+		}
+		logger.Info("revoked API key", "id", pathParams["id"], "by", principal.Subject)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func newAPIKeyResponse(record auth.APIKey) APIKeyResponse {
+	return APIKeyResponse{
+		ID:         record.ID,
+		Name:       record.Name,
+		Scopes:     record.Scopes,
+		CreatedAt:  record.CreatedAt,
+		ExpiresAt:  record.ExpiresAt,
+		LastUsedAt: record.LastUsedAt,
+		RevokedAt:  record.RevokedAt,
+	}
+}
@@ -0,0 +1,93 @@
+// Package handlers serves the gateway's own HTTP endpoints: login, token
+// refresh and logout, the JWKS, the health probes and the admin API for
+// revocations and API keys. Requests to the admin endpoints and /logout are
+// expected to have been authorized by the middlewares.Authorizer.
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	internal "github.com/ilivestrong/oms-gateway/internal"
+	"github.com/ilivestrong/oms-gateway/internal/middlewares"
+)
+
+const (
+	readinessReady    = "ready"
+	readinessNotReady = "not ready"
+	readinessDraining = "draining"
+)
+
+var (
+	EncodingTypeJSON            string = "json"
+	ErrInvalidTokenRequest             = "email missing in the request"
+	ErrMissingPassword                 = "password missing in the request"
+	ErrInvalidRefreshRequest           = "refresh_token missing in the request"
+	ErrInvalidLogoutRequest            = "failed parse logout request"
+	ErrInvalidRevocationRequest        = "subject missing in the request"
+	ErrAdminRequired                   = "admin scope required"
+	ErrLogoutRequiresBearer            = "logout requires a bearer token"
+	ErrInvalidAPIKeyRequest            = "name missing in the request"
+	ErrInvalidAPIKeyExpiry             = "expires_in must be a positive duration"
+	OAuthErrorInvalidRequest           = "invalid_request"
+	OAuthErrorInvalidGrant             = "invalid_grant"
+)
+
+type (
+	RefreshTokenRequest struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+	RevocationRequest struct {
+		Subject string `json:"subject"`
+	}
+	CreateAPIKeyRequest struct {
+		Name   string   `json:"name"`
+		Scopes []string `json:"scopes"`
+		// ExpiresIn is a Go duration such as "720h".
+		ExpiresIn string `json:"expires_in"`
+	}
+	// APIKeyResponse describes an API key without its hash. Key is only set
+	// in the response to creating the key.
+	APIKeyResponse struct {
+		ID         string     `json:"id"`
+		Name       string     `json:"name"`
+		Key        string     `json:"key,omitempty"`
+		Scopes     []string   `json:"scopes"`
+		CreatedAt  time.Time  `json:"created_at"`
+		ExpiresAt  time.Time  `json:"expires_at"`
+		LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+		RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+	}
+	ListAPIKeysResponse struct {
+		APIKeys []APIKeyResponse `json:"api_keys"`
+	}
+	OAuthError struct {
+		Error       string `json:"error"`
+		Description string `json:"error_description,omitempty"`
+	}
+	ReadinessResponse struct {
+		Status   string                   `json:"status"`
+		Backends []internal.BackendHealth `json:"backends,omitempty"`
+	}
+)
+
+func sendProblem(w http.ResponseWriter, r *http.Request, status int, code, detail string) {
+	middlewares.WriteProblem(w, r, middlewares.NewProblem(status, code, detail))
+}
+
+// sendOAuthError answers the token refresh endpoint in the error format of
+// RFC 6749, section 5.2, which OAuth clients expect instead of a problem.
+func sendOAuthError(w http.ResponseWriter, code, description string, status int) {
+	errBytes, _ := json.Marshal(OAuthError{Error: code, Description: description})
+	w.Header().Set("Cache-Control", "no-store")
+	sendResponse(w, errBytes, EncodingTypeJSON, status)
+}
+
+func sendResponse(w http.ResponseWriter, bodyBytes []byte, encoding string, status int) {
+	if encoding == EncodingTypeJSON {
+		w.Header().Set("Content-Type", "application/json")
+	}
+	w.WriteHeader(status)
+	w.Write(bodyBytes)
+}
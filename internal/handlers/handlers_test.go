@@ -0,0 +1,356 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ilivestrong/oms-gateway/internal/auth"
+	"github.com/ilivestrong/oms-gateway/internal/middlewares"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	testUser     = "dev@example.com"
+	testPassword = "s3cret"
+)
+
+type testGateway struct {
+	authenticator *auth.Authenticator
+	tokenIssuer   *auth.TokenIssuer
+	verifier      *auth.TokenVerifier
+	revocations   *auth.MemoryRevocationList
+	apiKeys       *auth.APIKeys
+}
+
+func newTestGateway(t *testing.T) *testGateway {
+	t.Helper()
+	hash, err := bcrypt.GenerateFromPassword([]byte(testPassword), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	users := auth.NewMemoryUserStore(auth.User{Username: testUser, PasswordHash: string(hash)})
+	keys, err := auth.LoadKeySet(auth.KeyConfig{Keys: "a:0123456789abcdef0123456789abcdef"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	revocations := auth.NewMemoryRevocationList()
+	cfg := auth.TokenConfig{Leeway: auth.DefaultTokenLeeway}
+	return &testGateway{
+		authenticator: auth.NewAuthenticator(users, auth.LockoutConfig{}),
+		tokenIssuer:   auth.NewTokenIssuer(keys, cfg, users, auth.NewMemoryRefreshTokenStore(), revocations),
+		verifier:      auth.NewTokenVerifier(keys, cfg, revocations, nil),
+		revocations:   revocations,
+		apiKeys:       auth.NewAPIKeys(auth.NewMemoryAPIKeyStore(), []string{auth.ScopeAdmin, auth.ScopeOrdersAdmin}, slog.Default()),
+	}
+}
+
+// login returns the tokens issued to testUser.
+func (g *testGateway) login(t *testing.T) *auth.TokenResponse {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	body := `{"email": "` + testUser + `", "password": "` + testPassword + `"}`
+	Login(g.authenticator, g.tokenIssuer, nil, slog.Default())(rec, httptest.NewRequest(http.MethodPost, "/login", strings.NewReader(body)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("login: status = %d, body %s", rec.Code, rec.Body)
+	}
+	var token auth.TokenResponse
+	if err := json.NewDecoder(rec.Body).Decode(&token); err != nil {
+		t.Fatal(err)
+	}
+	return &token
+}
+
+// newRequest returns a request authorized as principal, as the
+// middlewares.Authorizer would pass it on.
+func newRequest(method, target, body string, principal *auth.Principal) *http.Request {
+	r := httptest.NewRequest(method, target, strings.NewReader(body))
+	if principal != nil {
+		r = r.WithContext(auth.NewContext(r.Context(), principal))
+	}
+	return r
+}
+
+func decodeProblem(t *testing.T, rec *httptest.ResponseRecorder) middlewares.Problem {
+	t.Helper()
+	var p middlewares.Problem
+	if err := json.NewDecoder(rec.Body).Decode(&p); err != nil {
+		t.Fatalf("decoding problem: %v", err)
+	}
+	return p
+}
+
+var adminPrincipal = &auth.Principal{Subject: "admin@example.com", Scopes: []string{auth.ScopeAdmin}, AuthScheme: auth.SchemeBearer}
+
+func TestLogin(t *testing.T) {
+	tests := []struct {
+		name       string
+		body       string
+		wantStatus int
+		wantCode   string
+	}{
+		{name: "malformed body", body: `{`, wantStatus: http.StatusBadRequest, wantCode: middlewares.CodeInvalidRequest},
+		{name: "missing email", body: `{"password": "` + testPassword + `"}`, wantStatus: http.StatusBadRequest, wantCode: middlewares.CodeInvalidRequest},
+		{name: "missing password", body: `{"email": "` + testUser + `"}`, wantStatus: http.StatusBadRequest, wantCode: middlewares.CodeInvalidRequest},
+		{name: "wrong password", body: `{"email": "` + testUser + `", "password": "guess"}`, wantStatus: http.StatusUnauthorized, wantCode: middlewares.CodeInvalidCredentials},
+		{name: "unknown user", body: `{"email": "nobody@example.com", "password": "guess"}`, wantStatus: http.StatusUnauthorized, wantCode: middlewares.CodeInvalidCredentials},
+	}
+	g := newTestGateway(t)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			Login(g.authenticator, g.tokenIssuer, nil, slog.Default())(rec, httptest.NewRequest(http.MethodPost, "/login", strings.NewReader(tt.body)))
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			if p := decodeProblem(t, rec); p.Code != tt.wantCode {
+				t.Errorf("code = %q, want %q", p.Code, tt.wantCode)
+			}
+		})
+	}
+
+	t.Run("valid credentials", func(t *testing.T) {
+		token := g.login(t)
+		if token.TokenType != auth.TokenTypeBearer || token.RefreshToken == "" {
+			t.Errorf("token = %+v", token)
+		}
+		principal, err := g.verifier.Verify(context.Background(), token.Token)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if principal.Subject != testUser {
+			t.Errorf("subject = %q, want %q", principal.Subject, testUser)
+		}
+	})
+}
+
+func TestRefresh(t *testing.T) {
+	g := newTestGateway(t)
+	refreshToken := g.login(t).RefreshToken
+
+	tests := []struct {
+		name       string
+		body       string
+		wantStatus int
+		wantError  string
+	}{
+		{name: "rotated", body: `{"refresh_token": "` + refreshToken + `"}`, wantStatus: http.StatusOK},
+		{name: "reused", body: `{"refresh_token": "` + refreshToken + `"}`, wantStatus: http.StatusBadRequest, wantError: OAuthErrorInvalidGrant},
+		{name: "unknown", body: `{"refresh_token": "unknown"}`, wantStatus: http.StatusBadRequest, wantError: OAuthErrorInvalidGrant},
+		{name: "missing", body: `{}`, wantStatus: http.StatusBadRequest, wantError: OAuthErrorInvalidRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			Refresh(g.tokenIssuer, nil, slog.Default())(rec, httptest.NewRequest(http.MethodPost, "/token/refresh", strings.NewReader(tt.body)))
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d (body %s)", rec.Code, tt.wantStatus, rec.Body)
+			}
+			if cc := rec.Header().Get("Cache-Control"); cc != "no-store" {
+				t.Errorf("Cache-Control = %q, want no-store", cc)
+			}
+			if tt.wantError == "" {
+				return
+			}
+			var oauthErr OAuthError
+			if err := json.NewDecoder(rec.Body).Decode(&oauthErr); err != nil {
+				t.Fatal(err)
+			}
+			if oauthErr.Error != tt.wantError {
+				t.Errorf("error = %q, want %q", oauthErr.Error, tt.wantError)
+			}
+		})
+	}
+
+	rec := httptest.NewRecorder()
+	Refresh(g.tokenIssuer, nil, slog.Default())(rec, httptest.NewRequest(http.MethodGet, "/token/refresh", nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("GET: status = %d, want %d", rec.Code, http.StatusMethodNotAllowed)
+	}
+}
+
+func TestLogout(t *testing.T) {
+	g := newTestGateway(t)
+	token := g.login(t)
+	principal, err := g.verifier.Verify(context.Background(), token.Token)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rec := httptest.NewRecorder()
+	body := `{"refresh_token": "` + token.RefreshToken + `"}`
+	Logout(g.tokenIssuer, slog.Default())(rec, newRequest(http.MethodPost, "/logout", body, principal), nil)
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("status = %d, want %d (body %s)", rec.Code, http.StatusNoContent, rec.Body)
+	}
+	if _, err := g.verifier.Verify(context.Background(), token.Token); err == nil {
+		t.Error("the access token is still accepted")
+	}
+	if _, err := g.tokenIssuer.Refresh(context.Background(), token.RefreshToken); err == nil {
+		t.Error("the refresh token is still accepted")
+	}
+
+	tests := []struct {
+		name       string
+		principal  *auth.Principal
+		wantStatus int
+	}{
+		{name: "unauthenticated", wantStatus: http.StatusUnauthorized},
+		{name: "API key", principal: &auth.Principal{Subject: "ci", AuthScheme: auth.SchemeAPIKey}, wantStatus: http.StatusBadRequest},
+		{name: "token without jti", principal: &auth.Principal{Subject: testUser, AuthScheme: auth.SchemeBearer}, wantStatus: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			Logout(g.tokenIssuer, slog.Default())(rec, newRequest(http.MethodPost, "/logout", "", tt.principal), nil)
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d (body %s)", rec.Code, tt.wantStatus, rec.Body)
+			}
+		})
+	}
+}
+
+func TestAdminHandlersRequireAdminScope(t *testing.T) {
+	g := newTestGateway(t)
+	handlers := map[string]func(w http.ResponseWriter, r *http.Request, pathParams map[string]string){
+		"RevokeSubject": RevokeSubject(g.tokenIssuer, slog.Default()),
+		"CreateAPIKey":  CreateAPIKey(g.apiKeys, slog.Default()),
+		"ListAPIKeys":   ListAPIKeys(g.apiKeys, slog.Default()),
+		"RevokeAPIKey":  RevokeAPIKey(g.apiKeys, slog.Default()),
+	}
+	principals := map[string]*auth.Principal{
+		"unauthenticated": nil,
+		"without admin":   {Subject: testUser, Scopes: []string{auth.ScopeOrdersAdmin}, AuthScheme: auth.SchemeBearer},
+	}
+	for name, handler := range handlers {
+		for caller, principal := range principals {
+			t.Run(name+"/"+caller, func(t *testing.T) {
+				rec := httptest.NewRecorder()
+				handler(rec, newRequest(http.MethodPost, "/admin", `{"subject": "x", "name": "x"}`, principal), map[string]string{"id": "x"})
+				if rec.Code != http.StatusForbidden {
+					t.Fatalf("status = %d, want %d", rec.Code, http.StatusForbidden)
+				}
+				p := decodeProblem(t, rec)
+				if p.Code != middlewares.ErrInsufficientScope || len(p.RequiredScopes) != 1 || p.RequiredScopes[0] != auth.ScopeAdmin {
+					t.Errorf("problem = %+v, want %s requiring %s", p, middlewares.ErrInsufficientScope, auth.ScopeAdmin)
+				}
+			})
+		}
+	}
+}
+
+func TestRevokeSubject(t *testing.T) {
+	g := newTestGateway(t)
+	handler := RevokeSubject(g.tokenIssuer, slog.Default())
+
+	rec := httptest.NewRecorder()
+	handler(rec, newRequest(http.MethodPost, "/admin/revocations", `{"subject": " "}`, adminPrincipal), nil)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("blank subject: status = %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+
+	rec = httptest.NewRecorder()
+	handler(rec, newRequest(http.MethodPost, "/admin/revocations", `{"subject": "`+testUser+`"}`, adminPrincipal), nil)
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("status = %d, want %d (body %s)", rec.Code, http.StatusNoContent, rec.Body)
+	}
+	// Tokens issued in the second of the revocation are kept, so check one
+	// issued before it.
+	revoked, err := g.revocations.Revoked(context.Background(), "", testUser, time.Now().Add(-time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !revoked {
+		t.Error("the subject's tokens are not revoked")
+	}
+}
+
+func TestAPIKeyHandlers(t *testing.T) {
+	g := newTestGateway(t)
+
+	tests := []struct {
+		name       string
+		body       string
+		wantStatus int
+	}{
+		{name: "missing name", body: `{"scopes": ["admin"]}`, wantStatus: http.StatusBadRequest},
+		{name: "malformed expiry", body: `{"name": "ci", "expires_in": "soon"}`, wantStatus: http.StatusBadRequest},
+		{name: "negative expiry", body: `{"name": "ci", "expires_in": "-1h"}`, wantStatus: http.StatusBadRequest},
+		{name: "unknown scope", body: `{"name": "ci", "scopes": ["root"]}`, wantStatus: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			CreateAPIKey(g.apiKeys, slog.Default())(rec, newRequest(http.MethodPost, "/admin/api-keys", tt.body, adminPrincipal), nil)
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d (body %s)", rec.Code, tt.wantStatus, rec.Body)
+			}
+		})
+	}
+
+	rec := httptest.NewRecorder()
+	body := `{"name": "ci", "scopes": ["orders:admin"], "expires_in": "720h"}`
+	CreateAPIKey(g.apiKeys, slog.Default())(rec, newRequest(http.MethodPost, "/admin/api-keys", body, adminPrincipal), nil)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("create: status = %d, want %d (body %s)", rec.Code, http.StatusCreated, rec.Body)
+	}
+	if cc := rec.Header().Get("Cache-Control"); cc != "no-store" {
+		t.Errorf("create: Cache-Control = %q, want no-store", cc)
+	}
+	var created APIKeyResponse
+	if err := json.NewDecoder(rec.Body).Decode(&created); err != nil {
+		t.Fatal(err)
+	}
+	if created.Key == "" || created.Name != "ci" {
+		t.Fatalf("created = %+v", created)
+	}
+	if _, err := g.apiKeys.Authenticate(context.Background(), created.Key); err != nil {
+		t.Errorf("the created key is not accepted: %v", err)
+	}
+
+	rec = httptest.NewRecorder()
+	ListAPIKeys(g.apiKeys, slog.Default())(rec, newRequest(http.MethodGet, "/admin/api-keys", "", adminPrincipal), nil)
+	var list ListAPIKeysResponse
+	if err := json.NewDecoder(rec.Body).Decode(&list); err != nil {
+		t.Fatal(err)
+	}
+	if len(list.APIKeys) != 1 || list.APIKeys[0].ID != created.ID || list.APIKeys[0].Key != "" {
+		t.Errorf("list = %+v, want the created key without its secret", list)
+	}
+
+	rec = httptest.NewRecorder()
+	RevokeAPIKey(g.apiKeys, slog.Default())(rec, newRequest(http.MethodDelete, "/admin/api-keys/unknown", "", adminPrincipal), map[string]string{"id": "unknown"})
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("revoke unknown: status = %d, want %d", rec.Code, http.StatusNotFound)
+	}
+
+	rec = httptest.NewRecorder()
+	RevokeAPIKey(g.apiKeys, slog.Default())(rec, newRequest(http.MethodDelete, "/admin/api-keys/"+created.ID, "", adminPrincipal), map[string]string{"id": created.ID})
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("revoke: status = %d, want %d (body %s)", rec.Code, http.StatusNoContent, rec.Body)
+	}
+	if _, err := g.apiKeys.Authenticate(context.Background(), created.Key); err == nil {
+		t.Error("the revoked key is still accepted")
+	}
+}
+
+func TestJWKS(t *testing.T) {
+	keys, err := auth.LoadKeySet(auth.KeyConfig{Keys: "a:0123456789abcdef0123456789abcdef"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec := httptest.NewRecorder()
+	JWKS(keys, slog.Default())(rec, httptest.NewRequest(http.MethodGet, "/.well-known/jwks.json", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusOK)
+	}
+	// HMAC secrets are never published.
+	if body := rec.Body.String(); strings.Contains(body, `"kid":"a"`) {
+		t.Errorf("JWKS = %s, published the HS256 key", body)
+	}
+}
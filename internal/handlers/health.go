@@ -0,0 +1,37 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	internal "github.com/ilivestrong/oms-gateway/internal"
+)
+
+// Health answers liveness probes. It stays up while draining so the
+// process is not restarted during shutdown.
+func Health(w http.ResponseWriter, r *http.Request) {
+	sendResponse(w, []byte("ok"), "", http.StatusOK)
+}
+
+// Ready checks every backend on each call and answers 503 once
+// shutdown has started or while any backend is not ready.
+func Ready(svc *internal.Service, timeout time.Duration) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if svc.IsNotReady() {
+			respBytes, _ := json.Marshal(ReadinessResponse{Status: readinessDraining})
+			sendResponse(w, respBytes, EncodingTypeJSON, http.StatusServiceUnavailable)
+			return
+		}
+
+		resp := ReadinessResponse{Status: readinessReady, Backends: svc.CheckBackends(r.Context(), timeout)}
+		code := http.StatusOK
+		for _, backend := range resp.Backends {
+			if !backend.Ready {
+				resp.Status, code = readinessNotReady, http.StatusServiceUnavailable
+			}
+		}
+		respBytes, _ := json.Marshal(resp)
+		sendResponse(w, respBytes, EncodingTypeJSON, code)
+	}
+}
@@ -0,0 +1,168 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"github.com/ilivestrong/oms-gateway/internal/auth"
+	"github.com/ilivestrong/oms-gateway/internal/metrics"
+	"github.com/ilivestrong/oms-gateway/internal/middlewares"
+)
+
+// Login exchanges the email and password of a user for an access token and a
+// refresh token.
+func Login(authenticator *auth.Authenticator, tokenIssuer *auth.TokenIssuer, m *metrics.Metrics, logger *slog.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		tokenRequest, err := getTokenRequest(r)
+		if err != nil {
+			sendProblem(w, r, http.StatusBadRequest, middlewares.CodeInvalidRequest, err.Error())
+			return
+		}
+
+		if strings.Trim(tokenRequest.Email, " ") == "" {
+			sendProblem(w, r, http.StatusBadRequest, middlewares.CodeInvalidRequest, ErrInvalidTokenRequest)
+			return
+		}
+		if tokenRequest.Password == "" {
+			sendProblem(w, r, http.StatusBadRequest, middlewares.CodeInvalidRequest, ErrMissingPassword)
+			return
+		}
+
+		user, err := authenticator.Authenticate(r.Context(), tokenRequest.Email, tokenRequest.Password)
+		if errors.Is(err, auth.ErrInvalidCredentials) {
+			m.AuthFailure(middlewares.CodeInvalidCredentials)
+			sendProblem(w, r, http.StatusUnauthorized, middlewares.CodeInvalidCredentials, err.Error())
+			return
+		}
+		if err != nil {
+			logger.Error("Login:", "err", fmt.Sprintf("failed to authenticate: %v", err))
+			sendProblem(w, r, http.StatusInternalServerError, middlewares.CodeInternal, "failed to authenticate")
+			return
+		}
+
+		token, err := tokenIssuer.GenerateAccessToken(r.Context(), user)
+		if err != nil {
+			logger.Error("Login:", "err", fmt.Sprintf("failed to create token: %v", err))
+			sendProblem(w, r, http.StatusInternalServerError, middlewares.CodeInternal, "failed to create token")
+			return
+		}
+		sendTokenResponse(w, r, token, logger)
+	}
+}
+
+// Refresh implements the refresh_token grant. Errors use the OAuth 2.0
+// error response format (RFC 6749, section 5.2).
+func Refresh(tokenIssuer *auth.TokenIssuer, m *metrics.Metrics, logger *slog.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			sendProblem(w, r, http.StatusMethodNotAllowed, middlewares.CodeMethodNotAllowed, "method not allowed")
+			return
+		}
+
+		var refreshRequest RefreshTokenRequest
+		if err := json.NewDecoder(r.Body).Decode(&refreshRequest); err != nil || refreshRequest.RefreshToken == "" {
+			sendOAuthError(w, OAuthErrorInvalidRequest, ErrInvalidRefreshRequest, http.StatusBadRequest)
+			return
+		}
+
+		token, err := tokenIssuer.Refresh(r.Context(), refreshRequest.RefreshToken)
+		if errors.Is(err, auth.ErrInvalidRefreshToken) {
+			m.AuthFailure("invalid_refresh_token")
+			sendOAuthError(w, OAuthErrorInvalidGrant, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			logger.Error("Refresh:", "err", fmt.Sprintf("failed to refresh token: %v", err))
+			sendProblem(w, r, http.StatusInternalServerError, middlewares.CodeInternal, "failed to refresh token")
+			return
+		}
+		sendTokenResponse(w, r, token, logger)
+	}
+}
+
+// Logout revokes the access token the request was authorized with and,
+// when a refresh_token is sent in the body, its whole refresh token family.
+func Logout(tokenIssuer *auth.TokenIssuer, logger *slog.Logger) runtime.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request, _ map[string]string) {
+		principal, ok := auth.PrincipalFromContext(r.Context())
+		if !ok {
+			sendProblem(w, r, http.StatusUnauthorized, middlewares.CodeMissingCredentials, middlewares.ErrAuthHeaderMissing)
+			return
+		}
+		if principal.AuthScheme != auth.SchemeBearer {
+			sendProblem(w, r, http.StatusBadRequest, middlewares.CodeInvalidRequest, ErrLogoutRequiresBearer)
+			return
+		}
+
+		var logoutRequest RefreshTokenRequest
+		if err := json.NewDecoder(r.Body).Decode(&logoutRequest); err != nil && !errors.Is(err, io.EOF) {
+			sendProblem(w, r, http.StatusBadRequest, middlewares.CodeInvalidRequest, ErrInvalidLogoutRequest)
+			return
+		}
+
+		err := tokenIssuer.RevokeAccessToken(r.Context(), principal)
+		if errors.Is(err, auth.ErrTokenNotRevocable) {
+			sendProblem(w, r, http.StatusBadRequest, middlewares.CodeInvalidRequest, err.Error())
+			return
+		}
+		if err != nil {
+			logger.Error("Logout:", "err", fmt.Sprintf("failed to revoke access token: %v", err))
+			sendProblem(w, r, http.StatusInternalServerError, middlewares.CodeInternal, "failed to revoke token")
+			return
+		}
+		if logoutRequest.RefreshToken != "" {
+			if err := tokenIssuer.RevokeRefreshToken(r.Context(), logoutRequest.RefreshToken); err != nil {
+				logger.Error("Logout:", "err", fmt.Sprintf("failed to revoke refresh token: %v", err))
+				sendProblem(w, r, http.StatusInternalServerError, middlewares.CodeInternal, "failed to revoke token")
+				return
+			}
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func sendTokenResponse(w http.ResponseWriter, r *http.Request, token *auth.TokenResponse, logger *slog.Logger) {
+	tokenBytes, err := json.Marshal(token)
+	if err != nil {
+		logger.Error("sendTokenResponse:", "err", fmt.Sprintf("failed to encode token: %v", err))
+		sendProblem(w, r, http.StatusInternalServerError, middlewares.CodeInternal, "failed to create token")
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	sendResponse(w, tokenBytes, EncodingTypeJSON, http.StatusOK)
+}
+
+func getTokenRequest(req *http.Request) (*auth.TokenRequest, error) {
+	body, err := io.ReadAll(req.Body)
+	if err != nil {
+		return nil, errors.New("failed to read login request")
+	}
+	defer req.Body.Close()
+
+	var tokenRequest auth.TokenRequest
+	err = json.Unmarshal(body, &tokenRequest)
+	if err != nil {
+		return nil, errors.New("failed parse request data")
+	}
+	return &tokenRequest, nil
+}
+
+// JWKS publishes the public keys tokens are verified with.
+func JWKS(keys *auth.KeySet, logger *slog.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		jwksBytes, err := json.Marshal(keys.JWKS())
+		if err != nil {
+			logger.Error("JWKS:", "err", fmt.Sprintf("failed to encode JWKS: %v", err))
+			sendProblem(w, r, http.StatusInternalServerError, middlewares.CodeInternal, "failed to encode JWKS")
+			return
+		}
+		w.Header().Set("Cache-Control", "public, max-age=300")
+		sendResponse(w, jwksBytes, EncodingTypeJSON, http.StatusOK)
+	}
+}
@@ -0,0 +1,92 @@
+package internal
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/connectivity"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+)
+
+const DefaultHealthCheckTimeout = 2 * time.Second
+
+// HealthCheckUnimplemented is reported for backends that do not serve the
+// grpc.health.v1 service. They count as ready as long as they answered.
+const HealthCheckUnimplemented = "UNIMPLEMENTED"
+
+// BackendHealth is the result of checking one backend.
+type BackendHealth struct {
+	Backend string `json:"backend"`
+	// State is the connectivity state of the connection after the check.
+	State string `json:"state"`
+	// Status is the serving status reported by grpc.health.v1.
+	Status string `json:"status,omitempty"`
+	Error  string `json:"error,omitempty"`
+	Ready  bool   `json:"ready"`
+	// Circuits is the state of the circuit breaker of each method called so
+	// far. Open breakers do not make the backend unready.
+	Circuits map[string]string `json:"circuits,omitempty"`
+}
+
+// CheckBackends runs a grpc.health.v1 check against each backend in
+// parallel. A backend is ready when it reports SERVING, or does not implement
+// the health service, and its last TLS handshake did not fail.
+func (svc *Service) CheckBackends(ctx context.Context, timeout time.Duration) []BackendHealth {
+	if timeout <= 0 {
+		timeout = DefaultHealthCheckTimeout
+	}
+	backends := []struct {
+		name string
+		conn *grpc.ClientConn
+	}{
+		{OrderBackend, svc.OrderSvcClientConn},
+		{ProductBackend, svc.ProductSvcClientConn},
+	}
+	handshakeErrs := svc.HandshakeErrors()
+
+	results := make([]BackendHealth, len(backends))
+	var wg sync.WaitGroup
+	for i, backend := range backends {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i] = checkBackend(ctx, backend.name, backend.conn, timeout)
+			results[i].Circuits = svc.CircuitStates(backend.name)
+			if err, ok := handshakeErrs[backend.name]; ok {
+				results[i].Ready = false
+				results[i].Error = err.Error()
+			}
+		}()
+	}
+	wg.Wait()
+	return results
+}
+
+func checkBackend(ctx context.Context, name string, conn *grpc.ClientConn, timeout time.Duration) BackendHealth {
+	result := BackendHealth{Backend: name}
+	if conn == nil {
+		result.State = connectivity.Shutdown.String()
+		result.Error = "not connected"
+		return result
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	resp, err := healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{})
+	result.State = conn.GetState().String()
+	switch {
+	case status.Code(err) == codes.Unimplemented:
+		result.Status = HealthCheckUnimplemented
+		result.Ready = true
+	case err != nil:
+		result.Error = status.Convert(err).Message()
+	default:
+		result.Status = resp.GetStatus().String()
+		result.Ready = resp.GetStatus() == healthpb.HealthCheckResponse_SERVING
+	}
+	return result
+}
@@ -0,0 +1,68 @@
+package metrics
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ilivestrong/oms-gateway/internal/recorder"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+)
+
+// Middleware records every request under the route pattern returned by
+// route, which should return UnmatchedRoute for unknown paths.
+func (m *Metrics) Middleware(route func(r *http.Request) string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if m == nil {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			rec := recorder.Wrap(w)
+			next.ServeHTTP(rec, r)
+			m.ObserveHTTPRequest(r.Method, route(r), rec.Status(), time.Since(start))
+		})
+	}
+}
+
+// UnaryServerInterceptor records requests to the gateway's gRPC listener. It
+// should run first so requests rejected by later interceptors are counted.
+func (m *Metrics) UnaryServerInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	if m == nil {
+		return handler(ctx, req)
+	}
+	start := time.Now()
+	resp, err := handler(ctx, req)
+	code := status.Code(err).String()
+	m.grpcRequests.WithLabelValues(info.FullMethod, code).Inc()
+	m.grpcRequestDuration.WithLabelValues(info.FullMethod, code).Observe(time.Since(start).Seconds())
+	return resp, err
+}
+
+// UnaryClientInterceptor records the RPCs made to a backend. Methods are
+// labelled without their proto package, e.g. "ProductService/Get".
+func (m *Metrics) UnaryClientInterceptor(backend string) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		if m == nil {
+			return invoker(ctx, method, req, reply, cc, opts...)
+		}
+		start := time.Now()
+		err := invoker(ctx, method, req, reply, cc, opts...)
+		methodLabel := BackendMethod(method)
+		code := status.Code(err).String()
+		m.backendRequests.WithLabelValues(backend, methodLabel, code).Inc()
+		m.backendDuration.WithLabelValues(backend, methodLabel, code).Observe(time.Since(start).Seconds())
+		return err
+	}
+}
+
+// BackendMethod turns "/oms.ProductService/Get" into "ProductService/Get".
+func BackendMethod(fullMethod string) string {
+	service, method, _ := strings.Cut(strings.TrimPrefix(fullMethod, "/"), "/")
+	if i := strings.LastIndex(service, "."); i >= 0 {
+		service = service[i+1:]
+	}
+	return service + "/" + method
+}
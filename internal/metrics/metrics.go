@@ -0,0 +1,250 @@
+// Package metrics collects the gateway's Prometheus metrics. A nil *Metrics
+// is valid and records nothing, so components work without metrics wired in.
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/connectivity"
+)
+
+const namespace = "oms_gateway"
+
+// UnmatchedRoute labels HTTP requests that match no known route, so unknown
+// paths cannot grow the number of series.
+const UnmatchedRoute = "unmatched"
+
+var connectivityStates = []connectivity.State{
+	connectivity.Idle,
+	connectivity.Connecting,
+	connectivity.Ready,
+	connectivity.TransientFailure,
+	connectivity.Shutdown,
+}
+
+type Metrics struct {
+	registry *prometheus.Registry
+
+	httpRequests        *prometheus.CounterVec
+	httpRequestDuration *prometheus.HistogramVec
+	grpcRequests        *prometheus.CounterVec
+	grpcRequestDuration *prometheus.HistogramVec
+	backendRequests     *prometheus.CounterVec
+	backendDuration     *prometheus.HistogramVec
+	backendAttempts     *prometheus.HistogramVec
+	rateLimitRejections *prometheus.CounterVec
+	rateLimitErrors     prometheus.Counter
+	authFailures        *prometheus.CounterVec
+	backendConnState    *prometheus.Desc
+	circuitState        *prometheus.GaugeVec
+	circuitRejections   *prometheus.CounterVec
+
+	mu       sync.RWMutex
+	backends map[string]*grpc.ClientConn
+}
+
+func New() *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		httpRequests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "http_requests_total",
+			Help:      "HTTP requests by method, route pattern and status code.",
+		}, []string{"method", "route", "status"}),
+		httpRequestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "http_request_duration_seconds",
+			Help:      "Latency of HTTP requests by method, route pattern and status code.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"method", "route", "status"}),
+		grpcRequests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "grpc_requests_total",
+			Help:      "Requests to the gateway's gRPC listener by method and status code.",
+		}, []string{"method", "code"}),
+		grpcRequestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "grpc_request_duration_seconds",
+			Help:      "Latency of requests to the gateway's gRPC listener by method and status code.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"method", "code"}),
+		backendRequests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "backend_requests_total",
+			Help:      "RPCs to the backends by backend, method and status code.",
+		}, []string{"backend", "method", "code"}),
+		backendDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "backend_request_duration_seconds",
+			Help:      "Latency of RPCs to the backends by backend, method and status code.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"backend", "method", "code"}),
+		backendAttempts: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "backend_request_attempts",
+			Help:      "Attempts made per RPC to the backends, including retries and hedged attempts, by backend and method.",
+			Buckets:   []float64{1, 2, 3, 4, 5},
+		}, []string{"backend", "method"}),
+		rateLimitRejections: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "rate_limit_rejections_total",
+			Help:      "Requests rejected by the rate limiter by rule.",
+		}, []string{"rule"}),
+		rateLimitErrors: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "rate_limit_errors_total",
+			Help:      "Rate limit decisions that failed because the limiter store errored.",
+		}),
+		authFailures: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "auth_failures_total",
+			Help:      "Failed authentications and authorizations by reason.",
+		}, []string{"reason"}),
+		backendConnState: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "backend", "connection_state"),
+			"Connectivity state of each backend connection; 1 for the current state.",
+			[]string{"backend", "state"}, nil,
+		),
+		circuitState: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "circuit_breaker_state",
+			Help:      "State of each backend method's circuit breaker; 1 for the current state.",
+		}, []string{"backend", "method", "state"}),
+		circuitRejections: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "circuit_breaker_rejections_total",
+			Help:      "RPCs to the backends rejected by an open circuit breaker by backend and method.",
+		}, []string{"backend", "method"}),
+		backends: make(map[string]*grpc.ClientConn),
+	}
+	m.registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.httpRequests,
+		m.httpRequestDuration,
+		m.grpcRequests,
+		m.grpcRequestDuration,
+		m.backendRequests,
+		m.backendDuration,
+		m.backendAttempts,
+		m.rateLimitRejections,
+		m.rateLimitErrors,
+		m.authFailures,
+		m.circuitState,
+		m.circuitRejections,
+		connStateCollector{m},
+	)
+	return m
+}
+
+// Handler serves the metrics in the Prometheus exposition format.
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
+
+// ObserveHTTPRequest records a request answered on the HTTP listener.
+func (m *Metrics) ObserveHTTPRequest(method, route string, status int, duration time.Duration) {
+	if m == nil {
+		return
+	}
+	statusLabel := strconv.Itoa(status)
+	m.httpRequests.WithLabelValues(method, route, statusLabel).Inc()
+	m.httpRequestDuration.WithLabelValues(method, route, statusLabel).Observe(duration.Seconds())
+}
+
+// ObserveBackendAttempts records how many attempts an RPC to backend took.
+// method is the full gRPC method name.
+func (m *Metrics) ObserveBackendAttempts(backend, method string, attempts int) {
+	if m == nil {
+		return
+	}
+	m.backendAttempts.WithLabelValues(backend, BackendMethod(method)).Observe(float64(attempts))
+}
+
+// RateLimitRejected records a request rejected by the rate limit rule.
+func (m *Metrics) RateLimitRejected(rule string) {
+	if m == nil {
+		return
+	}
+	m.rateLimitRejections.WithLabelValues(rule).Inc()
+}
+
+// RateLimitError records a limiter store failure, whatever the failure
+// policy decided.
+func (m *Metrics) RateLimitError() {
+	if m == nil {
+		return
+	}
+	m.rateLimitErrors.Inc()
+}
+
+// AuthFailure records a rejected caller. reason is one of a small fixed set
+// of values chosen by the caller, never an error message.
+func (m *Metrics) AuthFailure(reason string) {
+	if m == nil {
+		return
+	}
+	m.authFailures.WithLabelValues(reason).Inc()
+}
+
+// CircuitBreakerStateChanged records the transition of the circuit breaker
+// of a backend method from one state to another. method is the full gRPC
+// method name.
+func (m *Metrics) CircuitBreakerStateChanged(backend, method, from, to string) {
+	if m == nil {
+		return
+	}
+	methodLabel := BackendMethod(method)
+	m.circuitState.WithLabelValues(backend, methodLabel, from).Set(0)
+	m.circuitState.WithLabelValues(backend, methodLabel, to).Set(1)
+}
+
+// CircuitBreakerRejected records an RPC rejected by an open circuit breaker.
+func (m *Metrics) CircuitBreakerRejected(backend, method string) {
+	if m == nil {
+		return
+	}
+	m.circuitRejections.WithLabelValues(backend, BackendMethod(method)).Inc()
+}
+
+// AddBackend reports the connectivity state of conn under name.
+func (m *Metrics) AddBackend(name string, conn *grpc.ClientConn) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.backends[name] = conn
+}
+
+// connStateCollector reads the state of the backend connections at scrape
+// time.
+type connStateCollector struct {
+	m *Metrics
+}
+
+func (c connStateCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.m.backendConnState
+}
+
+func (c connStateCollector) Collect(ch chan<- prometheus.Metric) {
+	c.m.mu.RLock()
+	defer c.m.mu.RUnlock()
+	for name, conn := range c.m.backends {
+		current := conn.GetState()
+		for _, state := range connectivityStates {
+			value := 0.0
+			if state == current {
+				value = 1
+			}
+			ch <- prometheus.MustNewConstMetric(c.m.backendConnState, prometheus.GaugeValue, value, name, state.String())
+		}
+	}
+}
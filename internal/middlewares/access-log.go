@@ -0,0 +1,180 @@
+package middlewares
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"net"
+	"net/http"
+	"slices"
+	"sync/atomic"
+	"time"
+
+	"github.com/ilivestrong/oms-gateway/internal/recorder"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	RequestIDHeader      = "X-Request-ID"
+	RequestIDMetadataKey = "x-request-id"
+	maxRequestIDLength   = 128
+)
+
+type requestIDKey struct{}
+
+// RequestIDFromContext returns the ID assigned to the request by the
+// AccessLogger.
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// ForwardRequestID is a client interceptor that passes the request ID on to
+// the backends as x-request-id metadata.
+func ForwardRequestID(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+	if id := RequestIDFromContext(ctx); id != "" {
+		ctx = metadata.AppendToOutgoingContext(ctx, RequestIDMetadataKey, id)
+	}
+	return invoker(ctx, method, req, reply, cc, opts...)
+}
+
+// accessLogEntry collects what inner middlewares learn about a request, such
+// as the authenticated subject, for the access log line written at the end.
+type accessLogEntry struct {
+	subject         string
+	backendAttempts atomic.Int32
+}
+
+type accessLogEntryKey struct{}
+
+// recordSubject notes the authenticated caller for the access log.
+func recordSubject(ctx context.Context, subject string) {
+	if entry, ok := ctx.Value(accessLogEntryKey{}).(*accessLogEntry); ok {
+		entry.subject = subject
+	}
+}
+
+// AddBackendAttempts adds the attempts a backend call took to the request's
+// access log line.
+func AddBackendAttempts(ctx context.Context, attempts int) {
+	if entry, ok := ctx.Value(accessLogEntryKey{}).(*accessLogEntry); ok {
+		entry.backendAttempts.Add(int32(attempts))
+	}
+}
+
+// AccessLogger assigns each request an ID, taken from the X-Request-ID header
+// or x-request-id metadata when the caller sent a usable one, and writes one
+// log line per request once it is answered. Requests to quiet paths, such as
+// probes, are logged at debug level.
+type AccessLogger struct {
+	logger *slog.Logger
+	route  func(r *http.Request) string
+	quiet  []string
+}
+
+// NewAccessLogger logs HTTP requests under the route pattern returned by
+// route. quiet lists HTTP paths and full gRPC method names.
+func NewAccessLogger(logger *slog.Logger, route func(r *http.Request) string, quiet ...string) *AccessLogger {
+	return &AccessLogger{logger: logger, route: route, quiet: quiet}
+}
+
+func (al *AccessLogger) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		requestID := requestIDOrNew(r.Header.Get(RequestIDHeader))
+		w.Header().Set(RequestIDHeader, requestID)
+
+		entry := &accessLogEntry{}
+		ctx := context.WithValue(r.Context(), requestIDKey{}, requestID)
+		ctx = context.WithValue(ctx, accessLogEntryKey{}, entry)
+		rec := recorder.Wrap(w)
+		next.ServeHTTP(rec, r.WithContext(ctx))
+
+		al.log(ctx, r.URL.Path, "http request",
+			slog.String("method", r.Method),
+			slog.String("route", al.route(r)),
+			slog.Int("status", rec.Status()),
+			latencyAttr(start),
+			slog.Int64("bytes", rec.BytesWritten()),
+			slog.String("subject", entry.subject),
+			slog.String("client_ip", hostOf(r.RemoteAddr)),
+			slog.String("request_id", requestID),
+			slog.Int("backend_attempts", int(entry.backendAttempts.Load())),
+		)
+	})
+}
+
+func (al *AccessLogger) UnaryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	start := time.Now()
+	md, _ := metadata.FromIncomingContext(ctx)
+	requestID := requestIDOrNew(firstMetadataValue(md, RequestIDMetadataKey))
+	grpc.SetHeader(ctx, metadata.Pairs(RequestIDMetadataKey, requestID))
+
+	entry := &accessLogEntry{}
+	ctx = context.WithValue(ctx, requestIDKey{}, requestID)
+	ctx = context.WithValue(ctx, accessLogEntryKey{}, entry)
+	resp, err := handler(ctx, req)
+
+	var clientIP string
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		clientIP = hostOf(p.Addr.String())
+	}
+	al.log(ctx, info.FullMethod, "grpc request",
+		slog.String("method", info.FullMethod),
+		slog.String("code", status.Code(err).String()),
+		latencyAttr(start),
+		slog.String("subject", entry.subject),
+		slog.String("client_ip", clientIP),
+		slog.String("request_id", requestID),
+		slog.Int("backend_attempts", int(entry.backendAttempts.Load())),
+	)
+	return resp, err
+}
+
+func (al *AccessLogger) log(ctx context.Context, path, msg string, attrs ...slog.Attr) {
+	level := slog.LevelInfo
+	if slices.Contains(al.quiet, path) {
+		level = slog.LevelDebug
+	}
+	if spanContext := trace.SpanContextFromContext(ctx); spanContext.IsValid() {
+		attrs = append(attrs, slog.String("trace_id", spanContext.TraceID().String()))
+	}
+	al.logger.LogAttrs(ctx, level, msg, attrs...)
+}
+
+// requestIDOrNew keeps a caller supplied ID when it is short and made of
+// printable ASCII without spaces, so it cannot forge log fields or headers.
+func requestIDOrNew(id string) string {
+	if id != "" && len(id) <= maxRequestIDLength {
+		valid := true
+		for i := 0; i < len(id); i++ {
+			if id[i] <= ' ' || id[i] > '~' {
+				valid = false
+				break
+			}
+		}
+		if valid {
+			return id
+		}
+	}
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func latencyAttr(start time.Time) slog.Attr {
+	return slog.Float64("latency_ms", float64(time.Since(start).Microseconds())/1000)
+}
+
+func hostOf(addr string) string {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return addr
+	}
+	return host
+}
@@ -1,54 +1,228 @@
 package middlewares
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"net/http"
 	"strings"
 
-	"github.com/dgrijalva/jwt-go"
 	"github.com/ilivestrong/oms-gateway/internal/auth"
+	"github.com/ilivestrong/oms-gateway/internal/certs"
+	"github.com/ilivestrong/oms-gateway/internal/metrics"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
 )
 
 const (
-	ErrAuthHeaderMissing       = "Authorization header is missing"
-	ErrInvalidToken            = "invalid token"
-	ErrUnexpectedSigningMethod = "unexpected signing method"
-	BearerAuth                 = "Bearer "
-	JWTEncryptionAlgoHeader    = "alg"
-	AuthorizationHeader        = "Authorization"
-	LoginEndpointURL           = "/login"
+	ErrAuthHeaderMissing  = "Authorization header is missing"
+	ErrUnknownClientCert  = "client certificate is not authorized"
+	ErrInsufficientScope  = "insufficient_scope"
+	ErrAccessDenied       = "access_denied"
+	BearerAuth            = "Bearer "
+	APIKeyAuth            = "ApiKey "
+	AuthorizationHeader   = "Authorization"
+	APIKeyHeader          = "X-API-Key"
+	WWWAuthenticateHeader = "WWW-Authenticate"
 )
 
-func Authorize(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if r.URL.Path == LoginEndpointURL {
-			next.ServeHTTP(w, r)
-			return
+// AuthorizationError describes a 403. Error follows the error codes of
+// RFC 6750, section 3.1, and is the code of the problem sent to the caller.
+type AuthorizationError struct {
+	Error          string   `json:"error"`
+	Description    string   `json:"error_description"`
+	RequiredScopes []string `json:"required_scopes,omitempty"`
+}
+
+// Authorizer authenticates callers by bearer token or API key, stores the
+// caller in the request context and checks that the caller used a scheme and
+// holds the scopes the policy requires.
+type Authorizer struct {
+	verifier *auth.TokenVerifier
+	apiKeys  *auth.APIKeys
+	policy   *Policy
+	metrics  *metrics.Metrics
+}
+
+func NewAuthorizer(verifier *auth.TokenVerifier, apiKeys *auth.APIKeys, policy *Policy, m *metrics.Metrics) *Authorizer {
+	return &Authorizer{verifier: verifier, apiKeys: apiKeys, policy: policy, metrics: m}
+}
+
+// authenticate picks the scheme from the credentials sent. An API key may come
+// in the X-API-Key header or as "Authorization: ApiKey <key>"; anything else in
+// the Authorization header is treated as a bearer token. Without either, a
+// verified client certificate listed in the policy authenticates the caller.
+// The certificate's identity is recorded whatever the scheme.
+func (a *Authorizer) authenticate(ctx context.Context, authHeader, apiKey, clientIdentity string) (*auth.Principal, error) {
+	if apiKey == "" {
+		if key, found := strings.CutPrefix(authHeader, APIKeyAuth); found {
+			apiKey = key
 		}
+	}
 
-		authHeader := r.Header.Get(AuthorizationHeader)
-		if authHeader == "" {
-			http.Error(w, ErrAuthHeaderMissing, http.StatusUnauthorized)
-			return
+	var principal *auth.Principal
+	var err error
+	switch {
+	case apiKey != "":
+		principal, err = a.apiKeys.Authenticate(ctx, apiKey)
+	case authHeader != "":
+		principal, err = a.verifier.Verify(ctx, strings.Replace(authHeader, BearerAuth, "", 1))
+	case clientIdentity != "":
+		var ok bool
+		if principal, ok = a.policy.ClientCertPrincipal(clientIdentity); !ok {
+			err = errors.New(ErrUnknownClientCert)
 		}
+	default:
+		err = errors.New(ErrAuthHeaderMissing)
+	}
+	if err != nil {
+		return nil, err
+	}
+	principal.ClientIdentity = clientIdentity
+	return principal, nil
+}
 
-		tokenString := strings.Replace(authHeader, BearerAuth, "", 1)
-		token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, fmt.Errorf("%s: %v", ErrUnexpectedSigningMethod, token.Header[JWTEncryptionAlgoHeader])
-			}
-			return []byte(auth.TOKEN_SECRET), nil
-		})
+func (a *Authorizer) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		principal, err := a.authenticate(r.Context(), r.Header.Get(AuthorizationHeader), r.Header.Get(APIKeyHeader), certs.PeerIdentity(r.TLS))
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusUnauthorized)
+			a.metrics.AuthFailure(authenticationFailureReason(err))
+			WriteProblem(w, r, NewProblem(authenticationErrorStatus(err), authenticationFailureReason(err), err.Error()))
 			return
 		}
+		recordSubject(r.Context(), principal.Subject)
 
-		if !token.Valid {
-			http.Error(w, ErrInvalidToken, http.StatusUnauthorized)
+		rule, ok := a.policy.Rule(r.Method, r.URL.Path)
+		if authErr := checkRule(principal, rule, ok); authErr != nil {
+			a.metrics.AuthFailure(authErr.Error)
+			sendAuthorizationError(w, r, authErr)
 			return
 		}
 
-		next.ServeHTTP(w, r)
+		next.ServeHTTP(w, r.WithContext(auth.NewContext(r.Context(), principal)))
 	})
 }
+
+func (a *Authorizer) UnaryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	// Health checks come from probes that hold no credentials.
+	if strings.HasPrefix(info.FullMethod, "/"+healthpb.Health_ServiceDesc.ServiceName+"/") {
+		return handler(ctx, req)
+	}
+
+	md, _ := metadata.FromIncomingContext(ctx)
+	var clientIdentity string
+	if p, ok := peer.FromContext(ctx); ok {
+		if tlsInfo, ok := p.AuthInfo.(credentials.TLSInfo); ok {
+			clientIdentity = certs.PeerIdentity(&tlsInfo.State)
+		}
+	}
+	principal, err := a.authenticate(ctx, firstMetadataValue(md, AuthorizationHeader), firstMetadataValue(md, APIKeyHeader), clientIdentity)
+	if err != nil {
+		a.metrics.AuthFailure(authenticationFailureReason(err))
+		if authenticationErrorStatus(err) == http.StatusServiceUnavailable {
+			return nil, status.Error(codes.Unavailable, err.Error())
+		}
+		return nil, status.Error(codes.Unauthenticated, err.Error())
+	}
+	recordSubject(ctx, principal.Subject)
+
+	rule, ok := a.policy.RuleForGRPC(info.FullMethod)
+	if authErr := checkRule(principal, rule, ok); authErr != nil {
+		a.metrics.AuthFailure(authErr.Error)
+		return nil, grpcAuthorizationError(authErr)
+	}
+
+	return handler(auth.NewContext(ctx, principal), req)
+}
+
+func firstMetadataValue(md metadata.MD, key string) string {
+	if values := md.Get(key); len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+// authenticationErrorStatus tells credentials that failed to verify from
+// verification that could not run.
+func authenticationErrorStatus(err error) int {
+	if errors.Is(err, auth.ErrRevocationCheckFailed) || errors.Is(err, auth.ErrAPIKeyLookupFailed) || errors.Is(err, auth.ErrOIDCUnavailable) {
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusUnauthorized
+}
+
+// authenticationFailureReason labels a failed authentication for metrics and
+// is the code of the problem sent to the caller.
+func authenticationFailureReason(err error) string {
+	switch {
+	case authenticationErrorStatus(err) == http.StatusServiceUnavailable:
+		return CodeAuthUnavailable
+	case err.Error() == ErrAuthHeaderMissing:
+		return CodeMissingCredentials
+	case err.Error() == ErrUnknownClientCert:
+		return CodeUnknownClientCert
+	case errors.Is(err, auth.ErrInvalidAPIKey), errors.Is(err, auth.ErrAPIKeyNotFound):
+		return CodeInvalidAPIKey
+	case errors.Is(err, auth.ErrTokenExpired):
+		return CodeTokenExpired
+	case errors.Is(err, auth.ErrTokenRevoked):
+		return CodeTokenRevoked
+	}
+	return CodeInvalidToken
+}
+
+// checkRule returns nil when the caller may proceed. allowed is false for
+// requests that no policy rule matches under a default-deny policy.
+func checkRule(principal *auth.Principal, rule PolicyRule, allowed bool) *AuthorizationError {
+	if !allowed {
+		return &AuthorizationError{Error: ErrAccessDenied, Description: "no policy allows this request"}
+	}
+	if !rule.AllowsScheme(principal.AuthScheme) {
+		return &AuthorizationError{
+			Error:       ErrAccessDenied,
+			Description: fmt.Sprintf("%s authentication is not allowed for this request", principal.AuthScheme),
+		}
+	}
+	if missing := principal.MissingScopes(rule.Scopes); len(missing) > 0 {
+		return &AuthorizationError{
+			Error:          ErrInsufficientScope,
+			Description:    fmt.Sprintf("missing scopes: %s", strings.Join(missing, " ")),
+			RequiredScopes: rule.Scopes,
+		}
+	}
+	return nil
+}
+
+func sendAuthorizationError(w http.ResponseWriter, r *http.Request, authErr *AuthorizationError) {
+	challenge := fmt.Sprintf("Bearer error=%q", authErr.Error)
+	if len(authErr.RequiredScopes) > 0 {
+		challenge += fmt.Sprintf(", scope=%q", strings.Join(authErr.RequiredScopes, " "))
+	}
+	w.Header().Set(WWWAuthenticateHeader, challenge)
+	p := NewProblem(http.StatusForbidden, authErr.Error, authErr.Description)
+	p.RequiredScopes = authErr.RequiredScopes
+	WriteProblem(w, r, p)
+}
+
+// grpcAuthorizationError carries the same information as the HTTP body in an
+// ErrorInfo detail, whose reason is the code of the HTTP problem.
+func grpcAuthorizationError(authErr *AuthorizationError) error {
+	st := status.New(codes.PermissionDenied, authErr.Description)
+	info := &errdetails.ErrorInfo{
+		Reason: authErr.Error,
+		Domain: ErrorDomain,
+	}
+	if len(authErr.RequiredScopes) > 0 {
+		info.Metadata = map[string]string{"required_scopes": strings.Join(authErr.RequiredScopes, " ")}
+	}
+	if detailed, err := st.WithDetails(info); err == nil {
+		st = detailed
+	}
+	return st.Err()
+}
@@ -0,0 +1,56 @@
+package middlewares
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/status"
+)
+
+func TestAuthorizationErrorCodesMatchOverHTTPAndGRPC(t *testing.T) {
+	tests := []*AuthorizationError{
+		{Error: ErrAccessDenied, Description: "no policy allows this request"},
+		{Error: ErrInsufficientScope, Description: "missing scopes: orders:write", RequiredScopes: []string{"orders:write"}},
+	}
+	for _, authErr := range tests {
+		t.Run(authErr.Error, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			sendAuthorizationError(w, httptest.NewRequest(http.MethodPost, "/v1/orders", nil), authErr)
+			var httpProblem Problem
+			if err := json.Unmarshal(w.Body.Bytes(), &httpProblem); err != nil {
+				t.Fatal(err)
+			}
+
+			st := status.Convert(grpcAuthorizationError(authErr))
+			var info *errdetails.ErrorInfo
+			for _, d := range st.Details() {
+				if d, ok := d.(*errdetails.ErrorInfo); ok {
+					info = d
+				}
+			}
+			if info == nil {
+				t.Fatal("no ErrorInfo detail")
+			}
+			if info.GetReason() != httpProblem.Code || info.GetDomain() != ErrorDomain {
+				t.Errorf("ErrorInfo = %s in %s, want %s in %s", info.GetReason(), info.GetDomain(), httpProblem.Code, ErrorDomain)
+			}
+			if grpcProblem := ProblemFromStatus(st); grpcProblem.Code != httpProblem.Code || grpcProblem.Status != httpProblem.Status {
+				t.Errorf("problem from gRPC = %s %d, want %s %d", grpcProblem.Code, grpcProblem.Status, httpProblem.Code, httpProblem.Status)
+			}
+		})
+	}
+}
+
+func TestAuthorizerMiddlewareDoesNotExemptLogin(t *testing.T) {
+	called := false
+	handler := newTestAuthorizer(t).Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { called = true }))
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/login", nil))
+	if w.Code != http.StatusUnauthorized || called {
+		t.Errorf("status = %d, handler called = %v; want %d and /login served outside the authorizer", w.Code, called, http.StatusUnauthorized)
+	}
+}
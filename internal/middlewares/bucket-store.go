@@ -0,0 +1,77 @@
+package middlewares
+
+import (
+	"container/list"
+	"sync"
+	"time"
+
+	"github.com/juju/ratelimit"
+)
+
+// bucketStore keeps one token bucket per key. Least recently used buckets are
+// evicted once maxEntries is reached, and buckets that have been idle long
+// enough to refill completely are dropped since a fresh bucket behaves
+// identically.
+type bucketStore struct {
+	mu         sync.Mutex
+	maxEntries int
+	entries    map[string]*list.Element
+	lru        *list.List
+	now        func() time.Time
+}
+
+type bucketEntry struct {
+	key      string
+	limit    RateLimit
+	bucket   *ratelimit.Bucket
+	lastUsed time.Time
+}
+
+func newBucketStore(maxEntries int) *bucketStore {
+	return &bucketStore{
+		maxEntries: maxEntries,
+		entries:    make(map[string]*list.Element),
+		lru:        list.New(),
+		now:        time.Now,
+	}
+}
+
+func (s *bucketStore) get(key string, limit RateLimit) *ratelimit.Bucket {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	s.evictIdle(now)
+
+	if elem, ok := s.entries[key]; ok {
+		entry := elem.Value.(*bucketEntry)
+		if entry.limit == limit {
+			entry.lastUsed = now
+			s.lru.MoveToFront(elem)
+			return entry.bucket
+		}
+		s.remove(elem)
+	}
+
+	if s.maxEntries > 0 && s.lru.Len() >= s.maxEntries {
+		s.remove(s.lru.Back())
+	}
+	entry := &bucketEntry{key: key, limit: limit, bucket: limit.newBucket(), lastUsed: now}
+	s.entries[key] = s.lru.PushFront(entry)
+	return entry.bucket
+}
+
+func (s *bucketStore) evictIdle(now time.Time) {
+	for elem := s.lru.Back(); elem != nil; elem = s.lru.Back() {
+		entry := elem.Value.(*bucketEntry)
+		if now.Sub(entry.lastUsed) < entry.limit.Period {
+			return
+		}
+		s.remove(elem)
+	}
+}
+
+func (s *bucketStore) remove(elem *list.Element) {
+	s.lru.Remove(elem)
+	delete(s.entries, elem.Value.(*bucketEntry).key)
+}
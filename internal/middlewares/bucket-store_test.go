@@ -0,0 +1,71 @@
+package middlewares
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBucketStoreEvictsLeastRecentlyUsed(t *testing.T) {
+	store := newBucketStore(2)
+	limit := RateLimit{Limit: 5, Period: time.Minute}
+
+	a := store.get("a", limit)
+	store.get("b", limit)
+	// Using a again makes b the least recently used bucket.
+	if store.get("a", limit) != a {
+		t.Fatal("a got a new bucket while it was still stored")
+	}
+	store.get("c", limit)
+
+	if _, ok := store.entries["b"]; ok {
+		t.Error("b was not evicted")
+	}
+	for _, key := range []string{"a", "c"} {
+		if _, ok := store.entries[key]; !ok {
+			t.Errorf("%s was evicted", key)
+		}
+	}
+	if store.lru.Len() != 2 {
+		t.Errorf("store holds %d buckets, want 2", store.lru.Len())
+	}
+}
+
+func TestBucketStoreEvictsIdleBuckets(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	store := newBucketStore(10)
+	store.now = func() time.Time { return now }
+	limit := RateLimit{Limit: 5, Period: time.Minute}
+
+	a := store.get("a", limit)
+	a.TakeAvailable(5)
+	now = now.Add(30 * time.Second)
+	store.get("b", limit)
+
+	// a has been idle for a full period, long enough to refill completely.
+	now = now.Add(30 * time.Second)
+	store.get("c", limit)
+
+	if _, ok := store.entries["a"]; ok {
+		t.Error("idle bucket a was not evicted")
+	}
+	if _, ok := store.entries["b"]; !ok {
+		t.Error("bucket b was evicted before a full period of idleness")
+	}
+}
+
+func TestBucketStoreReplacesBucketWhenLimitChanges(t *testing.T) {
+	store := newBucketStore(10)
+
+	first := store.get("a", RateLimit{Limit: 5, Period: time.Minute})
+	second := store.get("a", RateLimit{Limit: 10, Period: time.Minute})
+
+	if first == second {
+		t.Fatal("bucket was kept although the limit changed")
+	}
+	if got := second.Capacity(); got != 10 {
+		t.Errorf("capacity = %d, want 10", got)
+	}
+	if store.lru.Len() != 1 {
+		t.Errorf("store holds %d buckets, want 1", store.lru.Len())
+	}
+}
@@ -0,0 +1,21 @@
+package middlewares
+
+import "net/http"
+
+const ErrServiceDraining = "service is shutting down"
+
+// RejectWhileDraining answers every request with 503 once draining reports
+// true, so requests arriving on kept-alive connections during shutdown are not
+// forwarded to backends that are about to be closed.
+func RejectWhileDraining(draining func() bool) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if draining() {
+				w.Header().Set("Connection", "close")
+				WriteProblem(w, r, NewProblem(http.StatusServiceUnavailable, CodeServiceDraining, ErrServiceDraining))
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,67 @@
+package middlewares
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Limiter decides whether one more request may be made against key under
+// limit. Implementations may be process local or shared between replicas.
+type Limiter interface {
+	Allow(ctx context.Context, key string, limit RateLimit) (RateLimitResult, error)
+}
+
+type RateLimitResult struct {
+	Allowed   bool
+	Limit     int64
+	Remaining int64
+	// ResetAfter is the time until the full limit is available again.
+	ResetAfter time.Duration
+	// RetryAfter is the time until the next request would be allowed. It is
+	// only set when Allowed is false.
+	RetryAfter time.Duration
+}
+
+// FailurePolicy controls what happens to a request when the Limiter cannot
+// reach its store.
+type FailurePolicy string
+
+const (
+	FailOpen   FailurePolicy = "open"
+	FailClosed FailurePolicy = "closed"
+)
+
+func ParseFailurePolicy(s string) (FailurePolicy, error) {
+	switch policy := FailurePolicy(s); policy {
+	case FailOpen, FailClosed:
+		return policy, nil
+	}
+	return "", fmt.Errorf("invalid rate limit failure policy %q, expected %q or %q", s, FailOpen, FailClosed)
+}
+
+// MemoryLimiter keeps token buckets in process. Each gateway replica enforces
+// its own budget.
+type MemoryLimiter struct {
+	buckets *bucketStore
+}
+
+func NewMemoryLimiter(maxEntries int) *MemoryLimiter {
+	return &MemoryLimiter{buckets: newBucketStore(maxEntries)}
+}
+
+func (m *MemoryLimiter) Allow(ctx context.Context, key string, limit RateLimit) (RateLimitResult, error) {
+	bucket := m.buckets.get(key, limit)
+	result := RateLimitResult{
+		Allowed: bucket.TakeAvailable(1) == 1,
+		Limit:   bucket.Capacity(),
+	}
+	result.Remaining = max(bucket.Available(), 0)
+
+	perToken := time.Duration(float64(time.Second) / bucket.Rate())
+	result.ResetAfter = time.Duration(result.Limit-result.Remaining) * perToken
+	if !result.Allowed {
+		result.RetryAfter = perToken
+	}
+	return result, nil
+}
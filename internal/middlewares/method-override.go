@@ -0,0 +1,22 @@
+package middlewares
+
+import "net/http"
+
+const (
+	MethodOverrideHeader = "X-HTTP-Method-Override"
+	ErrMethodOverride    = "X-HTTP-Method-Override is not supported"
+)
+
+// RejectMethodOverride answers requests carrying X-HTTP-Method-Override with
+// 400. The authorizer and the rate limiter match the request method, so a
+// router honouring the header could run a handler the policy was never asked
+// about.
+func RejectMethodOverride(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := r.Header[http.CanonicalHeaderKey(MethodOverrideHeader)]; ok {
+			WriteProblem(w, r, NewProblem(http.StatusBadRequest, CodeInvalidRequest, ErrMethodOverride))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
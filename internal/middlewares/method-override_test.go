@@ -0,0 +1,82 @@
+package middlewares
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+)
+
+// newTestGatewayMux returns a mux configured as the gateway's, with a GET and
+// a DELETE route on /v1/orders/{id}.
+func newTestGatewayMux(t *testing.T, called *string) http.Handler {
+	t.Helper()
+	mux := runtime.NewServeMux(
+		runtime.WithRoutingErrorHandler(ProblemRoutingErrorHandler),
+		runtime.WithDisablePathLengthFallback(),
+	)
+	for _, method := range []string{http.MethodGet, http.MethodDelete} {
+		method := method
+		err := mux.HandlePath(method, "/v1/orders/{id}", func(w http.ResponseWriter, r *http.Request, _ map[string]string) {
+			*called = method
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return RejectMethodOverride(mux)
+}
+
+func TestRejectMethodOverride(t *testing.T) {
+	tests := []struct {
+		name       string
+		method     string
+		header     http.Header
+		wantStatus int
+		wantCalled string
+	}{
+		{name: "plain request", method: http.MethodGet, wantStatus: http.StatusOK, wantCalled: http.MethodGet},
+		{
+			name:       "override to DELETE",
+			method:     http.MethodPost,
+			header:     http.Header{"Content-Type": {"application/x-www-form-urlencoded"}, MethodOverrideHeader: {"DELETE"}},
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "empty override",
+			method:     http.MethodPost,
+			header:     http.Header{"Content-Type": {"application/x-www-form-urlencoded"}, MethodOverrideHeader: {""}},
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "form POST is not routed to GET",
+			method:     http.MethodPost,
+			header:     http.Header{"Content-Type": {"application/x-www-form-urlencoded"}},
+			wantStatus: http.StatusMethodNotAllowed,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var called string
+			handler := newTestGatewayMux(t, &called)
+
+			r := httptest.NewRequest(tt.method, "/v1/orders/7", strings.NewReader("a=b"))
+			for name, values := range tt.header {
+				for _, value := range values {
+					r.Header.Add(name, value)
+				}
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			if called != tt.wantCalled {
+				t.Errorf("handler called = %q, want %q", called, tt.wantCalled)
+			}
+		})
+	}
+}
@@ -0,0 +1,156 @@
+package middlewares
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+
+	"github.com/ilivestrong/oms-gateway/internal/auth"
+)
+
+const (
+	PolicyDefaultDeny  = "deny"
+	PolicyDefaultAllow = "allow"
+)
+
+// PolicyRule lists the scopes a caller needs for the requests it matches. A
+// rule matches either an HTTP route or a gRPC full method name. A rule with no
+// scopes only requires a valid token, and a rule with no schemes accepts every
+// authentication scheme.
+type PolicyRule struct {
+	Route      Route
+	GRPCMethod string
+	Scopes     []string
+	Schemes    []string
+}
+
+func (r PolicyRule) AllowsScheme(scheme string) bool {
+	return len(r.Schemes) == 0 || slices.Contains(r.Schemes, scheme)
+}
+
+// Policy decides which scopes each request requires. Rules are tried in order
+// and the first match wins. gRPC calls without a rule of their own fall back
+// to the rules of the HTTP route they are bound to.
+type Policy struct {
+	// Roles maps the roles of users to the scopes written into their tokens.
+	Roles auth.RoleScopes
+	// ClientCerts maps the identity of a client certificate to the roles of
+	// callers that authenticate with the certificate alone.
+	ClientCerts map[string][]string
+	Rules       []PolicyRule
+	// DefaultDeny rejects requests that match no rule. Otherwise they only
+	// require a valid token.
+	DefaultDeny bool
+}
+
+// LoadPolicy reads a policy from a JSON file of the form
+//
+//	{
+//	  "default": "deny",
+//	  "roles": {"customer": ["products:read", "orders:read"]},
+//	  "client_certs": {"partner.example.com": ["customer"]},
+//	  "rules": [
+//	    {"route": "GET /v1/products", "scopes": ["products:read"]},
+//	    {"route": "POST /logout", "schemes": ["bearer"]},
+//	    {"grpc_method": "/oms.GatewayService/ListOrders", "scopes": ["orders:read"]}
+//	  ]
+//	}
+func LoadPolicy(path string) (*Policy, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read policy file: %w", err)
+	}
+	var file struct {
+		Default     string              `json:"default"`
+		Roles       auth.RoleScopes     `json:"roles"`
+		ClientCerts map[string][]string `json:"client_certs"`
+		Rules       []struct {
+			Route      string   `json:"route"`
+			GRPCMethod string   `json:"grpc_method"`
+			Scopes     []string `json:"scopes"`
+			Schemes    []string `json:"schemes"`
+		} `json:"rules"`
+	}
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse policy file: %w", err)
+	}
+
+	policy := &Policy{Roles: file.Roles, ClientCerts: file.ClientCerts}
+	switch file.Default {
+	case "", PolicyDefaultDeny:
+		policy.DefaultDeny = true
+	case PolicyDefaultAllow:
+	default:
+		return nil, fmt.Errorf("policy file %s: unknown default %q", path, file.Default)
+	}
+	for i, rule := range file.Rules {
+		if (rule.Route == "") == (rule.GRPCMethod == "") {
+			return nil, fmt.Errorf("policy file %s: rule %d must have either a route or a grpc_method", path, i)
+		}
+		for _, scheme := range rule.Schemes {
+			if scheme != auth.SchemeBearer && scheme != auth.SchemeAPIKey && scheme != auth.SchemeClientCert {
+				return nil, fmt.Errorf("policy file %s: rule %d has unknown scheme %q", path, i, scheme)
+			}
+		}
+		policyRule := PolicyRule{GRPCMethod: rule.GRPCMethod, Scopes: rule.Scopes, Schemes: rule.Schemes}
+		if rule.Route != "" {
+			policyRule.Route = ParseRoute(rule.Route)
+		}
+		policy.Rules = append(policy.Rules, policyRule)
+	}
+	return policy, nil
+}
+
+// ClientCertPrincipal returns the caller for a verified client certificate
+// listed in ClientCerts.
+func (p *Policy) ClientCertPrincipal(identity string) (*auth.Principal, bool) {
+	roles, ok := p.ClientCerts[identity]
+	if !ok {
+		return nil, false
+	}
+	return &auth.Principal{
+		Subject:        auth.ClientCertSubjectPrefix + identity,
+		Roles:          roles,
+		Scopes:         p.Roles.Expand(roles, nil),
+		AuthScheme:     auth.SchemeClientCert,
+		ClientIdentity: identity,
+	}, true
+}
+
+// Scopes returns every scope granted by a role or required by a rule, sorted.
+func (p *Policy) Scopes() []string {
+	var scopes []string
+	for _, roleScopes := range p.Roles {
+		scopes = append(scopes, roleScopes...)
+	}
+	for _, rule := range p.Rules {
+		scopes = append(scopes, rule.Scopes...)
+	}
+	slices.Sort(scopes)
+	return slices.Compact(scopes)
+}
+
+// Rule returns the rule for an HTTP request. ok is false when the request is
+// denied outright because it matches no rule.
+func (p *Policy) Rule(method, path string) (rule PolicyRule, ok bool) {
+	for _, rule := range p.Rules {
+		if rule.GRPCMethod == "" && rule.Route.Matches(method, path) {
+			return rule, true
+		}
+	}
+	return PolicyRule{}, !p.DefaultDeny
+}
+
+// RuleForGRPC returns the rule for a gRPC call.
+func (p *Policy) RuleForGRPC(fullMethod string) (rule PolicyRule, ok bool) {
+	for _, rule := range p.Rules {
+		if rule.GRPCMethod == fullMethod {
+			return rule, true
+		}
+	}
+	if route, found := RouteForGRPCMethod(fullMethod); found {
+		return p.Rule(route.Method, route.Pattern)
+	}
+	return PolicyRule{}, !p.DefaultDeny
+}
@@ -0,0 +1,180 @@
+package middlewares
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	ProblemContentType = "application/problem+json"
+	problemTypePrefix  = "urn:oms-gateway:problem:"
+	// ErrorDomain marks errdetails.ErrorInfo raised by the gateway. Their
+	// reason is used as the problem code.
+	ErrorDomain = "oms-gateway"
+
+	// Codes of errors raised by the gateway itself. Errors returned by the
+	// backends use the snake_case name of their gRPC code, e.g. "not_found".
+	CodeInvalidRequest         = "invalid_request"
+	CodeInvalidCredentials     = "invalid_credentials"
+	CodeMissingCredentials     = "missing_credentials"
+	CodeInvalidToken           = "invalid_token"
+	CodeTokenExpired           = "token_expired"
+	CodeTokenRevoked           = "token_revoked"
+	CodeInvalidAPIKey          = "invalid_api_key"
+	CodeUnknownClientCert      = "unknown_client_cert"
+	CodeAuthUnavailable        = "auth_unavailable"
+	CodeRateLimited            = "rate_limited"
+	CodeRateLimiterUnavailable = "rate_limiter_unavailable"
+	CodeServiceDraining        = "service_draining"
+	CodeCircuitOpen            = "circuit_open"
+	CodeNotFound               = "not_found"
+	CodeMethodNotAllowed       = "method_not_allowed"
+	CodeInternal               = "internal"
+)
+
+// Problem is an RFC 9457 problem details body. Code is a stable identifier
+// clients can switch on; Type is the same code as a URN.
+type Problem struct {
+	Type           string           `json:"type"`
+	Title          string           `json:"title"`
+	Status         int              `json:"status"`
+	Detail         string           `json:"detail,omitempty"`
+	Instance       string           `json:"instance,omitempty"`
+	Code           string           `json:"code"`
+	RequestID      string           `json:"request_id,omitempty"`
+	Errors         []FieldViolation `json:"errors,omitempty"`
+	RequiredScopes []string         `json:"required_scopes,omitempty"`
+	// RetryAfter is sent as the Retry-After header when set.
+	RetryAfter time.Duration `json:"-"`
+}
+
+// FieldViolation names a request field that failed validation.
+type FieldViolation struct {
+	Field       string `json:"field"`
+	Description string `json:"description"`
+}
+
+func NewProblem(httpStatus int, code, detail string) *Problem {
+	return &Problem{
+		Type:   problemTypePrefix + code,
+		Title:  http.StatusText(httpStatus),
+		Status: httpStatus,
+		Detail: detail,
+		Code:   code,
+	}
+}
+
+// WriteProblem sends p, filling in the request path and ID.
+func WriteProblem(w http.ResponseWriter, r *http.Request, p *Problem) {
+	p.Instance = r.URL.Path
+	p.RequestID = RequestIDFromContext(r.Context())
+
+	body, err := json.Marshal(p)
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", ProblemContentType)
+	if p.RetryAfter > 0 {
+		w.Header().Set(RetryAfterHeader, strconv.Itoa(max(ceilSeconds(p.RetryAfter), 1)))
+	}
+	w.WriteHeader(p.Status)
+	w.Write(body)
+}
+
+// ProblemFromStatus maps a gRPC status to a problem. Messages of server
+// errors are not passed on since they may describe the backends' internals,
+// such as their addresses. BadRequest details become field violations,
+// RetryInfo the Retry-After header, and the reason of an ErrorInfo raised by
+// the gateway the code.
+func ProblemFromStatus(st *status.Status) *Problem {
+	httpStatus := HTTPStatusFromCode(st.Code())
+	detail := st.Message()
+	if httpStatus >= http.StatusInternalServerError {
+		detail = ""
+	}
+	p := NewProblem(httpStatus, grpcCodeName(st.Code()), detail)
+	for _, d := range st.Details() {
+		switch d := d.(type) {
+		case *errdetails.BadRequest:
+			for _, v := range d.GetFieldViolations() {
+				p.Errors = append(p.Errors, FieldViolation{Field: v.GetField(), Description: v.GetDescription()})
+			}
+		case *errdetails.RetryInfo:
+			p.RetryAfter = d.GetRetryDelay().AsDuration()
+		case *errdetails.ErrorInfo:
+			// The gateway's own messages are safe to pass on.
+			if d.GetDomain() == ErrorDomain {
+				p.Code, p.Type, p.Detail = d.GetReason(), problemTypePrefix+d.GetReason(), st.Message()
+			}
+		}
+	}
+	return p
+}
+
+// HTTPStatusFromCode follows runtime.HTTPStatusFromCode. The statuses for
+// the codes most returned by the backends are spelled out as they are part
+// of the documented API.
+func HTTPStatusFromCode(code codes.Code) int {
+	switch code {
+	case codes.InvalidArgument, codes.FailedPrecondition:
+		return http.StatusBadRequest
+	case codes.NotFound:
+		return http.StatusNotFound
+	case codes.Unavailable:
+		return http.StatusServiceUnavailable
+	}
+	return runtime.HTTPStatusFromCode(code)
+}
+
+// grpcCodeName turns codes.FailedPrecondition into "failed_precondition".
+func grpcCodeName(code codes.Code) string {
+	var b strings.Builder
+	for i, c := range code.String() {
+		if unicode.IsUpper(c) {
+			if i > 0 {
+				b.WriteByte('_')
+			}
+			c = unicode.ToLower(c)
+		}
+		b.WriteRune(c)
+	}
+	return b.String()
+}
+
+// ProblemErrorHandler is a runtime.ErrorHandlerFunc writing errors of the
+// gateway mux as problems.
+func ProblemErrorHandler(ctx context.Context, _ *runtime.ServeMux, _ runtime.Marshaler, w http.ResponseWriter, r *http.Request, err error) {
+	var statusErr *runtime.HTTPStatusError
+	if errors.As(err, &statusErr) {
+		p := ProblemFromStatus(status.Convert(statusErr.Err))
+		p.Status, p.Title = statusErr.HTTPStatus, http.StatusText(statusErr.HTTPStatus)
+		WriteProblem(w, r, p)
+		return
+	}
+	WriteProblem(w, r, ProblemFromStatus(status.Convert(err)))
+}
+
+// ProblemRoutingErrorHandler is a runtime.RoutingErrorHandlerFunc for
+// requests that match no route of the gateway mux.
+func ProblemRoutingErrorHandler(_ context.Context, _ *runtime.ServeMux, _ runtime.Marshaler, w http.ResponseWriter, r *http.Request, httpStatus int) {
+	code := CodeInvalidRequest
+	switch httpStatus {
+	case http.StatusNotFound:
+		code = CodeNotFound
+	case http.StatusMethodNotAllowed:
+		code = CodeMethodNotAllowed
+	}
+	WriteProblem(w, r, NewProblem(httpStatus, code, ""))
+}
@@ -1,25 +1,272 @@
 package middlewares
 
 import (
+	"context"
 	"fmt"
+	"log/slog"
+	"math"
+	"net"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/ilivestrong/oms-gateway/internal/auth"
+	"github.com/ilivestrong/oms-gateway/internal/metrics"
 	"github.com/juju/ratelimit"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
 )
 
-func RateLimitMiddleware(limit int, duration time.Duration) func(http.Handler) http.Handler {
-	limiter := ratelimit.NewBucketWithRate(float64(limit), int64(limit))
+const (
+	ErrTooManyRequests      = "Too Many Requests"
+	ErrRateLimitUnavailable = "rate limiter unavailable"
 
-	return func(next http.Handler) http.Handler {
-		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			fmt.Println("rate limiter called")
-			if limiter.TakeAvailable(1) == 0 {
-				http.Error(w, "Too Many Requests", http.StatusTooManyRequests)
-				return
-			}
+	RateLimitLimitHeader     = "RateLimit-Limit"
+	RateLimitRemainingHeader = "RateLimit-Remaining"
+	RateLimitResetHeader     = "RateLimit-Reset"
+	RetryAfterHeader         = "Retry-After"
 
-			next.ServeHTTP(w, r)
-		})
+	DefaultRateLimitMaxClients = 10000
+)
+
+// RateLimit allows Limit requests per Period, refilled continuously.
+type RateLimit struct {
+	Limit  int
+	Period time.Duration
+}
+
+func (l RateLimit) String() string {
+	return fmt.Sprintf("%d/%s", l.Limit, l.Period)
+}
+
+func (l RateLimit) newBucket() *ratelimit.Bucket {
+	return ratelimit.NewBucketWithRate(float64(l.Limit)/l.Period.Seconds(), int64(l.Limit))
+}
+
+// ParseRateLimit parses "<limit>/<period>", e.g. "10/1s" or "100/1m".
+func ParseRateLimit(s string) (RateLimit, error) {
+	limitStr, periodStr, found := strings.Cut(strings.TrimSpace(s), "/")
+	if !found {
+		return RateLimit{}, fmt.Errorf("invalid rate limit %q, expected <limit>/<period>", s)
+	}
+	limit, err := strconv.Atoi(limitStr)
+	if err != nil || limit <= 0 {
+		return RateLimit{}, fmt.Errorf("invalid rate limit %q: limit must be a positive integer", s)
+	}
+	period, err := time.ParseDuration(periodStr)
+	if err != nil || period <= 0 {
+		return RateLimit{}, fmt.Errorf("invalid rate limit %q: period must be a positive duration", s)
+	}
+	return RateLimit{Limit: limit, Period: period}, nil
+}
+
+// RateLimitRule applies its own limit to requests matching Route. Each client
+// gets a separate budget per rule.
+type RateLimitRule struct {
+	Route Route
+	RateLimit
+}
+
+// ParseRateLimitRules parses a comma separated list of rules such as
+// "POST /v1/orders=5/1m,GET /v1/products=100/1s".
+func ParseRateLimitRules(s string) ([]RateLimitRule, error) {
+	var rules []RateLimitRule
+	for _, ruleStr := range strings.Split(s, ",") {
+		if strings.TrimSpace(ruleStr) == "" {
+			continue
+		}
+		routeStr, limitStr, found := strings.Cut(ruleStr, "=")
+		if !found {
+			return nil, fmt.Errorf("invalid rate limit rule %q, expected <route>=<limit>/<period>", ruleStr)
+		}
+		limit, err := ParseRateLimit(limitStr)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, RateLimitRule{Route: ParseRoute(routeStr), RateLimit: limit})
+	}
+	return rules, nil
+}
+
+type RateLimiterConfig struct {
+	// Default applies to requests that match none of Rules.
+	Default RateLimit
+	Rules   []RateLimitRule
+	// MaxClients bounds the number of buckets kept in memory when no Limiter
+	// is configured.
+	MaxClients int
+	// Limiter stores the buckets. It defaults to a MemoryLimiter.
+	Limiter Limiter
+	// FailurePolicy decides whether requests pass when the Limiter errors.
+	// It defaults to FailOpen.
+	FailurePolicy FailurePolicy
+	// ByIP keys every request by the remote IP, even when the caller is
+	// authenticated, so the limiter can run before authentication.
+	ByIP bool
+	// Metrics records rejections and limiter errors when set.
+	Metrics *metrics.Metrics
+	// Logger defaults to slog.Default().
+	Logger *slog.Logger
+}
+
+// RateLimiter enforces a budget per client and route rule. Clients are
+// identified by the authenticated subject, falling back to the remote IP, or
+// always by the remote IP with ByIP. The HTTP middleware and the gRPC
+// interceptor share the same buckets, with gRPC methods resolved to their HTTP
+// routes.
+//
+// A ByIP limiter only sends the RateLimit headers with a rejection, leaving
+// them to the per-subject limiter behind it for requests it lets through.
+type RateLimiter struct {
+	defaultLimit  RateLimit
+	rules         []RateLimitRule
+	limiter       Limiter
+	byIP          bool
+	failurePolicy FailurePolicy
+	metrics       *metrics.Metrics
+	logger        *slog.Logger
+}
+
+func NewRateLimiter(cfg RateLimiterConfig) *RateLimiter {
+	if cfg.MaxClients <= 0 {
+		cfg.MaxClients = DefaultRateLimitMaxClients
+	}
+	if cfg.Limiter == nil {
+		cfg.Limiter = NewMemoryLimiter(cfg.MaxClients)
+	}
+	if cfg.FailurePolicy == "" {
+		cfg.FailurePolicy = FailOpen
+	}
+	if cfg.Logger == nil {
+		cfg.Logger = slog.Default()
+	}
+	return &RateLimiter{
+		defaultLimit:  cfg.Default,
+		rules:         cfg.Rules,
+		limiter:       cfg.Limiter,
+		byIP:          cfg.ByIP,
+		failurePolicy: cfg.FailurePolicy,
+		metrics:       cfg.Metrics,
+		logger:        cfg.Logger,
+	}
+}
+
+func (rl *RateLimiter) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		result, err := rl.allow(r.Context(), r.Method, r.URL.Path, rl.clientKey(r.Context(), r.RemoteAddr))
+		if err != nil {
+			WriteProblem(w, r, NewProblem(http.StatusServiceUnavailable, CodeRateLimiterUnavailable, ErrRateLimitUnavailable))
+			return
+		}
+		for name, value := range rl.headers(result) {
+			w.Header().Set(name, value)
+		}
+		if !result.Allowed {
+			WriteProblem(w, r, NewProblem(http.StatusTooManyRequests, CodeRateLimited, ErrTooManyRequests))
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (rl *RateLimiter) UnaryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	var remoteAddr string
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		remoteAddr = p.Addr.String()
+	}
+
+	route, ok := RouteForGRPCMethod(info.FullMethod)
+	if !ok {
+		route = Route{Method: "*", Pattern: info.FullMethod}
+	}
+
+	result, err := rl.allow(ctx, route.Method, route.Pattern, rl.clientKey(ctx, remoteAddr))
+	if err != nil {
+		return nil, status.Error(codes.Unavailable, ErrRateLimitUnavailable)
+	}
+	if headers := rl.headers(result); len(headers) > 0 {
+		header := metadata.MD{}
+		for name, value := range headers {
+			header.Set(name, value)
+		}
+		grpc.SetHeader(ctx, header)
+	}
+
+	if !result.Allowed {
+		return nil, status.Error(codes.ResourceExhausted, ErrTooManyRequests)
+	}
+	return handler(ctx, req)
+}
+
+// allow only returns an error when the limiter failed and the failure policy
+// is FailClosed. With FailOpen the request is let through without headers.
+func (rl *RateLimiter) allow(ctx context.Context, method, path, client string) (RateLimitResult, error) {
+	ruleKey, limit := "default", rl.defaultLimit
+	for _, rule := range rl.rules {
+		if rule.Route.Matches(method, path) {
+			ruleKey, limit = rule.Route.String(), rule.RateLimit
+			break
+		}
+	}
+	if rl.byIP {
+		// Keeps the buckets apart from the per-subject limiter's, which
+		// also keys unauthenticated callers by IP.
+		ruleKey = "ip:" + ruleKey
+	}
+
+	result, err := rl.limiter.Allow(ctx, ruleKey+"|"+client, limit)
+	if err != nil {
+		rl.logger.ErrorContext(ctx, "rate limiter store failed", "err", err, "failurePolicy", rl.failurePolicy, "request_id", RequestIDFromContext(ctx))
+		rl.metrics.RateLimitError()
+		if rl.failurePolicy == FailClosed {
+			return result, err
+		}
+		return RateLimitResult{Allowed: true}, nil
+	}
+	if !result.Allowed {
+		rl.metrics.RateLimitRejected(ruleKey)
+	}
+	return result, nil
+}
+
+func (rl *RateLimiter) headers(result RateLimitResult) map[string]string {
+	if rl.byIP && result.Allowed {
+		return nil
+	}
+	return rateLimitHeaders(result)
+}
+
+func rateLimitHeaders(result RateLimitResult) map[string]string {
+	if result.Limit == 0 {
+		return nil
+	}
+	headers := map[string]string{
+		RateLimitLimitHeader:     strconv.FormatInt(result.Limit, 10),
+		RateLimitRemainingHeader: strconv.FormatInt(result.Remaining, 10),
+		RateLimitResetHeader:     strconv.Itoa(ceilSeconds(result.ResetAfter)),
+	}
+	if !result.Allowed {
+		headers[RetryAfterHeader] = strconv.Itoa(max(ceilSeconds(result.RetryAfter), 1))
+	}
+	return headers
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
+
+func (rl *RateLimiter) clientKey(ctx context.Context, remoteAddr string) string {
+	if principal, ok := auth.PrincipalFromContext(ctx); ok && principal.Subject != "" && !rl.byIP {
+		return "sub:" + principal.Subject
+	}
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		host = remoteAddr
 	}
+	return "ip:" + host
 }
@@ -0,0 +1,136 @@
+package middlewares
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ilivestrong/oms-gateway/internal/auth"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// newTestAuthorizer returns an Authorizer whose policy lets callers holding
+// products:read list products.
+func newTestAuthorizer(t *testing.T) *Authorizer {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "policy.json")
+	policy := `{"default": "deny", "rules": [{"route": "GET /v1/products", "scopes": ["products:read"]}]}`
+	if err := os.WriteFile(path, []byte(policy), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	p, err := LoadPolicy(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys, err := auth.LoadKeySet(auth.KeyConfig{Keys: "test:" + strings.Repeat("s", auth.MinSecretLength)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	verifier := auth.NewTokenVerifier(keys, auth.TokenConfig{}, auth.NewMemoryRevocationList(), nil)
+	return NewAuthorizer(verifier, auth.NewAPIKeys(auth.NewMemoryAPIKeyStore(), p.Scopes(), nil), p, nil)
+}
+
+func TestIPRateLimiterThrottlesUnauthenticatedHTTPRequests(t *testing.T) {
+	ipLimiter := NewRateLimiter(RateLimiterConfig{Default: RateLimit{Limit: 2, Period: time.Minute}, ByIP: true})
+	subjectLimiter := NewRateLimiter(RateLimiterConfig{Default: RateLimit{Limit: 100, Period: time.Minute}})
+	authorizer := newTestAuthorizer(t)
+	handler := ipLimiter.Middleware(authorizer.Middleware(subjectLimiter.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))))
+
+	send := func(remoteAddr string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, "/v1/products", nil)
+		r.RemoteAddr = remoteAddr
+		r.Header.Set(AuthorizationHeader, BearerAuth+"not-a-token")
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w
+	}
+
+	for i := 0; i < 2; i++ {
+		if w := send("192.0.2.1:1234"); w.Code != http.StatusUnauthorized {
+			t.Fatalf("request %d: status = %d, want %d", i, w.Code, http.StatusUnauthorized)
+		}
+	}
+	w := send("192.0.2.1:5678")
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("status = %d, want %d once the IP budget is spent", w.Code, http.StatusTooManyRequests)
+	}
+	if w.Header().Get(RetryAfterHeader) == "" {
+		t.Error("429 without Retry-After")
+	}
+	if w := send("192.0.2.2:1234"); w.Code != http.StatusUnauthorized {
+		t.Errorf("another IP: status = %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+}
+
+func TestIPRateLimiterThrottlesUnauthenticatedGRPCRequests(t *testing.T) {
+	ipLimiter := NewRateLimiter(RateLimiterConfig{Default: RateLimit{Limit: 1, Period: time.Minute}, ByIP: true})
+	authorizer := newTestAuthorizer(t)
+	info := &grpc.UnaryServerInfo{FullMethod: "/oms.GatewayService/ListProducts"}
+	ctx := peer.NewContext(context.Background(), &peer.Peer{Addr: &net.TCPAddr{IP: net.IPv4(192, 0, 2, 1), Port: 1234}})
+	call := func() error {
+		_, err := ipLimiter.UnaryInterceptor(ctx, nil, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+			return authorizer.UnaryInterceptor(ctx, req, info, func(context.Context, interface{}) (interface{}, error) {
+				return nil, nil
+			})
+		})
+		return err
+	}
+
+	if err := call(); status.Code(err) != codes.Unauthenticated {
+		t.Fatalf("err = %v, want %v", err, codes.Unauthenticated)
+	}
+	if err := call(); status.Code(err) != codes.ResourceExhausted {
+		t.Fatalf("err = %v, want %v once the IP budget is spent", err, codes.ResourceExhausted)
+	}
+}
+
+func TestIPRateLimiterIgnoresSubject(t *testing.T) {
+	tests := []struct {
+		name        string
+		byIP        bool
+		wantAllowed bool
+	}{
+		{name: "per subject", byIP: false, wantAllowed: true},
+		{name: "per IP", byIP: true, wantAllowed: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rl := NewRateLimiter(RateLimiterConfig{Default: RateLimit{Limit: 1, Period: time.Minute}, ByIP: tt.byIP})
+			var allowed bool
+			for _, subject := range []string{"alice", "bob"} {
+				ctx := auth.NewContext(context.Background(), &auth.Principal{Subject: subject})
+				result, err := rl.allow(ctx, http.MethodGet, "/v1/products", rl.clientKey(ctx, "192.0.2.1:1234"))
+				if err != nil {
+					t.Fatal(err)
+				}
+				allowed = result.Allowed
+			}
+			if allowed != tt.wantAllowed {
+				t.Errorf("second subject on the same IP allowed = %v, want %v", allowed, tt.wantAllowed)
+			}
+		})
+	}
+}
+
+func TestIPRateLimiterSendsHeadersOnlyWhenRejecting(t *testing.T) {
+	rl := NewRateLimiter(RateLimiterConfig{Default: RateLimit{Limit: 1, Period: time.Minute}, ByIP: true})
+	handler := rl.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	for i, wantHeader := range []bool{false, true} {
+		r := httptest.NewRequest(http.MethodPost, "/login", nil)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		if got := w.Header().Get(RateLimitLimitHeader) != ""; got != wantHeader {
+			t.Errorf("request %d: %s sent = %v, want %v", i, RateLimitLimitHeader, got, wantHeader)
+		}
+	}
+}
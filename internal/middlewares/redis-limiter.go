@@ -0,0 +1,84 @@
+package middlewares
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const DefaultRedisLimiterPrefix = "oms-gateway:ratelimit:"
+
+// gcraScript implements the generic cell rate algorithm. Only the theoretical
+// arrival time (TAT) of the next request is stored per key, so the check and
+// update happen atomically in a single round trip. Time comes from the Redis
+// server to keep replicas with skewed clocks consistent. All values are in
+// microseconds.
+//
+// KEYS[1] = bucket key
+// ARGV[1] = emission interval (period / limit)
+// ARGV[2] = burst (limit)
+//
+// Returns {allowed, remaining, retry_after, reset_after}.
+var gcraScript = redis.NewScript(`
+redis.replicate_commands()
+
+local emission_interval = tonumber(ARGV[1])
+local burst = tonumber(ARGV[2])
+local delay_tolerance = emission_interval * burst
+
+local time = redis.call("TIME")
+local now = tonumber(time[1]) * 1000000 + tonumber(time[2])
+
+local tat = tonumber(redis.call("GET", KEYS[1]))
+if not tat or tat < now then
+  tat = now
+end
+
+local new_tat = tat + emission_interval
+local allow_at = new_tat - delay_tolerance
+
+if now < allow_at then
+  local remaining = math.floor((now - (tat - delay_tolerance)) / emission_interval)
+  return {0, remaining, allow_at - now, tat - now}
+end
+
+redis.call("SET", KEYS[1], new_tat, "PX", math.ceil((new_tat - now) / 1000))
+local remaining = math.floor((now - (new_tat - delay_tolerance)) / emission_interval)
+return {1, remaining, 0, new_tat - now}
+`)
+
+// RedisLimiter shares rate limit state between gateway replicas through any
+// server speaking the Redis protocol.
+type RedisLimiter struct {
+	client redis.UniversalClient
+	prefix string
+}
+
+func NewRedisLimiter(client redis.UniversalClient) *RedisLimiter {
+	return &RedisLimiter{client: client, prefix: DefaultRedisLimiterPrefix}
+}
+
+func (rl *RedisLimiter) Allow(ctx context.Context, key string, limit RateLimit) (RateLimitResult, error) {
+	emissionInterval := limit.Period.Microseconds() / int64(limit.Limit)
+	if emissionInterval <= 0 {
+		emissionInterval = 1
+	}
+
+	values, err := gcraScript.Run(ctx, rl.client, []string{rl.prefix + key}, emissionInterval, limit.Limit).Int64Slice()
+	if err != nil {
+		return RateLimitResult{}, fmt.Errorf("rate limit store: %w", err)
+	}
+	if len(values) != 4 {
+		return RateLimitResult{}, fmt.Errorf("rate limit store: unexpected reply %v", values)
+	}
+
+	return RateLimitResult{
+		Allowed:    values[0] == 1,
+		Limit:      int64(limit.Limit),
+		Remaining:  max(values[1], 0),
+		RetryAfter: time.Duration(values[2]) * time.Microsecond,
+		ResetAfter: time.Duration(values[3]) * time.Microsecond,
+	}, nil
+}
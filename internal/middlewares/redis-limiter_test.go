@@ -0,0 +1,116 @@
+package middlewares
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+func newTestRedisLimiter(t *testing.T) (*RedisLimiter, *miniredis.Miniredis) {
+	t.Helper()
+	server := miniredis.RunT(t)
+	server.SetTime(time.Unix(1700000000, 0))
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { client.Close() })
+	return NewRedisLimiter(client), server
+}
+
+func TestRedisLimiterAllowsBurstThenRejects(t *testing.T) {
+	limiter, _ := newTestRedisLimiter(t)
+	ctx := context.Background()
+	limit := RateLimit{Limit: 3, Period: 3 * time.Second}
+
+	for i := 0; i < 3; i++ {
+		result, err := limiter.Allow(ctx, "client", limit)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !result.Allowed {
+			t.Fatalf("request %d was rejected within the burst", i+1)
+		}
+		if want := int64(2 - i); result.Remaining != want {
+			t.Errorf("request %d: remaining = %d, want %d", i+1, result.Remaining, want)
+		}
+		if result.Limit != 3 {
+			t.Errorf("limit = %d, want 3", result.Limit)
+		}
+	}
+
+	result, err := limiter.Allow(ctx, "client", limit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Allowed {
+		t.Fatal("request over the burst was allowed")
+	}
+	if result.Remaining != 0 {
+		t.Errorf("remaining = %d, want 0", result.Remaining)
+	}
+	if result.RetryAfter != time.Second {
+		t.Errorf("retry after = %v, want 1s", result.RetryAfter)
+	}
+	if result.ResetAfter != 3*time.Second {
+		t.Errorf("reset after = %v, want 3s", result.ResetAfter)
+	}
+}
+
+func TestRedisLimiterRefillsOverTime(t *testing.T) {
+	limiter, server := newTestRedisLimiter(t)
+	ctx := context.Background()
+	limit := RateLimit{Limit: 2, Period: 2 * time.Second}
+
+	for i := 0; i < 2; i++ {
+		if result, _ := limiter.Allow(ctx, "client", limit); !result.Allowed {
+			t.Fatalf("request %d was rejected within the burst", i+1)
+		}
+	}
+	if result, _ := limiter.Allow(ctx, "client", limit); result.Allowed {
+		t.Fatal("request over the burst was allowed")
+	}
+
+	// One emission interval later exactly one request fits again.
+	server.SetTime(time.Unix(1700000001, 0))
+	if result, _ := limiter.Allow(ctx, "client", limit); !result.Allowed {
+		t.Fatal("request was rejected after the bucket refilled")
+	}
+	if result, _ := limiter.Allow(ctx, "client", limit); result.Allowed {
+		t.Fatal("second request was allowed after a single refill")
+	}
+}
+
+func TestRedisLimiterKeysAreIndependentAndExpire(t *testing.T) {
+	limiter, server := newTestRedisLimiter(t)
+	ctx := context.Background()
+	limit := RateLimit{Limit: 1, Period: time.Minute}
+
+	if result, _ := limiter.Allow(ctx, "a", limit); !result.Allowed {
+		t.Fatal("first request of a was rejected")
+	}
+	if result, _ := limiter.Allow(ctx, "b", limit); !result.Allowed {
+		t.Fatal("first request of b was rejected after a used its budget")
+	}
+
+	key := DefaultRedisLimiterPrefix + "a"
+	if !server.Exists(key) {
+		t.Fatalf("%s was not stored", key)
+	}
+	if ttl := server.TTL(key); ttl <= 0 || ttl > time.Minute {
+		t.Errorf("ttl of %s = %v, want within one period", key, ttl)
+	}
+	server.FastForward(time.Minute)
+	if server.Exists(key) {
+		t.Errorf("%s outlived its period", key)
+	}
+}
+
+func TestRedisLimiterReportsStoreErrors(t *testing.T) {
+	limiter, server := newTestRedisLimiter(t)
+	server.Close()
+
+	if _, err := limiter.Allow(context.Background(), "client", RateLimit{Limit: 1, Period: time.Second}); err == nil {
+		t.Fatal("expected an error with the store down")
+	}
+}
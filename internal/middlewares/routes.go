@@ -0,0 +1,135 @@
+package middlewares
+
+import (
+	"strings"
+
+	"google.golang.org/genproto/googleapis/api/annotations"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+)
+
+// Route identifies an endpoint by HTTP method and path pattern, using the same
+// template syntax as the google.api.http options in proto/gateway.proto, e.g.
+// "/v1/product/{product_id}". Method "*" matches any method.
+type Route struct {
+	Method  string
+	Pattern string
+}
+
+func (rt Route) String() string {
+	return rt.Method + " " + rt.Pattern
+}
+
+func (rt Route) Matches(method, path string) bool {
+	if rt.Method != "*" && !strings.EqualFold(rt.Method, method) {
+		return false
+	}
+	return matchPattern(rt.Pattern, path)
+}
+
+// ParseRoute parses "METHOD /path/pattern". A bare pattern matches any method.
+func ParseRoute(s string) Route {
+	s = strings.TrimSpace(s)
+	method, pattern, found := strings.Cut(s, " ")
+	if !found {
+		return Route{Method: "*", Pattern: s}
+	}
+	return Route{Method: strings.ToUpper(method), Pattern: strings.TrimSpace(pattern)}
+}
+
+func matchPattern(pattern, path string) bool {
+	patternSegments := strings.Split(strings.Trim(pattern, "/"), "/")
+	pathSegments := strings.Split(strings.Trim(path, "/"), "/")
+	if len(patternSegments) != len(pathSegments) {
+		return false
+	}
+	for i, segment := range patternSegments {
+		if segment == "*" || (strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}")) {
+			if pathSegments[i] == "" {
+				return false
+			}
+			continue
+		}
+		if segment != pathSegments[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// RouteTable resolves requests to the route they were registered under.
+type RouteTable []Route
+
+// Lookup returns the first route matching the request.
+func (t RouteTable) Lookup(method, path string) (Route, bool) {
+	for _, rt := range t {
+		if rt.Matches(method, path) {
+			return rt, true
+		}
+	}
+	return Route{}, false
+}
+
+// ServiceRoutes returns the HTTP routes bound to the methods of a gRPC
+// service, e.g. "oms.GatewayService".
+func ServiceRoutes(service string) RouteTable {
+	desc, err := protoregistry.GlobalFiles.FindDescriptorByName(protoreflect.FullName(service))
+	if err != nil {
+		return nil
+	}
+	serviceDesc, ok := desc.(protoreflect.ServiceDescriptor)
+	if !ok {
+		return nil
+	}
+	var routes RouteTable
+	for i := 0; i < serviceDesc.Methods().Len(); i++ {
+		method := serviceDesc.Methods().Get(i)
+		if rt, ok := RouteForGRPCMethod("/" + service + "/" + string(method.Name())); ok {
+			routes = append(routes, rt)
+		}
+	}
+	return routes
+}
+
+// RouteForGRPCMethod returns the HTTP route bound to a gRPC method through its
+// google.api.http option, so policies written for REST routes also apply to
+// the native gRPC listener. fullMethod has the form "/oms.GatewayService/GetProduct".
+func RouteForGRPCMethod(fullMethod string) (Route, bool) {
+	service, method, found := strings.Cut(strings.TrimPrefix(fullMethod, "/"), "/")
+	if !found {
+		return Route{}, false
+	}
+	desc, err := protoregistry.GlobalFiles.FindDescriptorByName(protoreflect.FullName(service))
+	if err != nil {
+		return Route{}, false
+	}
+	serviceDesc, ok := desc.(protoreflect.ServiceDescriptor)
+	if !ok {
+		return Route{}, false
+	}
+	methodDesc := serviceDesc.Methods().ByName(protoreflect.Name(method))
+	if methodDesc == nil {
+		return Route{}, false
+	}
+	rule, ok := proto.GetExtension(methodDesc.Options(), annotations.E_Http).(*annotations.HttpRule)
+	if !ok || rule == nil {
+		return Route{}, false
+	}
+
+	switch pattern := rule.GetPattern().(type) {
+	case *annotations.HttpRule_Get:
+		return Route{Method: "GET", Pattern: pattern.Get}, true
+	case *annotations.HttpRule_Put:
+		return Route{Method: "PUT", Pattern: pattern.Put}, true
+	case *annotations.HttpRule_Post:
+		return Route{Method: "POST", Pattern: pattern.Post}, true
+	case *annotations.HttpRule_Delete:
+		return Route{Method: "DELETE", Pattern: pattern.Delete}, true
+	case *annotations.HttpRule_Patch:
+		return Route{Method: "PATCH", Pattern: pattern.Patch}, true
+	case *annotations.HttpRule_Custom:
+		return Route{Method: pattern.Custom.GetKind(), Pattern: pattern.Custom.GetPath()}, true
+	}
+	return Route{}, false
+}
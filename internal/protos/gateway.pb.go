@@ -1,7 +1,7 @@
 // Code generated by protoc-gen-go. DO NOT EDIT.
 // versions:
 // 	protoc-gen-go v1.33.0
-// 	protoc        v4.25.3
+// 	protoc        (unknown)
 // source: gateway.proto
 
 package oms
@@ -30,7 +30,7 @@ var file_gateway_proto_rawDesc = []byte{
 	0x1a, 0x1b, 0x67, 0x6f, 0x6f, 0x67, 0x6c, 0x65, 0x2f, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x62, 0x75,
 	0x66, 0x2f, 0x65, 0x6d, 0x70, 0x74, 0x79, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x1a, 0x1c, 0x67,
 	0x6f, 0x6f, 0x67, 0x6c, 0x65, 0x2f, 0x61, 0x70, 0x69, 0x2f, 0x61, 0x6e, 0x6e, 0x6f, 0x74, 0x61,
-	0x74, 0x69, 0x6f, 0x6e, 0x73, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x32, 0x89, 0x05, 0x0a, 0x0e,
+	0x74, 0x69, 0x6f, 0x6e, 0x73, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x32, 0x84, 0x06, 0x0a, 0x0e,
 	0x47, 0x61, 0x74, 0x65, 0x77, 0x61, 0x79, 0x53, 0x65, 0x72, 0x76, 0x69, 0x63, 0x65, 0x12, 0x54,
 	0x0a, 0x0a, 0x47, 0x65, 0x74, 0x50, 0x72, 0x6f, 0x64, 0x75, 0x63, 0x74, 0x12, 0x16, 0x2e, 0x6f,
 	0x6d, 0x73, 0x2e, 0x47, 0x65, 0x74, 0x50, 0x72, 0x6f, 0x64, 0x75, 0x63, 0x74, 0x52, 0x65, 0x71,
@@ -60,21 +60,29 @@ var file_gateway_proto_rawDesc = []byte{
 	0x6f, 0x6d, 0x73, 0x2e, 0x44, 0x65, 0x6c, 0x65, 0x74, 0x65, 0x50, 0x72, 0x6f, 0x64, 0x75, 0x63,
 	0x74, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x22, 0x20, 0x82, 0xd3, 0xe4, 0x93, 0x02,
 	0x1a, 0x2a, 0x18, 0x2f, 0x76, 0x31, 0x2f, 0x70, 0x72, 0x6f, 0x64, 0x75, 0x63, 0x74, 0x2f, 0x7b,
-	0x70, 0x72, 0x6f, 0x64, 0x75, 0x63, 0x74, 0x5f, 0x69, 0x64, 0x7d, 0x12, 0x51, 0x0a, 0x0a, 0x4c,
-	0x69, 0x73, 0x74, 0x4f, 0x72, 0x64, 0x65, 0x72, 0x73, 0x12, 0x16, 0x2e, 0x67, 0x6f, 0x6f, 0x67,
-	0x6c, 0x65, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x62, 0x75, 0x66, 0x2e, 0x45, 0x6d, 0x70, 0x74,
-	0x79, 0x1a, 0x17, 0x2e, 0x6f, 0x6d, 0x73, 0x2e, 0x4c, 0x69, 0x73, 0x74, 0x4f, 0x72, 0x64, 0x65,
-	0x72, 0x73, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x22, 0x12, 0x82, 0xd3, 0xe4, 0x93,
-	0x02, 0x0c, 0x12, 0x0a, 0x2f, 0x76, 0x31, 0x2f, 0x6f, 0x72, 0x64, 0x65, 0x72, 0x73, 0x12, 0x57,
-	0x0a, 0x0b, 0x43, 0x72, 0x65, 0x61, 0x74, 0x65, 0x4f, 0x72, 0x64, 0x65, 0x72, 0x12, 0x17, 0x2e,
-	0x6f, 0x6d, 0x73, 0x2e, 0x43, 0x72, 0x65, 0x61, 0x74, 0x65, 0x4f, 0x72, 0x64, 0x65, 0x72, 0x52,
-	0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x18, 0x2e, 0x6f, 0x6d, 0x73, 0x2e, 0x43, 0x72, 0x65,
-	0x61, 0x74, 0x65, 0x4f, 0x72, 0x64, 0x65, 0x72, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65,
-	0x22, 0x15, 0x82, 0xd3, 0xe4, 0x93, 0x02, 0x0f, 0x3a, 0x01, 0x2a, 0x22, 0x0a, 0x2f, 0x76, 0x31,
-	0x2f, 0x6f, 0x72, 0x64, 0x65, 0x72, 0x73, 0x42, 0x27, 0x5a, 0x25, 0x67, 0x69, 0x74, 0x68, 0x75,
-	0x62, 0x2e, 0x63, 0x6f, 0x6d, 0x2f, 0x69, 0x6c, 0x69, 0x76, 0x65, 0x73, 0x74, 0x72, 0x6f, 0x6e,
-	0x67, 0x2f, 0x6f, 0x6d, 0x73, 0x2d, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x73, 0x2f, 0x6f, 0x6d, 0x73,
-	0x62, 0x06, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x33,
+	0x70, 0x72, 0x6f, 0x64, 0x75, 0x63, 0x74, 0x5f, 0x69, 0x64, 0x7d, 0x12, 0x79, 0x0a, 0x13, 0x44,
+	0x65, 0x63, 0x72, 0x65, 0x6d, 0x65, 0x6e, 0x74, 0x50, 0x72, 0x6f, 0x64, 0x75, 0x63, 0x74, 0x51,
+	0x74, 0x79, 0x12, 0x18, 0x2e, 0x6f, 0x6d, 0x73, 0x2e, 0x44, 0x65, 0x63, 0x72, 0x65, 0x6d, 0x65,
+	0x6e, 0x74, 0x51, 0x74, 0x79, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x19, 0x2e, 0x6f,
+	0x6d, 0x73, 0x2e, 0x44, 0x65, 0x63, 0x72, 0x65, 0x6d, 0x65, 0x6e, 0x74, 0x51, 0x74, 0x79, 0x52,
+	0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x22, 0x2d, 0x82, 0xd3, 0xe4, 0x93, 0x02, 0x27, 0x3a,
+	0x01, 0x2a, 0x22, 0x22, 0x2f, 0x76, 0x31, 0x2f, 0x70, 0x72, 0x6f, 0x64, 0x75, 0x63, 0x74, 0x2f,
+	0x7b, 0x70, 0x72, 0x6f, 0x64, 0x75, 0x63, 0x74, 0x5f, 0x69, 0x64, 0x7d, 0x2f, 0x64, 0x65, 0x63,
+	0x72, 0x65, 0x6d, 0x65, 0x6e, 0x74, 0x12, 0x51, 0x0a, 0x0a, 0x4c, 0x69, 0x73, 0x74, 0x4f, 0x72,
+	0x64, 0x65, 0x72, 0x73, 0x12, 0x16, 0x2e, 0x67, 0x6f, 0x6f, 0x67, 0x6c, 0x65, 0x2e, 0x70, 0x72,
+	0x6f, 0x74, 0x6f, 0x62, 0x75, 0x66, 0x2e, 0x45, 0x6d, 0x70, 0x74, 0x79, 0x1a, 0x17, 0x2e, 0x6f,
+	0x6d, 0x73, 0x2e, 0x4c, 0x69, 0x73, 0x74, 0x4f, 0x72, 0x64, 0x65, 0x72, 0x73, 0x52, 0x65, 0x73,
+	0x70, 0x6f, 0x6e, 0x73, 0x65, 0x22, 0x12, 0x82, 0xd3, 0xe4, 0x93, 0x02, 0x0c, 0x12, 0x0a, 0x2f,
+	0x76, 0x31, 0x2f, 0x6f, 0x72, 0x64, 0x65, 0x72, 0x73, 0x12, 0x57, 0x0a, 0x0b, 0x43, 0x72, 0x65,
+	0x61, 0x74, 0x65, 0x4f, 0x72, 0x64, 0x65, 0x72, 0x12, 0x17, 0x2e, 0x6f, 0x6d, 0x73, 0x2e, 0x43,
+	0x72, 0x65, 0x61, 0x74, 0x65, 0x4f, 0x72, 0x64, 0x65, 0x72, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73,
+	0x74, 0x1a, 0x18, 0x2e, 0x6f, 0x6d, 0x73, 0x2e, 0x43, 0x72, 0x65, 0x61, 0x74, 0x65, 0x4f, 0x72,
+	0x64, 0x65, 0x72, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x22, 0x15, 0x82, 0xd3, 0xe4,
+	0x93, 0x02, 0x0f, 0x3a, 0x01, 0x2a, 0x22, 0x0a, 0x2f, 0x76, 0x31, 0x2f, 0x6f, 0x72, 0x64, 0x65,
+	0x72, 0x73, 0x42, 0x27, 0x5a, 0x25, 0x67, 0x69, 0x74, 0x68, 0x75, 0x62, 0x2e, 0x63, 0x6f, 0x6d,
+	0x2f, 0x69, 0x6c, 0x69, 0x76, 0x65, 0x73, 0x74, 0x72, 0x6f, 0x6e, 0x67, 0x2f, 0x6f, 0x6d, 0x73,
+	0x2d, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x73, 0x2f, 0x6f, 0x6d, 0x73, 0x62, 0x06, 0x70, 0x72, 0x6f,
+	0x74, 0x6f, 0x33,
 }
 
 var file_gateway_proto_goTypes = []interface{}{
@@ -83,13 +91,15 @@ var file_gateway_proto_goTypes = []interface{}{
 	(*CreateProductRequest)(nil),  // 2: oms.CreateProductRequest
 	(*UpdateProductRequest)(nil),  // 3: oms.UpdateProductRequest
 	(*DeleteProductRequest)(nil),  // 4: oms.DeleteProductRequest
-	(*emptypb.Empty)(nil),         // 5: google.protobuf.Empty
-	(*CreateOrderRequest)(nil),    // 6: oms.CreateOrderRequest
-	(*Product)(nil),               // 7: oms.Product
-	(*ListProductsResponse)(nil),  // 8: oms.ListProductsResponse
-	(*DeleteProductResponse)(nil), // 9: oms.DeleteProductResponse
-	(*ListOrdersResponse)(nil),    // 10: oms.ListOrdersResponse
-	(*CreateOrderResponse)(nil),   // 11: oms.CreateOrderResponse
+	(*DecrementQtyRequest)(nil),   // 5: oms.DecrementQtyRequest
+	(*emptypb.Empty)(nil),         // 6: google.protobuf.Empty
+	(*CreateOrderRequest)(nil),    // 7: oms.CreateOrderRequest
+	(*Product)(nil),               // 8: oms.Product
+	(*ListProductsResponse)(nil),  // 9: oms.ListProductsResponse
+	(*DeleteProductResponse)(nil), // 10: oms.DeleteProductResponse
+	(*DecrementQtyResponse)(nil),  // 11: oms.DecrementQtyResponse
+	(*ListOrdersResponse)(nil),    // 12: oms.ListOrdersResponse
+	(*CreateOrderResponse)(nil),   // 13: oms.CreateOrderResponse
 }
 var file_gateway_proto_depIdxs = []int32{
 	0,  // 0: oms.GatewayService.GetProduct:input_type -> oms.GetProductRequest
@@ -97,17 +107,19 @@ var file_gateway_proto_depIdxs = []int32{
 	2,  // 2: oms.GatewayService.CreateProduct:input_type -> oms.CreateProductRequest
 	3,  // 3: oms.GatewayService.UpdateProduct:input_type -> oms.UpdateProductRequest
 	4,  // 4: oms.GatewayService.DeleteProduct:input_type -> oms.DeleteProductRequest
-	5,  // 5: oms.GatewayService.ListOrders:input_type -> google.protobuf.Empty
-	6,  // 6: oms.GatewayService.CreateOrder:input_type -> oms.CreateOrderRequest
-	7,  // 7: oms.GatewayService.GetProduct:output_type -> oms.Product
-	8,  // 8: oms.GatewayService.ListProducts:output_type -> oms.ListProductsResponse
-	7,  // 9: oms.GatewayService.CreateProduct:output_type -> oms.Product
-	7,  // 10: oms.GatewayService.UpdateProduct:output_type -> oms.Product
-	9,  // 11: oms.GatewayService.DeleteProduct:output_type -> oms.DeleteProductResponse
-	10, // 12: oms.GatewayService.ListOrders:output_type -> oms.ListOrdersResponse
-	11, // 13: oms.GatewayService.CreateOrder:output_type -> oms.CreateOrderResponse
-	7,  // [7:14] is the sub-list for method output_type
-	0,  // [0:7] is the sub-list for method input_type
+	5,  // 5: oms.GatewayService.DecrementProductQty:input_type -> oms.DecrementQtyRequest
+	6,  // 6: oms.GatewayService.ListOrders:input_type -> google.protobuf.Empty
+	7,  // 7: oms.GatewayService.CreateOrder:input_type -> oms.CreateOrderRequest
+	8,  // 8: oms.GatewayService.GetProduct:output_type -> oms.Product
+	9,  // 9: oms.GatewayService.ListProducts:output_type -> oms.ListProductsResponse
+	8,  // 10: oms.GatewayService.CreateProduct:output_type -> oms.Product
+	8,  // 11: oms.GatewayService.UpdateProduct:output_type -> oms.Product
+	10, // 12: oms.GatewayService.DeleteProduct:output_type -> oms.DeleteProductResponse
+	11, // 13: oms.GatewayService.DecrementProductQty:output_type -> oms.DecrementQtyResponse
+	12, // 14: oms.GatewayService.ListOrders:output_type -> oms.ListOrdersResponse
+	13, // 15: oms.GatewayService.CreateOrder:output_type -> oms.CreateOrderResponse
+	8,  // [8:16] is the sub-list for method output_type
+	0,  // [0:8] is the sub-list for method input_type
 	0,  // [0:0] is the sub-list for extension type_name
 	0,  // [0:0] is the sub-list for extension extendee
 	0,  // [0:0] is the sub-list for field type_name
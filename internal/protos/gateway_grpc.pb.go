@@ -1,7 +1,7 @@
 // Code generated by protoc-gen-go-grpc. DO NOT EDIT.
 // versions:
 // - protoc-gen-go-grpc v1.3.0
-// - protoc             v4.25.3
+// - protoc             (unknown)
 // source: gateway.proto
 
 package oms
@@ -20,13 +20,14 @@ import (
 const _ = grpc.SupportPackageIsVersion7
 
 const (
-	GatewayService_GetProduct_FullMethodName    = "/oms.GatewayService/GetProduct"
-	GatewayService_ListProducts_FullMethodName  = "/oms.GatewayService/ListProducts"
-	GatewayService_CreateProduct_FullMethodName = "/oms.GatewayService/CreateProduct"
-	GatewayService_UpdateProduct_FullMethodName = "/oms.GatewayService/UpdateProduct"
-	GatewayService_DeleteProduct_FullMethodName = "/oms.GatewayService/DeleteProduct"
-	GatewayService_ListOrders_FullMethodName    = "/oms.GatewayService/ListOrders"
-	GatewayService_CreateOrder_FullMethodName   = "/oms.GatewayService/CreateOrder"
+	GatewayService_GetProduct_FullMethodName          = "/oms.GatewayService/GetProduct"
+	GatewayService_ListProducts_FullMethodName        = "/oms.GatewayService/ListProducts"
+	GatewayService_CreateProduct_FullMethodName       = "/oms.GatewayService/CreateProduct"
+	GatewayService_UpdateProduct_FullMethodName       = "/oms.GatewayService/UpdateProduct"
+	GatewayService_DeleteProduct_FullMethodName       = "/oms.GatewayService/DeleteProduct"
+	GatewayService_DecrementProductQty_FullMethodName = "/oms.GatewayService/DecrementProductQty"
+	GatewayService_ListOrders_FullMethodName          = "/oms.GatewayService/ListOrders"
+	GatewayService_CreateOrder_FullMethodName         = "/oms.GatewayService/CreateOrder"
 )
 
 // GatewayServiceClient is the client API for GatewayService service.
@@ -38,6 +39,10 @@ type GatewayServiceClient interface {
 	CreateProduct(ctx context.Context, in *CreateProductRequest, opts ...grpc.CallOption) (*Product, error)
 	UpdateProduct(ctx context.Context, in *UpdateProductRequest, opts ...grpc.CallOption) (*Product, error)
 	DeleteProduct(ctx context.Context, in *DeleteProductRequest, opts ...grpc.CallOption) (*DeleteProductResponse, error)
+	// DecrementProductQty reduces the available stock of a product by offset.
+	// offset must be positive; the call fails with ABORTED (HTTP 409) when the
+	// product does not have enough stock.
+	DecrementProductQty(ctx context.Context, in *DecrementQtyRequest, opts ...grpc.CallOption) (*DecrementQtyResponse, error)
 	ListOrders(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (*ListOrdersResponse, error)
 	CreateOrder(ctx context.Context, in *CreateOrderRequest, opts ...grpc.CallOption) (*CreateOrderResponse, error)
 }
@@ -95,6 +100,15 @@ func (c *gatewayServiceClient) DeleteProduct(ctx context.Context, in *DeleteProd
 	return out, nil
 }
 
+func (c *gatewayServiceClient) DecrementProductQty(ctx context.Context, in *DecrementQtyRequest, opts ...grpc.CallOption) (*DecrementQtyResponse, error) {
+	out := new(DecrementQtyResponse)
+	err := c.cc.Invoke(ctx, GatewayService_DecrementProductQty_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 func (c *gatewayServiceClient) ListOrders(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (*ListOrdersResponse, error) {
 	out := new(ListOrdersResponse)
 	err := c.cc.Invoke(ctx, GatewayService_ListOrders_FullMethodName, in, out, opts...)
@@ -122,6 +136,10 @@ type GatewayServiceServer interface {
 	CreateProduct(context.Context, *CreateProductRequest) (*Product, error)
 	UpdateProduct(context.Context, *UpdateProductRequest) (*Product, error)
 	DeleteProduct(context.Context, *DeleteProductRequest) (*DeleteProductResponse, error)
+	// DecrementProductQty reduces the available stock of a product by offset.
+	// offset must be positive; the call fails with ABORTED (HTTP 409) when the
+	// product does not have enough stock.
+	DecrementProductQty(context.Context, *DecrementQtyRequest) (*DecrementQtyResponse, error)
 	ListOrders(context.Context, *emptypb.Empty) (*ListOrdersResponse, error)
 	CreateOrder(context.Context, *CreateOrderRequest) (*CreateOrderResponse, error)
 	mustEmbedUnimplementedGatewayServiceServer()
@@ -146,6 +164,9 @@ func (UnimplementedGatewayServiceServer) UpdateProduct(context.Context, *UpdateP
 func (UnimplementedGatewayServiceServer) DeleteProduct(context.Context, *DeleteProductRequest) (*DeleteProductResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method DeleteProduct not implemented")
 }
+func (UnimplementedGatewayServiceServer) DecrementProductQty(context.Context, *DecrementQtyRequest) (*DecrementQtyResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DecrementProductQty not implemented")
+}
 func (UnimplementedGatewayServiceServer) ListOrders(context.Context, *emptypb.Empty) (*ListOrdersResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method ListOrders not implemented")
 }
@@ -255,6 +276,24 @@ func _GatewayService_DeleteProduct_Handler(srv interface{}, ctx context.Context,
 	return interceptor(ctx, in, info, handler)
 }
 
+func _GatewayService_DecrementProductQty_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DecrementQtyRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(GatewayServiceServer).DecrementProductQty(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: GatewayService_DecrementProductQty_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(GatewayServiceServer).DecrementProductQty(ctx, req.(*DecrementQtyRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 func _GatewayService_ListOrders_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
 	in := new(emptypb.Empty)
 	if err := dec(in); err != nil {
@@ -318,6 +357,10 @@ var GatewayService_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "DeleteProduct",
 			Handler:    _GatewayService_DeleteProduct_Handler,
 		},
+		{
+			MethodName: "DecrementProductQty",
+			Handler:    _GatewayService_DecrementProductQty_Handler,
+		},
 		{
 			MethodName: "ListOrders",
 			Handler:    _GatewayService_ListOrders_Handler,
@@ -0,0 +1,3 @@
+package oms
+
+//go:generate sh -c "cd ../.. && buf generate"
@@ -0,0 +1,74 @@
+package oms
+
+import (
+	"bytes"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// TestGeneratedCodeIsUpToDate regenerates the code from proto/ into a temporary
+// directory and fails when it differs from the files checked in here. It needs
+// buf on the PATH; without it the test is skipped, except in CI.
+func TestGeneratedCodeIsUpToDate(t *testing.T) {
+	buf, err := exec.LookPath("buf")
+	if err != nil {
+		if os.Getenv("CI") != "" {
+			t.Fatal("buf is not installed, but CI is set: install buf to check the generated code")
+		}
+		t.Skip("buf is not installed, so the generated code was not checked; set CI=1 to fail instead")
+	}
+	if testing.Short() {
+		t.Skip("generating code is slow")
+	}
+
+	root, err := filepath.Abs(filepath.Join("..", ".."))
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := t.TempDir()
+	cmd := exec.Command(buf, "generate", "--output", out)
+	cmd.Dir = root
+	if output, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("buf generate: %v\n%s", err, output)
+	}
+
+	want := generatedFiles(t, filepath.Join(out, "internal", "protos"))
+	got := generatedFiles(t, ".")
+	if !slices.Equal(got, want) {
+		t.Fatalf("generated files = %v, want %v; run 'go generate ./internal/protos'", got, want)
+	}
+	for _, name := range want {
+		wantContent, err := os.ReadFile(filepath.Join(out, "internal", "protos", name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		gotContent, err := os.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(gotContent, wantContent) {
+			t.Errorf("%s is out of date; run 'go generate ./internal/protos' and commit the result", name)
+		}
+	}
+}
+
+// generatedFiles lists the generated Go files in dir, sorted.
+func generatedFiles(t *testing.T, dir string) []string {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, entry := range entries {
+		if name := entry.Name(); strings.HasSuffix(name, ".pb.go") || strings.HasSuffix(name, ".pb.gw.go") {
+			names = append(names, name)
+		}
+	}
+	slices.Sort(names)
+	return names
+}
@@ -0,0 +1,51 @@
+// Package recorder wraps an http.ResponseWriter to remember the status and
+// size of the response, for middlewares that report on it afterwards.
+package recorder
+
+import "net/http"
+
+// ResponseRecorder records the status code and the number of body bytes
+// written through it. The status is the first one written, or 200 when the
+// handler wrote a body without calling WriteHeader.
+type ResponseRecorder struct {
+	http.ResponseWriter
+	status      int
+	bytes       int64
+	wroteHeader bool
+}
+
+// Wrap returns w itself when it is already a ResponseRecorder, so stacked
+// middlewares share one recorder instead of wrapping the writer once each.
+func Wrap(w http.ResponseWriter) *ResponseRecorder {
+	if r, ok := w.(*ResponseRecorder); ok {
+		return r
+	}
+	return &ResponseRecorder{ResponseWriter: w, status: http.StatusOK}
+}
+
+func (r *ResponseRecorder) Status() int {
+	return r.status
+}
+
+func (r *ResponseRecorder) BytesWritten() int64 {
+	return r.bytes
+}
+
+func (r *ResponseRecorder) WriteHeader(status int) {
+	if !r.wroteHeader {
+		r.status, r.wroteHeader = status, true
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *ResponseRecorder) Write(b []byte) (int, error) {
+	r.wroteHeader = true
+	n, err := r.ResponseWriter.Write(b)
+	r.bytes += int64(n)
+	return n, err
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (r *ResponseRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
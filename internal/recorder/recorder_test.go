@@ -0,0 +1,56 @@
+package recorder
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestResponseRecorder(t *testing.T) {
+	tests := []struct {
+		name       string
+		handler    http.HandlerFunc
+		wantStatus int
+		wantBytes  int64
+	}{
+		{
+			name:       "body without WriteHeader",
+			handler:    func(w http.ResponseWriter, r *http.Request) { w.Write([]byte("hello")) },
+			wantStatus: http.StatusOK,
+			wantBytes:  5,
+		},
+		{
+			name: "first status wins",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusNotFound)
+				w.WriteHeader(http.StatusInternalServerError)
+			},
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name: "status after the body is ignored",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte("hi"))
+				w.WriteHeader(http.StatusInternalServerError)
+			},
+			wantStatus: http.StatusOK,
+			wantBytes:  2,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := Wrap(httptest.NewRecorder())
+			tt.handler(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+			if rec.Status() != tt.wantStatus || rec.BytesWritten() != tt.wantBytes {
+				t.Errorf("status, bytes = %d, %d, want %d, %d", rec.Status(), rec.BytesWritten(), tt.wantStatus, tt.wantBytes)
+			}
+		})
+	}
+}
+
+func TestWrapSharesRecorder(t *testing.T) {
+	outer := Wrap(httptest.NewRecorder())
+	if inner := Wrap(outer); inner != outer {
+		t.Fatal("Wrap wrapped a ResponseRecorder again")
+	}
+}
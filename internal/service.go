@@ -2,15 +2,33 @@ package internal
 
 import (
 	"context"
-	"log"
+	"errors"
+	"log/slog"
+	"sync/atomic"
 
+	"github.com/ilivestrong/oms-gateway/internal/breaker"
+	"github.com/ilivestrong/oms-gateway/internal/certs"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
 	"google.golang.org/grpc"
-	"google.golang.org/grpc/credentials/insecure"
+)
+
+const (
+	OrderBackend   = "order"
+	ProductBackend = "product"
 )
 
 type Service struct {
 	OrderSvcClientConn   *grpc.ClientConn
 	ProductSvcClientConn *grpc.ClientConn
+
+	orderSvcCredentials   *certs.ClientCredentials
+	productSvcCredentials *certs.ClientCredentials
+
+	// breakers holds the circuit breakers of each backend, if enabled.
+	breakers map[string]*breaker.Set
+
+	notReady atomic.Bool
+	draining atomic.Bool
 }
 
 func New(opts *Options) (*Service, error) {
@@ -22,22 +40,107 @@ func New(opts *Options) (*Service, error) {
 }
 
 func initializeRpcConnections(opts *Options, svc *Service) error {
-	conn, err := grpc.Dial(opts.OrderServiceListenAddress, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	logger := opts.Logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+	svc.breakers = map[string]*breaker.Set{
+		OrderBackend:   newBreakers(OrderBackend, opts, logger),
+		ProductBackend: newBreakers(ProductBackend, opts, logger),
+	}
+
+	creds, err := certs.NewClientCredentials(OrderBackend, opts.OrderServiceTLS, logger)
 	if err != nil {
-		log.Fatalf("could not connect: %v", err)
 		return err
 	}
+	conn, err := grpc.Dial(opts.OrderServiceListenAddress,
+		append(dialOptions(OrderBackend, orderServiceName, svc.breakers[OrderBackend], opts, logger),
+			grpc.WithTransportCredentials(creds),
+			grpc.WithStatsHandler(otelgrpc.NewClientHandler()),
+		)...,
+	)
+	if err != nil {
+		return err
+	}
+	logger.Info("connecting to backend", "backend", OrderBackend, "address", opts.OrderServiceListenAddress, "transport", modeOf(opts.OrderServiceTLS))
 	svc.OrderSvcClientConn = conn
+	svc.orderSvcCredentials = creds
+	opts.Metrics.AddBackend(OrderBackend, conn)
 
-	conn, err = grpc.Dial(opts.ProductServiceListenAddress, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	creds, err = certs.NewClientCredentials(ProductBackend, opts.ProductServiceTLS, logger)
+	if err != nil {
+		return err
+	}
+	conn, err = grpc.Dial(opts.ProductServiceListenAddress,
+		append(dialOptions(ProductBackend, productServiceName, svc.breakers[ProductBackend], opts, logger),
+			grpc.WithTransportCredentials(creds),
+			grpc.WithStatsHandler(otelgrpc.NewClientHandler()),
+		)...,
+	)
 	if err != nil {
-		//log.Fatalf("could not connect: %v", err)
 		return err
 	}
+	logger.Info("connecting to backend", "backend", ProductBackend, "address", opts.ProductServiceListenAddress, "transport", modeOf(opts.ProductServiceTLS))
 	svc.ProductSvcClientConn = conn
+	svc.productSvcCredentials = creds
+	opts.Metrics.AddBackend(ProductBackend, conn)
 	return nil
 }
 
+func modeOf(cfg certs.ClientConfig) certs.Mode {
+	if cfg.Mode == "" {
+		return certs.ModePlaintext
+	}
+	return cfg.Mode
+}
+
+// HandshakeErrors returns the last failed TLS handshake of each backend whose
+// most recent handshake failed.
+func (svc *Service) HandshakeErrors() map[string]error {
+	errs := make(map[string]error)
+	if svc.orderSvcCredentials != nil {
+		if err := svc.orderSvcCredentials.HandshakeError(); err != nil {
+			errs[OrderBackend] = err
+		}
+	}
+	if svc.productSvcCredentials != nil {
+		if err := svc.productSvcCredentials.HandshakeError(); err != nil {
+			errs[ProductBackend] = err
+		}
+	}
+	return errs
+}
+
+// MarkNotReady makes readiness fail ahead of draining, so load balancers stop
+// sending traffic while requests are still served. It is irreversible.
+func (svc *Service) MarkNotReady() {
+	svc.notReady.Store(true)
+}
+
+func (svc *Service) IsNotReady() bool {
+	return svc.notReady.Load()
+}
+
+// StartDraining marks the service as shutting down, which also makes it not
+// ready. It is irreversible.
+func (svc *Service) StartDraining() {
+	svc.notReady.Store(true)
+	svc.draining.Store(true)
+}
+
+func (svc *Service) IsDraining() bool {
+	return svc.draining.Load()
+}
+
+// Shutdown closes the backend connections. Callers are expected to have
+// drained the listeners first so no request is still using them.
 func (svc *Service) Shutdown(ctx context.Context) error {
-	return nil
+	var errs []error
+	if svc.OrderSvcClientConn != nil {
+		errs = append(errs, svc.OrderSvcClientConn.Close())
+	}
+	if svc.ProductSvcClientConn != nil {
+		errs = append(errs, svc.ProductSvcClientConn.Close())
+	}
+	return errors.Join(errs...)
 }
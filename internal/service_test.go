@@ -0,0 +1,98 @@
+package internal
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	omspb "github.com/ilivestrong/oms-gateway/internal/protos"
+	"github.com/ilivestrong/oms-gateway/internal/tracing"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+type tracedProductServer struct {
+	omspb.UnimplementedProductServiceServer
+	spanContexts chan trace.SpanContext
+}
+
+func (s *tracedProductServer) Get(ctx context.Context, in *omspb.GetProductRequest) (*omspb.Product, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	carrier := propagation.HeaderCarrier{}
+	for _, value := range md.Get("traceparent") {
+		carrier.Set("traceparent", value)
+	}
+	s.spanContexts <- trace.SpanContextFromContext(propagation.TraceContext{}.Extract(context.Background(), carrier))
+	return &omspb.Product{Id: in.GetProductId()}, nil
+}
+
+// startProductBackend serves server on a loopback address and returns it.
+func startProductBackend(t *testing.T, server omspb.ProductServiceServer) string {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	grpcServer := grpc.NewServer()
+	omspb.RegisterProductServiceServer(grpcServer, server)
+	go grpcServer.Serve(listener)
+	t.Cleanup(grpcServer.Stop)
+	return listener.Addr().String()
+}
+
+func TestBackendCallsPropagateTraceContext(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	shutdownTracing, err := tracing.Setup(context.Background(), tracing.Config{SampleRatio: 1, SpanExporter: exporter})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		shutdownTracing(context.Background())
+		otel.SetTracerProvider(trace.NewNoopTracerProvider())
+	})
+
+	backend := &tracedProductServer{spanContexts: make(chan trace.SpanContext, 1)}
+	addr := startProductBackend(t, backend)
+	svc, err := New(&Options{ProductServiceListenAddress: addr, OrderServiceListenAddress: addr})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { svc.Shutdown(context.Background()) })
+
+	ctx, span := otel.Tracer("test").Start(context.Background(), "GET /v1/product/{product_id}")
+	_, err = omspb.NewProductServiceClient(svc.ProductSvcClientConn).Get(ctx, &omspb.GetProductRequest{ProductId: "7"})
+	span.End()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The in-memory exporter forgets its spans on shutdown, so flush instead.
+	if err := otel.GetTracerProvider().(*sdktrace.TracerProvider).ForceFlush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	received := <-backend.spanContexts
+	if received.TraceID() != span.SpanContext().TraceID() {
+		t.Errorf("backend got trace %s, want %s", received.TraceID(), span.SpanContext().TraceID())
+	}
+
+	var clientSpan *tracetest.SpanStub
+	for _, stub := range exporter.GetSpans() {
+		if stub.Name == "oms.ProductService/Get" {
+			clientSpan = &stub
+		}
+	}
+	if clientSpan == nil {
+		t.Fatalf("no client span exported, got %v", exporter.GetSpans().Snapshots())
+	}
+	if clientSpan.Parent.SpanID() != span.SpanContext().SpanID() {
+		t.Errorf("client span parent = %s, want the request span %s", clientSpan.Parent.SpanID(), span.SpanContext().SpanID())
+	}
+	if received.SpanID() != clientSpan.SpanContext.SpanID() {
+		t.Errorf("backend got parent span %s, want the client span %s", received.SpanID(), clientSpan.SpanContext.SpanID())
+	}
+}
@@ -0,0 +1,114 @@
+// Package tracing sets up OpenTelemetry tracing for the gateway. Spans are
+// exported to an OTLP collector or written to stdout, and trace context is
+// propagated with the W3C traceparent and baggage headers.
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Exporter selects where spans are sent.
+type Exporter string
+
+const (
+	ExporterNone   Exporter = "none"
+	ExporterStdout Exporter = "stdout"
+	// ExporterOTLP sends spans over OTLP/gRPC. The endpoint and its options
+	// are read from the standard OTEL_EXPORTER_OTLP_* environment variables.
+	ExporterOTLP Exporter = "otlp"
+
+	ServiceName = "oms-gateway"
+
+	// healthCheckSpan is the span name of grpc.health.v1 checks.
+	healthCheckSpan = "grpc.health.v1.Health/Check"
+)
+
+func ParseExporter(s string) (Exporter, error) {
+	switch exporter := Exporter(strings.ToLower(strings.TrimSpace(s))); exporter {
+	case "":
+		return ExporterNone, nil
+	case ExporterNone, ExporterStdout, ExporterOTLP:
+		return exporter, nil
+	}
+	return "", fmt.Errorf("unknown tracing exporter %q, expected none, stdout or otlp", s)
+}
+
+type Config struct {
+	Exporter Exporter
+	// SampleRatio is the fraction of new traces that are recorded. Requests
+	// that arrive with a sampled parent are always recorded.
+	SampleRatio float64
+	// ServiceVersion is reported as service.version.
+	ServiceVersion string
+	// SpanExporter overrides Exporter, e.g. with an in-memory exporter.
+	SpanExporter sdktrace.SpanExporter
+}
+
+// Setup installs the global tracer provider and propagator. The returned
+// function flushes pending spans and must be called on shutdown. With
+// ExporterNone only propagation is set up, so trace context received by the
+// gateway still reaches the backends.
+func Setup(ctx context.Context, cfg Config) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	exporter := cfg.SpanExporter
+	if exporter == nil {
+		var err error
+		switch cfg.Exporter {
+		case ExporterStdout:
+			exporter, err = stdouttrace.New()
+		case ExporterOTLP:
+			exporter, err = otlptracegrpc.New(ctx)
+		default:
+			return func(context.Context) error { return nil }, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to create %s trace exporter: %w", cfg.Exporter, err)
+		}
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(
+		semconv.SchemaURL,
+		semconv.ServiceName(ServiceName),
+		semconv.ServiceVersion(cfg.ServiceVersion),
+	))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create trace resource: %w", err)
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(dropHealthChecks{sdktrace.ParentBased(sdktrace.TraceIDRatioBased(cfg.SampleRatio))}),
+	)
+	otel.SetTracerProvider(provider)
+	return provider.Shutdown, nil
+}
+
+// dropHealthChecks keeps the periodic backend health checks, which have no
+// parent, from starting a trace of their own.
+type dropHealthChecks struct {
+	sdktrace.Sampler
+}
+
+func (s dropHealthChecks) ShouldSample(p sdktrace.SamplingParameters) sdktrace.SamplingResult {
+	if p.Name == healthCheckSpan && !trace.SpanContextFromContext(p.ParentContext).IsValid() {
+		return sdktrace.SamplingResult{Decision: sdktrace.Drop}
+	}
+	return s.Sampler.ShouldSample(p)
+}
+
+func (s dropHealthChecks) Description() string {
+	return "DropHealthChecks{" + s.Sampler.Description() + "}"
+}
@@ -2,52 +2,74 @@ package main
 
 import (
 	"context"
-	"encoding/json"
+	"crypto/tls"
 	"errors"
-	"fmt"
-	"io"
 	"log"
 	"log/slog"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
-	"strings"
 	"syscall"
 	"time"
 
 	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
 	internal "github.com/ilivestrong/oms-gateway/internal"
 	"github.com/ilivestrong/oms-gateway/internal/auth"
+	"github.com/ilivestrong/oms-gateway/internal/certs"
+	"github.com/ilivestrong/oms-gateway/internal/config"
 	"github.com/ilivestrong/oms-gateway/internal/gatewayservice"
+	"github.com/ilivestrong/oms-gateway/internal/handlers"
+	"github.com/ilivestrong/oms-gateway/internal/metrics"
 	"github.com/ilivestrong/oms-gateway/internal/middlewares"
 	omspb "github.com/ilivestrong/oms-gateway/internal/protos"
+	"github.com/ilivestrong/oms-gateway/internal/tracing"
 	env "github.com/joho/godotenv"
 	"github.com/justinas/alice"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
 )
 
 const (
-	envFile = ".env"
-	version = "v1.0.0"
+	envFile            = ".env"
+	version            = "v1.0.0"
+	grpcHealthInterval = 10 * time.Second
 )
 
-var (
-	loadEnv                       = env.Load
-	EncodingTypeJSON       string = "json"
-	ErrInvalidTokenRequest        = "email missing in the request"
-)
+var loadEnv = env.Load
 
 func main() {
-	appLogger := slog.New(slog.NewJSONHandler(os.Stdout, nil))
-
+	// Settings may come from the environment alone, so a missing .env is
+	// fine. Secrets such as JWT_KEYS have no default and must be set.
 	err := loadEnv(envFile)
-	if err != nil {
-		log.Fatal("failed to load .env")
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		log.Fatalf("failed to load .env: %v", err)
+	}
+	var logLevel slog.Level
+	if value := os.Getenv("LOG_LEVEL"); value != "" {
+		if err := logLevel.UnmarshalText([]byte(value)); err != nil {
+			log.Fatalf("invalid log level: %v", err)
+		}
 	}
+	appLogger := slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: logLevel}))
+	// Routes the log package, used for startup errors and background tasks,
+	// through the same JSON logger.
+	slog.SetDefault(appLogger)
+
 	gatwayAddr, exist := os.LookupEnv("LISTEN_ADDRESS_HTTP")
 	if !exist {
-		fmt.Println("no port specified, defaulting to 5015")
+		appLogger.Info("no port specified, defaulting to 5015")
 		gatwayAddr = "5015"
 	}
+	grpcAddr, exist := os.LookupEnv("LISTEN_ADDRESS_GRPC")
+	if !exist {
+		appLogger.Info("no grpc port specified, defaulting to 5016")
+		grpcAddr = "5016"
+	}
 	productSvcAddress, exist := os.LookupEnv("LISTEN_ADDRESS_PRODUCT")
 	if !exist {
 		log.Fatal("invalid product service address")
@@ -56,47 +78,319 @@ func main() {
 	if !exist {
 		log.Fatal("invalid order service address")
 	}
+	serverTLS, err := config.LoadServerTLS()
+	if err != nil {
+		log.Fatalf("invalid TLS configuration: %v", err)
+	}
+	orderSvcTLS, err := config.LoadBackendTLS("ORDER")
+	if err != nil {
+		log.Fatalf("invalid order service TLS configuration: %v", err)
+	}
+	productSvcTLS, err := config.LoadBackendTLS("PRODUCT")
+	if err != nil {
+		log.Fatalf("invalid product service TLS configuration: %v", err)
+	}
+	healthCheckTimeout, err := config.LoadHealthCheckTimeout()
+	if err != nil {
+		log.Fatalf("invalid health check timeout: %v", err)
+	}
+	backendCalls, err := config.LoadBackendCallPolicy()
+	if err != nil {
+		log.Fatalf("invalid backend call configuration: %v", err)
+	}
+	circuitBreaker, err := config.LoadCircuitBreaker()
+	if err != nil {
+		log.Fatalf("invalid circuit breaker configuration: %v", err)
+	}
+	metricsPort, err := config.LoadMetricsPort()
+	if err != nil {
+		log.Fatalf("invalid metrics configuration: %v", err)
+	}
+	tracingConfig, err := config.LoadTracing(version)
+	if err != nil {
+		log.Fatalf("invalid tracing configuration: %v", err)
+	}
+	shutdown, err := config.LoadShutdown()
+	if err != nil {
+		log.Fatalf("invalid shutdown configuration: %v", err)
+	}
+	rateLimiterConfig, err := config.LoadRateLimiter()
+	if err != nil {
+		log.Fatalf("invalid rate limit configuration: %v", err)
+	}
+	ipRateLimiterConfig, err := config.LoadIPRateLimiter(rateLimiterConfig)
+	if err != nil {
+		log.Fatalf("invalid IP rate limit configuration: %v", err)
+	}
+	keys, err := auth.LoadKeySet(config.LoadKeys())
+	if err != nil {
+		log.Fatalf("failed to load JWT keys: %v", err)
+	}
+	tokenConfig, err := config.LoadToken()
+	if err != nil {
+		log.Fatalf("invalid token configuration: %v", err)
+	}
+	usersFile, exist := os.LookupEnv("USERS_FILE")
+	if !exist {
+		log.Fatal("no users file specified")
+	}
+	users, err := auth.NewFileUserStore(usersFile)
+	if err != nil {
+		log.Fatalf("failed to load users: %v", err)
+	}
+	lockout, err := config.LoadLockout()
+	if err != nil {
+		log.Fatalf("invalid login lockout configuration: %v", err)
+	}
+	revocations, refreshTokens, err := config.LoadRevocationStores()
+	if err != nil {
+		log.Fatalf("invalid revocation configuration: %v", err)
+	}
+	policyFile, exist := os.LookupEnv("POLICY_FILE")
+	if !exist {
+		log.Fatal("no policy file specified")
+	}
+	policy, err := middlewares.LoadPolicy(policyFile)
+	if err != nil {
+		log.Fatalf("failed to load policy: %v", err)
+	}
+	tokenConfig.RoleScopes = policy.Roles
+	apiKeys, err := config.LoadAPIKeyStore()
+	if err != nil {
+		log.Fatalf("failed to load API keys: %v", err)
+	}
+	var oidcProviders []auth.OIDCConfig
+	if oidcFile := os.Getenv("OIDC_PROVIDERS_FILE"); oidcFile != "" {
+		oidcProviders, err = auth.LoadOIDCConfigs(oidcFile)
+		if err != nil {
+			log.Fatalf("failed to load OIDC providers: %v", err)
+		}
+	}
+
+	gatewayMetrics := metrics.New()
+	rateLimiterConfig.Metrics = gatewayMetrics
+	rateLimiterConfig.Logger = appLogger
+	ipRateLimiterConfig.Metrics = gatewayMetrics
+	ipRateLimiterConfig.Logger = appLogger
 
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
 	options := &internal.Options{
 		ListenAddressHTTPPort:       gatwayAddr,
+		ListenAddressGRPCPort:       grpcAddr,
+		TLS:                         serverTLS,
 		OrderServiceListenAddress:   OrderSvcAddress,
 		ProductServiceListenAddress: productSvcAddress,
+		OrderServiceTLS:             orderSvcTLS,
+		ProductServiceTLS:           productSvcTLS,
+		BackendCalls:                backendCalls,
+		CircuitBreaker:              circuitBreaker,
+		HealthCheckTimeout:          healthCheckTimeout,
+		ShutdownPreStopDelay:        shutdown.PreStopDelay,
+		ShutdownDrainTimeout:        shutdown.DrainTimeout,
+		RateLimiter:                 rateLimiterConfig,
+		IPRateLimiter:               ipRateLimiterConfig,
+		JWTKeys:                     keys,
+		Token:                       tokenConfig,
+		Users:                       users,
+		Lockout:                     lockout,
+		Revocations:                 revocations,
+		RefreshTokens:               refreshTokens,
+		Policy:                      policy,
+		APIKeys:                     apiKeys,
+		OIDCProviders:               oidcProviders,
+		Metrics:                     gatewayMetrics,
+		MetricsListenPort:           metricsPort,
+		Logger:                      appLogger,
 	}
 
-	appLogger.Info("oms-gatway", "version", version)
+	shutdownTracing, err := tracing.Setup(ctx, tracingConfig)
+	if err != nil {
+		log.Fatalf("failed to set up tracing: %v", err)
+	}
+	defer func() {
+		if err := shutdownTracing(context.Background()); err != nil {
+			appLogger.Error("failed to flush traces", "err", err)
+		}
+	}()
+
+	appLogger.Info("oms-gatway", "version", version, "tracing", tracingConfig.Exporter)
 	runGatewayServer(ctx, options, appLogger)
 }
 
 func runGatewayServer(ctx context.Context, opts *internal.Options, logger *slog.Logger) {
 	svc, err := internal.New(opts)
 	if err != nil {
-		log.Fatal("gateway service failed to start.")
+		log.Fatalf("gateway service failed to start: %v", err)
 	}
 
 	orderSvcClient := omspb.NewOrderServiceClient(svc.OrderSvcClientConn)
 	productSvcClient := omspb.NewProductServiceClient(svc.ProductSvcClientConn)
 
-	gatewaySvc := gatewayservice.New(productSvcClient, orderSvcClient)
+	gatewaySvc := gatewayservice.New(productSvcClient, orderSvcClient, logger)
+
+	rateLimiter := middlewares.NewRateLimiter(opts.RateLimiter)
+	ipRateLimiter := middlewares.NewRateLimiter(opts.IPRateLimiter)
+	var oidcProviders []*auth.OIDCProvider
+	for _, cfg := range opts.OIDCProviders {
+		provider := auth.NewOIDCProvider(cfg, nil, logger)
+		go provider.Run(ctx)
+		oidcProviders = append(oidcProviders, provider)
+		logger.Info("accepting tokens from OIDC issuer", "issuer", cfg.Issuer)
+	}
 
-	mux := runtime.NewServeMux()
-	muxWithMiddlewares := bindMiddlewaresToMux(mux, middlewares.Authorize, middlewares.RateLimitMiddleware(10, time.Second))
-	muxWithMiddlewares.HandleFunc("/login", authHandler(logger))
+	apiKeys := auth.NewAPIKeys(opts.APIKeys, opts.Policy.Scopes(), logger)
+	authorizer := middlewares.NewAuthorizer(auth.NewTokenVerifier(opts.JWTKeys, opts.Token, opts.Revocations, oidcProviders), apiKeys, opts.Policy, opts.Metrics)
+	tokenIssuer := auth.NewTokenIssuer(opts.JWTKeys, opts.Token, opts.Users, opts.RefreshTokens, opts.Revocations)
+	authenticator := auth.NewAuthenticator(opts.Users, opts.Lockout)
+	apiKeysFile, _ := opts.APIKeys.(*auth.FileAPIKeyStore)
+	go reloadOnSignal(opts.JWTKeys, opts.Users, apiKeysFile, logger)
+	if apiKeysFile != nil {
+		go flushAPIKeys(ctx, apiKeysFile, auth.DefaultAPIKeyFlushInterval, logger)
+	}
+
+	// The path length fallback routes form encoded POSTs to GET handlers, or
+	// to any method named by X-HTTP-Method-Override, after the authorizer has
+	// checked the policy for the original method.
+	mux := runtime.NewServeMux(
+		runtime.WithErrorHandler(middlewares.ProblemErrorHandler),
+		runtime.WithRoutingErrorHandler(middlewares.ProblemRoutingErrorHandler),
+		runtime.WithDisablePathLengthFallback(),
+	)
+	rejectWhileDraining := middlewares.RejectWhileDraining(svc.IsDraining)
+	// The per-IP limit runs before authentication so that floods of bad
+	// credentials are throttled before reaching the verifier.
+	muxWithMiddlewares := bindMiddlewaresToMux(mux, rejectWhileDraining, middlewares.RejectMethodOverride, ipRateLimiter.Middleware, authorizer.Middleware, rateLimiter.Middleware)
+	muxWithMiddlewares.Handle("/login", rejectWhileDraining(ipRateLimiter.Middleware(handlers.Login(authenticator, tokenIssuer, opts.Metrics, logger))))
+	muxWithMiddlewares.Handle("/token/refresh", rejectWhileDraining(ipRateLimiter.Middleware(handlers.Refresh(tokenIssuer, opts.Metrics, logger))))
+	muxWithMiddlewares.HandleFunc("/healthz", handlers.Health)
+	muxWithMiddlewares.HandleFunc("/readyz", handlers.Ready(svc, opts.HealthCheckTimeout))
+	muxWithMiddlewares.HandleFunc("/.well-known/jwks.json", handlers.JWKS(opts.JWTKeys, logger))
+	routes := middlewares.RouteTable{
+		{Method: "*", Pattern: "/login"},
+		{Method: "*", Pattern: "/token/refresh"},
+		{Method: "*", Pattern: "/healthz"},
+		{Method: "*", Pattern: "/readyz"},
+		{Method: "*", Pattern: "/.well-known/jwks.json"},
+	}
 
 	if err := omspb.RegisterGatewayServiceHandlerServer(ctx, mux, gatewaySvc); err != nil {
 		log.Fatalf("faild to register: %v", err)
 	}
+	routes = append(routes, middlewares.ServiceRoutes(omspb.GatewayService_ServiceDesc.ServiceName)...)
+	// Registered on the gateway mux so they go through authorization.
+	for _, handler := range []struct {
+		route   middlewares.Route
+		handler runtime.HandlerFunc
+	}{
+		{middlewares.Route{Method: http.MethodPost, Pattern: "/logout"}, handlers.Logout(tokenIssuer, logger)},
+		{middlewares.Route{Method: http.MethodPost, Pattern: "/admin/revocations"}, handlers.RevokeSubject(tokenIssuer, logger)},
+		{middlewares.Route{Method: http.MethodPost, Pattern: "/admin/api-keys"}, handlers.CreateAPIKey(apiKeys, logger)},
+		{middlewares.Route{Method: http.MethodGet, Pattern: "/admin/api-keys"}, handlers.ListAPIKeys(apiKeys, logger)},
+		{middlewares.Route{Method: http.MethodDelete, Pattern: "/admin/api-keys/{id}"}, handlers.RevokeAPIKey(apiKeys, logger)},
+	} {
+		if err := mux.HandlePath(handler.route.Method, handler.route.Pattern, handler.handler); err != nil {
+			log.Fatalf("faild to register: %v", err)
+		}
+		routes = append(routes, handler.route)
+	}
+	routeOf := func(r *http.Request) string {
+		if route, ok := routes.Lookup(r.Method, r.URL.Path); ok {
+			return route.Pattern
+		}
+		return metrics.UnmatchedRoute
+	}
+	accessLogger := middlewares.NewAccessLogger(logger, routeOf, "/healthz", "/readyz", "/grpc.health.v1.Health/Check")
+
+	var tlsConfig *tls.Config
+	if opts.TLS != nil {
+		tlsConfig, err = certs.NewServerTLSConfig(*opts.TLS, logger)
+		if err != nil {
+			log.Fatalf("failed to load TLS certificate: %v", err)
+		}
+	}
 
+	server := &http.Server{
+		Addr:      ":" + opts.ListenAddressHTTPPort,
+		Handler:   tracingMiddleware(routeOf)(opts.Metrics.Middleware(routeOf)(accessLogger.Middleware(muxWithMiddlewares))),
+		TLSConfig: tlsConfig,
+	}
 	go func() {
-		if err := http.ListenAndServe(":"+opts.ListenAddressHTTPPort, muxWithMiddlewares); err != nil {
-			log.Fatalf("Failed to start server:: http.ListenAndServe(): %v", err)
+		// HTTP/2 is negotiated automatically over TLS.
+		var err error
+		if tlsConfig != nil {
+			err = server.ListenAndServeTLS("", "")
+		} else {
+			err = server.ListenAndServe()
+		}
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatalf("Failed to start server:: server.ListenAndServe(): %v", err)
 		}
 	}()
-	logger.Info("server listening at:", "port", opts.ListenAddressHTTPPort)
+	logger.Info("server listening at:", "port", opts.ListenAddressHTTPPort, "tls", tlsConfig != nil)
+
+	grpcOpts := []grpc.ServerOption{
+		grpc.StatsHandler(otelgrpc.NewServerHandler()),
+		grpc.ChainUnaryInterceptor(opts.Metrics.UnaryServerInterceptor, accessLogger.UnaryInterceptor, ipRateLimiter.UnaryInterceptor, authorizer.UnaryInterceptor, rateLimiter.UnaryInterceptor),
+	}
+	if tlsConfig != nil {
+		grpcOpts = append(grpcOpts, grpc.Creds(credentials.NewTLS(tlsConfig)))
+	}
+	grpcServer := grpc.NewServer(grpcOpts...)
+	omspb.RegisterGatewayServiceServer(grpcServer, gatewaySvc)
+	healthServer := health.NewServer()
+	healthpb.RegisterHealthServer(grpcServer, healthServer)
+	go updateGRPCHealth(ctx, svc, healthServer, opts.HealthCheckTimeout)
 
-	shutdownOnSignal(svc)
+	lis, err := net.Listen("tcp", ":"+opts.ListenAddressGRPCPort)
+	if err != nil {
+		log.Fatalf("failed to listen on grpc port: %v", err)
+	}
+	go func() {
+		if err := grpcServer.Serve(lis); err != nil {
+			log.Fatalf("Failed to start server:: grpcServer.Serve(): %v", err)
+		}
+	}()
+	logger.Info("grpc server listening at:", "port", opts.ListenAddressGRPCPort)
+
+	// The metrics are unauthenticated, so they get a listener of their own
+	// that is not exposed publicly.
+	metricsMux := http.NewServeMux()
+	metricsMux.Handle("/metrics", opts.Metrics.Handler())
+	go func() {
+		if err := http.ListenAndServe(":"+opts.MetricsListenPort, metricsMux); err != nil {
+			log.Fatalf("Failed to start metrics server: %v", err)
+		}
+	}()
+	logger.Info("metrics listening at:", "port", opts.MetricsListenPort)
+
+	shutdownOnSignal(svc, server, grpcServer, healthServer, opts.ShutdownPreStopDelay, opts.ShutdownDrainTimeout, logger)
+	if apiKeysFile != nil {
+		if err := apiKeysFile.Flush(context.Background()); err != nil {
+			logger.Error("failed to write the last use of API keys", "err", err)
+		}
+	}
+}
+
+// tracingMiddleware starts a span named after the route of each request,
+// continuing the trace of an incoming traceparent header. Probes are not
+// traced.
+func tracingMiddleware(routeOf func(r *http.Request) string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return otelhttp.NewHandler(next, "http",
+			otelhttp.WithSpanNameFormatter(func(_ string, r *http.Request) string {
+				return r.Method + " " + routeOf(r)
+			}),
+			otelhttp.WithFilter(func(r *http.Request) bool {
+				switch r.URL.Path {
+				case "/healthz", "/readyz":
+					return false
+				}
+				return true
+			}),
+		)
+	}
 }
 
 func bindMiddlewaresToMux(mux *runtime.ServeMux, mws ...alice.Constructor) *http.ServeMux {
@@ -105,74 +399,135 @@ func bindMiddlewaresToMux(mux *runtime.ServeMux, mws ...alice.Constructor) *http
 	return muxWithMiddlewares
 }
 
-func authHandler(logger *slog.Logger) func(w http.ResponseWriter, r *http.Request) {
-	return func(w http.ResponseWriter, r *http.Request) {
-		tokenRequest, err := getTokenRequest(r)
-		if err != nil {
-			sendResponse(w, []byte(err.Error()), "", http.StatusBadRequest)
-			return
-		}
+// updateGRPCHealth mirrors the backend checks of /readyz in the gateway's own
+// grpc.health.v1 service until ctx is done.
+func updateGRPCHealth(ctx context.Context, svc *internal.Service, healthServer *health.Server, timeout time.Duration) {
+	ticker := time.NewTicker(grpcHealthInterval)
+	defer ticker.Stop()
 
-		if strings.Trim(tokenRequest.Email, " ") == "" {
-			sendResponse(w, []byte(ErrInvalidTokenRequest), "", http.StatusBadRequest)
-			return
+	for {
+		servingStatus := healthpb.HealthCheckResponse_SERVING
+		for _, backend := range svc.CheckBackends(ctx, timeout) {
+			if !backend.Ready {
+				servingStatus = healthpb.HealthCheckResponse_NOT_SERVING
+			}
 		}
-
-		token, err := auth.GenerateAccessToken(*tokenRequest)
-		if err != nil {
-			log.Fatal(err)
+		if !svc.IsNotReady() {
+			healthServer.SetServingStatus("", servingStatus)
+			healthServer.SetServingStatus(omspb.GatewayService_ServiceDesc.ServiceName, servingStatus)
 		}
-		tokenBytes, err := json.Marshal(token)
-		if err != nil {
-			logger.Error("authHandler:", "err", fmt.Sprintf("failed to create token: %v", err))
-			sendResponse(w, []byte("failed to create token"), "", http.StatusInternalServerError)
+
+		select {
+		case <-ctx.Done():
 			return
+		case <-ticker.C:
 		}
-		sendResponse(w, tokenBytes, EncodingTypeJSON, http.StatusOK)
 	}
 }
 
-func getTokenRequest(req *http.Request) (*auth.TokenRequest, error) {
-	body, err := io.ReadAll(req.Body)
-	if err != nil {
-		return nil, errors.New("failed to read login request")
-	}
-	defer req.Body.Close()
+// reloadOnSignal re-reads the JWT keys, the users file and the API keys file,
+// when one is used, on SIGHUP so keys can be rotated and users changed without
+// a restart.
+func reloadOnSignal(keys *auth.KeySet, users *auth.FileUserStore, apiKeys *auth.FileAPIKeyStore, logger *slog.Logger) {
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, syscall.SIGHUP)
 
-	var tokenRequest auth.TokenRequest
-	err = json.Unmarshal(body, &tokenRequest)
-	if err != nil {
-		return nil, errors.New("failed parse request data")
+	for range c {
+		if err := keys.Reload(); err != nil {
+			logger.Error("failed to reload JWT keys, keeping current keys", "err", err)
+		} else {
+			logger.Info("reloaded JWT keys", "signingKeyID", keys.SigningKey().ID)
+		}
+
+		if err := users.Reload(); err != nil {
+			logger.Error("failed to reload users, keeping current users", "err", err)
+		} else {
+			logger.Info("reloaded users")
+		}
+
+		if apiKeys == nil {
+			continue
+		}
+		if err := apiKeys.Reload(); err != nil {
+			logger.Error("failed to reload API keys, keeping current keys", "err", err)
+		} else {
+			logger.Info("reloaded API keys")
+		}
 	}
-	return &tokenRequest, nil
 }
 
-func sendResponse(w http.ResponseWriter, bodyBytes []byte, encoding string, status int) {
-	if encoding == EncodingTypeJSON {
-		w.Header().Set("Content-Type", "application/json")
+// flushAPIKeys writes the last use of API keys to their file every interval
+// until ctx is done.
+func flushAPIKeys(ctx context.Context, apiKeys *auth.FileAPIKeyStore, interval time.Duration, logger *slog.Logger) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := apiKeys.Flush(ctx); err != nil {
+				logger.Error("failed to write the last use of API keys", "err", err)
+			}
+		}
 	}
-	w.WriteHeader(status)
-	w.Write(bodyBytes)
 }
 
-func waitForShutdownSignal() string {
+func waitForShutdownSignal() (string, <-chan os.Signal) {
 	c := make(chan os.Signal, 1)
 	signal.Notify(c, syscall.SIGINT, syscall.SIGTERM)
 
 	sig := <-c
 
-	return sig.String()
+	return sig.String(), c
 }
 
-func shutdownOnSignal(svc *internal.Service) {
-	signalName := waitForShutdownSignal()
-	fmt.Printf("recieved signal: %s starting shutdown...", signalName)
+// shutdownOnSignal drains both listeners once a termination signal arrives.
+// Readiness fails first, while requests are still served for preStopDelay so
+// load balancers can take the gateway out of rotation; a second signal cuts
+// the delay short. The service is then marked as draining so new requests are
+// turned away, and in-flight requests get up to drainTimeout to finish before
+// the backend connections are closed.
+func shutdownOnSignal(svc *internal.Service, server *http.Server, grpcServer *grpc.Server, healthServer *health.Server, preStopDelay, drainTimeout time.Duration, logger *slog.Logger) {
+	signalName, signals := waitForShutdownSignal()
+	logger.Info("starting shutdown", "signal", signalName, "preStopDelay", preStopDelay.String(), "drainTimeout", drainTimeout.String())
+
+	svc.MarkNotReady()
+	healthServer.Shutdown()
 
-	if svc.OrderSvcClientConn != nil {
-		svc.OrderSvcClientConn.Close()
+	select {
+	case <-time.After(preStopDelay):
+	case sig := <-signals:
+		logger.Info("skipping pre-stop delay", "signal", sig.String())
 	}
 
-	if svc.ProductSvcClientConn != nil {
-		svc.ProductSvcClientConn.Close()
+	svc.StartDraining()
+
+	ctx, cancel := context.WithTimeout(context.Background(), drainTimeout)
+	defer cancel()
+
+	if err := server.Shutdown(ctx); err != nil {
+		logger.Error("http server did not drain in time", "err", err)
+	}
+	stopGRPCServer(ctx, grpcServer)
+
+	if err := svc.Shutdown(ctx); err != nil {
+		logger.Error("failed to close backend connections", "err", err)
+	}
+	logger.Info("shutdown complete")
+}
+
+func stopGRPCServer(ctx context.Context, grpcServer *grpc.Server) {
+	stopped := make(chan struct{})
+	go func() {
+		grpcServer.GracefulStop()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+	case <-ctx.Done():
+		grpcServer.Stop()
 	}
 }